@@ -1,7 +1,9 @@
 // Package main provides the CLI entry point for the server log analyzer
 // This tool provides two main commands:
 // 1. load - Parse CSV log files and store them in SQLite database
-// 2. query - Execute SQL queries against the stored log data
+// 2. query - Execute SQL queries, or plain English questions, against the stored log data
+// history and unload list and roll back past loads; watch loads files dropped into a directory
+// stats answers the standard questions about the logs without SQL
 package main
 
 import (
@@ -29,6 +31,10 @@ complex analysis scenarios.`,
 	// Add subcommands
 	rootCmd.AddCommand(commands.NewLoadCommand())
 	rootCmd.AddCommand(commands.NewQueryCommand())
+	rootCmd.AddCommand(commands.NewHistoryCommand())
+	rootCmd.AddCommand(commands.NewUnloadCommand())
+	rootCmd.AddCommand(commands.NewWatchCommand())
+	rootCmd.AddCommand(commands.NewStatsCommand())
 
 	// Execute the root command
 	if err := rootCmd.Execute(); err != nil {
@@ -0,0 +1,440 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"server-log-analyzer/internal/database"
+	"server-log-analyzer/internal/parser"
+)
+
+// maxFollowChunk is the most a follow poll reads from the file at once; a
+// larger backlog, such as the content of the file when following starts, is
+// loaded over several polls
+const maxFollowChunk = 4 << 20
+
+// fingerprintSize is how much of the start of a followed file identifies it
+const fingerprintSize = 1024
+
+// checkFollowable reports why the inputs of a load cannot be followed
+func checkFollowable(opts loadOptions, files []string) error {
+	if len(files) != 1 || files[0] == stdinFile {
+		return fmt.Errorf("--follow needs exactly one file, not %d files or standard input", len(files))
+	}
+	if !opts.schemaDetection {
+		return fmt.Errorf("--follow cannot be used with --schema-detection=false")
+	}
+	if parser.TrimCompressionExtension(files[0]) != files[0] {
+		return fmt.Errorf("--follow cannot follow compressed file %s", files[0])
+	}
+	if opts.format == string(parser.FormatJSONL) || (opts.format == string(parser.FormatAuto) && parser.IsJSONLFile(files[0])) {
+		return fmt.Errorf("--follow does not support JSON Lines input")
+	}
+	if opts.pollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %s", opts.pollInterval)
+	}
+	return nil
+}
+
+// follower appends the lines written to a file to a table as they arrive
+// Each poll loads the complete lines, or CSV records, added since the last one
+// in a transaction that also saves the new offset, so a restart resumes
+// exactly after them
+type follower struct {
+	opts    loadOptions
+	read    parser.ReadOptions
+	name    string // File name as given on the command line
+	path    string // Absolute path, the key of the saved offset
+	schema  *parser.TableSchema
+	rejects *rejectLog
+
+	file        *os.File
+	offset      int64    // End of the last line loaded
+	lines       int      // Lines before offset
+	fingerprint string   // Checksum of the start of the file, up to offset
+	followed    bool     // Whether an offset was saved by an earlier follow
+	formatRead  bool     // Whether the format, and headers, of the file are known
+	headers     []string // CSV header row of the file; nil for other formats
+
+	batchID    int64
+	insertOpts database.InsertOptions
+	loaded     int64
+	duplicates int64
+}
+
+// followFile loads a file and then keeps loading the lines appended to it,
+// across log rotation, until the context is cancelled or the process is
+// interrupted. A restart resumes from the offset saved by the previous run
+func followFile(opts loadOptions, src *inputSource, file string, rejects *rejectLog, override *parser.SchemaOverride) error {
+	ctx := opts.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", file, err)
+	}
+
+	db, err := database.Initialize(opts.dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	f := &follower{opts: opts, read: src.read, name: file, path: path, rejects: rejects}
+	if f.file, err = os.Open(file); err != nil {
+		return fmt.Errorf("failed to open %s: %w", file, err)
+	}
+	defer func() { f.file.Close() }()
+
+	resumed, err := f.resume(db)
+	if err != nil {
+		return err
+	}
+
+	schema, fileSchemas, sampled, err := detectFileSchemas(src, []string{file}, opts, nil, override)
+	if err != nil {
+		return err
+	}
+	printDetectedSchema(schema, sampled)
+	f.schema = schema
+
+	// A file followed into the table before keeps its records, even when it
+	// changed since and is loaded again from the start
+	setupOpts := opts
+	setupOpts.appendMode = opts.appendMode || f.followed
+	err = database.WithTransaction(db, func(tx database.Executor) error {
+		if err := prepareTable(tx, setupOpts, schema, fileSchemas); err != nil {
+			return err
+		}
+		var err error
+		if f.batchID, err = beginLoadBatch(tx, setupOpts, schema); err != nil {
+			return err
+		}
+		f.insertOpts, err = insertOptions(tx, opts, f.batchID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if resumed {
+		fmt.Printf("Resuming %s at line %d, appending to table '%s'\n", file, f.lines+1, opts.tableName)
+	}
+	fmt.Printf("Following %s (load batch %d); press Ctrl-C to stop\n", file, f.batchID)
+
+	for {
+		loaded, err := f.poll(db)
+		if err != nil {
+			return err
+		}
+		if loaded {
+			if ctx.Err() == nil {
+				continue
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+			case <-time.After(opts.pollInterval):
+				continue
+			}
+		}
+
+		fmt.Printf("Stopped following %s: loaded %d records into table '%s' (load batch %d)\n", file, f.loaded, opts.tableName, f.batchID)
+		printDuplicates(f.insertOpts.DedupeKey, f.duplicates)
+		return nil
+	}
+}
+
+// resume restores the offset saved by an earlier follow of the file into the
+// table, unless the file was truncated or replaced since. Either way an
+// earlier follow marks the table as followed, so it is appended to
+func (f *follower) resume(db database.Executor) (bool, error) {
+	saved, err := database.GetLoadOffset(db, f.opts.tableName, f.path)
+	if err != nil || saved == nil {
+		return false, err
+	}
+	f.followed = true
+
+	if fingerprint, err := f.fingerprintAt(saved.Offset); err != nil || fingerprint != saved.Fingerprint {
+		fmt.Printf("%s changed since it was last followed, loading it from the start and appending to table '%s'\n", f.name, f.opts.tableName)
+		return false, nil
+	}
+
+	f.offset, f.lines, f.fingerprint = saved.Offset, saved.Lines, saved.Fingerprint
+	return true, nil
+}
+
+// fingerprintAt returns the checksum of the first bytes of the file, up to
+// offset; it changes when the file is truncated or replaced by other content
+func (f *follower) fingerprintAt(offset int64) (string, error) {
+	start := make([]byte, min(offset, fingerprintSize))
+	if _, err := f.file.ReadAt(start, 0); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(start)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// poll loads what was appended to the file since the last poll and reports
+// whether anything was loaded. Once the file is exhausted it checks whether
+// the file was rotated and, if so, finishes it and switches to the new file
+func (f *follower) poll(db database.DB) (bool, error) {
+	// A file truncated in place (copytruncate) is read again from the start
+	if f.truncated() {
+		fmt.Printf("%s was truncated, loading it from the start\n", f.name)
+		f.reset()
+	}
+
+	loaded, err := f.loadLines(db, false)
+	if err != nil || loaded {
+		return loaded, err
+	}
+
+	// Caught up: a new file at the path means the followed one was rotated
+	info, err := os.Stat(f.name)
+	if err != nil {
+		return false, nil // Not created yet
+	}
+	current, err := f.file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", f.name, err)
+	}
+	if os.SameFile(info, current) {
+		return false, nil
+	}
+
+	next, err := os.Open(f.name)
+	if err != nil {
+		return false, nil
+	}
+	// The rotated file is complete: load its last line even without a newline
+	for loaded = true; loaded && err == nil; {
+		loaded, err = f.loadLines(db, true)
+	}
+	if err != nil {
+		next.Close()
+		return false, err
+	}
+
+	fmt.Printf("%s was rotated, following the new file\n", f.name)
+	f.file.Close()
+	f.file = next
+	f.reset()
+	return true, nil
+}
+
+// truncated reports whether the content before the offset has changed
+func (f *follower) truncated() bool {
+	if f.offset == 0 {
+		return false
+	}
+	if info, err := f.file.Stat(); err != nil || info.Size() < f.offset {
+		return true
+	}
+	fingerprint, err := f.fingerprintAt(f.offset)
+	return err != nil || fingerprint != f.fingerprint
+}
+
+// reset starts reading the followed file from the beginning
+func (f *follower) reset() {
+	f.offset, f.lines, f.fingerprint = 0, 0, ""
+	f.formatRead, f.headers = false, nil
+}
+
+// loadLines loads the complete lines after the offset, up to maxFollowChunk
+// bytes, and reports whether there were any. With final set, a last line
+// without a newline is loaded too
+func (f *follower) loadLines(db database.DB, final bool) (bool, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", f.name, err)
+	}
+	if info.Size() <= f.offset {
+		return false, nil
+	}
+
+	chunk := make([]byte, min(info.Size()-f.offset, maxFollowChunk))
+	n, err := f.file.ReadAt(chunk, f.offset)
+	if err != nil && err != io.EOF {
+		return false, fmt.Errorf("failed to read %s: %w", f.name, err)
+	}
+	chunk = chunk[:n]
+
+	// A line without a newline may still be being written, as may a CSV record
+	// whose quoted field holds newlines
+	whole := final && f.offset+int64(len(chunk)) == info.Size()
+	end := bytes.LastIndexByte(chunk, '\n') + 1
+	if !f.formatRead && (end > 0 || whole) {
+		if err := f.readFormat(chunk); err != nil {
+			return false, err
+		}
+	}
+	if f.headers != nil {
+		end = f.read.CSV.CompleteRecords(chunk)
+	}
+	if end < len(chunk) && !whole {
+		if end == 0 && len(chunk) == maxFollowChunk {
+			return false, fmt.Errorf("%s record at line %d is longer than %d bytes", f.name, f.lines+1, maxFollowChunk)
+		}
+		chunk = chunk[:end]
+	}
+	if len(chunk) == 0 {
+		return false, nil
+	}
+	lines := bytes.Count(chunk, []byte("\n"))
+	if chunk[len(chunk)-1] != '\n' {
+		lines++
+	}
+
+	offset := f.offset + int64(len(chunk))
+	var fingerprint string
+	var loaded, duplicates int64
+	rejectedBefore := f.rejects.Count()
+
+	err = database.WithTransaction(db, func(tx database.Executor) error {
+		reader, err := f.open(chunk)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		fileSchema, err := f.schema.ForHeaders(reader.Headers())
+		if err != nil {
+			return fmt.Errorf("schema of %s does not match: %w", f.name, err)
+		}
+
+		for {
+			records, lines, err := readBatch(reader, f.name, f.opts.batchSize, f.rejects)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", f.name, err)
+			}
+
+			inserted, rejected, err := database.InsertRecordsSkippingErrors(tx, f.opts.tableName, fileSchema.ColumnNames(), records, fileSchema, f.insertOpts)
+			if err != nil {
+				return fmt.Errorf("failed to insert records: %w", err)
+			}
+			for _, r := range rejected {
+				if err := f.rejects.Reject(f.name, lines[r.Index], r.Record, r.Err); err != nil {
+					return fmt.Errorf("failed to insert records: %w", err)
+				}
+			}
+			loaded += inserted
+			duplicates += int64(len(records)-len(rejected)) - inserted
+		}
+
+		if err := database.AddLoadBatchCounts(tx, f.batchID, loaded, int64(f.rejects.Count()-rejectedBefore)); err != nil {
+			return err
+		}
+
+		if fingerprint, err = f.fingerprintAt(offset); err != nil {
+			return fmt.Errorf("failed to read %s: %w", f.name, err)
+		}
+		return database.SaveLoadOffset(tx, database.LoadOffset{
+			Table:       f.opts.tableName,
+			Path:        f.path,
+			Offset:      offset,
+			Lines:       f.lines + lines,
+			Fingerprint: fingerprint,
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	f.offset, f.lines, f.fingerprint = offset, f.lines+lines, fingerprint
+	f.loaded += loaded
+	f.duplicates += duplicates
+	if loaded > 0 {
+		fmt.Printf("Loaded %d records from %s\n", loaded, f.name)
+	}
+	return true, nil
+}
+
+// open returns a reader for a chunk of the file starting at the offset
+// Only the first chunk of a CSV file has the header row: later chunks are
+// read as headerless CSV with the columns of that row
+func (f *follower) open(chunk []byte) (parser.RecordReader, error) {
+	read := f.read
+	if f.headers != nil && f.offset > 0 {
+		read.Format = parser.FormatCSV
+		read.CSV.Header = parser.HeaderNo
+		read.CSV.Columns = f.headers
+	}
+
+	reader, err := parser.NewRecordReader(bytes.NewReader(chunk), read)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s line %d: %w", f.name, f.lines+1, err)
+	}
+	return followedLines{RecordReader: reader, base: f.lines}, nil
+}
+
+// readFormat finds the format, and the header row of a CSV file, from the start
+// of the file: the content before the offset when resuming, else the chunk
+func (f *follower) readFormat(chunk []byte) error {
+	var start io.Reader = bytes.NewReader(chunk)
+	if f.offset > 0 {
+		start = io.NewSectionReader(f.file, 0, f.offset)
+	}
+	reader, err := parser.NewRecordReader(start, f.read)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", f.name, err)
+	}
+	defer reader.Close()
+
+	switch reader.(type) {
+	case *parser.JSONLReader:
+		return fmt.Errorf("--follow does not support JSON Lines input")
+	case *parser.CSVReader:
+		f.headers = reader.Headers()
+	}
+	f.formatRead = true
+	return nil
+}
+
+// followedLines numbers the records of a chunk by their line in the followed file
+type followedLines struct {
+	parser.RecordReader
+	base int
+}
+
+// Line returns the line number of the most recently read record in the file
+func (r followedLines) Line() int {
+	return r.base + r.RecordReader.Line()
+}
+
+// Read returns the next record; parse errors report the line in the file
+func (r followedLines) Read() ([]string, error) {
+	record, err := r.RecordReader.Read()
+	var csvErr *csv.ParseError
+	if errors.As(err, &csvErr) {
+		return nil, &parser.ParseError{Line: r.base + csvErr.Line, Err: csvErr.Err}
+	}
+	var parseErr *parser.ParseError
+	if errors.As(err, &parseErr) {
+		return nil, &parser.ParseError{Line: r.base + parseErr.Line, Err: parseErr.Err}
+	}
+	return record, err
+}
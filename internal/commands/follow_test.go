@@ -0,0 +1,225 @@
+package commands
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"server-log-analyzer/internal/database"
+)
+
+// startFollow runs 'load --follow' in the background until the returned
+// function is called, which returns the command's error
+func startFollow(t *testing.T, args ...string) func() error {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := NewLoadCommand()
+	cmd.SetArgs(append(args, "--follow", "--poll-interval", "10ms"))
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.ExecuteContext(ctx) }()
+	return func() error {
+		cancel()
+		return <-done
+	}
+}
+
+// waitForNames waits until the names in the table are the expected ones
+func waitForNames(t *testing.T, dbFile, want string) {
+	t.Helper()
+	var got string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		db, err := database.Initialize(dbFile)
+		if err != nil {
+			t.Fatalf("Failed to open database: %v", err)
+		}
+		results, err := database.ExecuteQuery(db, "SELECT name FROM users ORDER BY id")
+		db.Close()
+		if err != nil {
+			continue // The table is not created yet
+		}
+		names := make([]string, len(results))
+		for i, row := range results {
+			names[i] = row["name"].(string)
+		}
+		if got = strings.Join(names, ","); got == want {
+			return
+		}
+	}
+	t.Fatalf("Expected names %s, got %s", want, got)
+}
+
+// appendToFile appends content to a file
+func appendToFile(t *testing.T, path, content string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestLoadCommandFollow tests following a growing file through rotation,
+// truncation and a restart
+func TestLoadCommandFollow(t *testing.T) {
+	tempDir := t.TempDir()
+	csvFile := filepath.Join(tempDir, "server_log.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	if err := os.WriteFile(csvFile, []byte("user_id,name\n1,a\n2,b\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := startFollow(t, "--file", csvFile, "--db", dbFile, "--table", "users")
+	waitForNames(t, dbFile, "a,b")
+
+	// A line is only loaded once its newline is written
+	appendToFile(t, csvFile, "3,c\n4,")
+	waitForNames(t, dbFile, "a,b,c")
+	appendToFile(t, csvFile, "d\n")
+	waitForNames(t, dbFile, "a,b,c,d")
+
+	// Rotation: the rest of the old file is loaded, then the new file
+	appendToFile(t, csvFile, "5,e")
+	if err := os.Rename(csvFile, csvFile+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(csvFile, []byte("user_id,name\n6,f\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForNames(t, dbFile, "a,b,c,d,e,f")
+
+	// Truncation in place
+	if err := os.WriteFile(csvFile, []byte("user_id,name\n7,g\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForNames(t, dbFile, "a,b,c,d,e,f,g")
+
+	if err := stop(); err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+
+	// A restart resumes after the lines already loaded, even without --append
+	appendToFile(t, csvFile, "8,h\n")
+	stop = startFollow(t, "--file", csvFile, "--db", dbFile, "--table", "users")
+	waitForNames(t, dbFile, "a,b,c,d,e,f,g,h")
+	if err := stop(); err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+
+	// A file rotated while stopped is loaded from the start, still appending
+	if err := os.Rename(csvFile, csvFile+".2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(csvFile, []byte("user_id,name\n9,i\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	stop = startFollow(t, "--file", csvFile, "--db", dbFile, "--table", "users")
+	waitForNames(t, dbFile, "a,b,c,d,e,f,g,h,i")
+	if err := stop(); err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	batches, err := database.ListLoadBatches(db, "users")
+	if err != nil {
+		t.Fatalf("ListLoadBatches() error = %v", err)
+	}
+	if len(batches) != 3 || batches[0].Mode != "append" || batches[0].RowCount != 1 ||
+		batches[1].Mode != "append" || batches[1].RowCount != 1 || batches[2].RowCount != 7 {
+		t.Errorf("Expected batches of 7, 1 and 1 rows, the last two appended, got %+v", batches)
+	}
+	offset, err := database.GetLoadOffset(db, "users", csvFile)
+	if err != nil || offset == nil {
+		t.Fatalf("Expected a saved offset, got %v, %v", offset, err)
+	}
+	if offset.Lines != 2 || offset.Offset != int64(len("user_id,name\n9,i\n")) {
+		t.Errorf("Expected offset at the end of line 2, got %+v", offset)
+	}
+}
+
+// TestLoadCommandFollowMultilineRecords tests that a CSV record whose quoted
+// field holds a newline is only loaded once the whole record is written
+func TestLoadCommandFollowMultilineRecords(t *testing.T) {
+	tempDir := t.TempDir()
+	csvFile := filepath.Join(tempDir, "users.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	if err := os.WriteFile(csvFile, []byte("user_id,name\n1,a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := startFollow(t, "--file", csvFile, "--db", dbFile, "--table", "users")
+	waitForNames(t, dbFile, "a")
+
+	// Give a few polls the chance to load the first line of the record
+	appendToFile(t, csvFile, "2,\"b\n")
+	time.Sleep(50 * time.Millisecond)
+	appendToFile(t, csvFile, "b\"\n3,c\n")
+	waitForNames(t, dbFile, "a,b\nb,c")
+	if err := stop(); err != nil {
+		t.Fatalf("Follow failed: %v", err)
+	}
+
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	offset, err := database.GetLoadOffset(db, "users", csvFile)
+	if err != nil || offset == nil {
+		t.Fatalf("Expected a saved offset, got %v, %v", offset, err)
+	}
+	if offset.Lines != 5 {
+		t.Errorf("Expected offset at the end of line 5, got %+v", offset)
+	}
+}
+
+// TestLoadCommandFollowRejectsInputs tests the inputs --follow cannot follow
+func TestLoadCommandFollowRejectsInputs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"standard input", []string{"--file", "-"}, "exactly one file"},
+		{"several files", []string{"--file", "a.csv", "--file", "b.csv"}, "exactly one file"},
+		{"legacy schema", []string{"--file", "a.csv", "--schema-detection=false"}, "--schema-detection=false"},
+		{"compressed", []string{"--file", "a.csv.gz"}, "compressed"},
+		{"json lines", []string{"--file", "a.jsonl"}, "JSON Lines"},
+	}
+
+	tempDir := t.TempDir()
+	for _, name := range []string{"a.csv", "b.csv", "a.csv.gz", "a.jsonl"} {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte("x\n1\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := []string{"--db", filepath.Join(tempDir, "test.db"), "--follow"}
+			for _, arg := range tt.args {
+				if strings.Contains(arg, ".") {
+					arg = filepath.Join(tempDir, arg)
+				}
+				args = append(args, arg)
+			}
+			_, err := runForTest(t, NewLoadCommand(), args...)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"server-log-analyzer/internal/config"
+	"server-log-analyzer/internal/database"
+)
+
+// NewHistoryCommand creates the 'history' subcommand for listing past loads
+// Usage: server-log-analyzer history [--db logs.db] [--table logs] [--batch N]
+func NewHistoryCommand() *cobra.Command {
+	var dbFile string
+	var tableName string
+	var batchID int64
+
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List the loads recorded in the database",
+		Long: `List the load batches recorded in the database, most recent first.
+
+Every run of the load command is recorded as a load batch: the target table,
+the mode (replace or append), the number of rows loaded and rejected, the input
+files with their size and SHA-256 checksum, and the schema the rows were loaded
+with. Each loaded row stores its batch id in the _batch_id column.
+
+A batch is "active" while its rows are in the table, "replaced" once a later
+load in replace mode cleared the table, and "unloaded" after 'unload --batch'.
+
+Examples:
+  # List every load
+  server-log-analyzer history
+
+  # List the loads into one table
+  server-log-analyzer history --table access_logs
+
+  # Show the files, checksums and schema of one load
+  server-log-analyzer history --batch 3`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runHistoryCommand(cmd.OutOrStdout(), dbFile, tableName, batchID)
+		},
+	}
+
+	cmd.Flags().StringVarP(&dbFile, "db", "d", config.DefaultDatabaseFile, config.DatabaseFileDescription)
+	cmd.Flags().StringVarP(&tableName, "table", "t", "", "Only list the loads into this table")
+	cmd.Flags().Int64Var(&batchID, "batch", 0, "Show the details of one load batch")
+
+	return cmd
+}
+
+// runHistoryCommand lists the load batches, or shows one of them in detail
+func runHistoryCommand(out io.Writer, dbFile, tableName string, batchID int64) error {
+	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+		return fmt.Errorf("database file does not exist: %s\nPlease run 'load' command first", dbFile)
+	}
+
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	if batchID != 0 {
+		batch, err := database.GetLoadBatch(db, batchID)
+		if err != nil {
+			return err
+		}
+		if batch == nil {
+			return fmt.Errorf("load batch %d not found", batchID)
+		}
+		printLoadBatch(out, batch)
+		return nil
+	}
+
+	batches, err := database.ListLoadBatches(db, tableName)
+	if err != nil {
+		return err
+	}
+	printLoadHistory(out, batches)
+	return nil
+}
+
+// printLoadHistory displays one line per load batch
+func printLoadHistory(out io.Writer, batches []database.LoadBatch) {
+	if len(batches) == 0 {
+		fmt.Fprintln(out, "No loads recorded.")
+		return
+	}
+
+	fmt.Fprintln(out, "┌───────┬──────────────────────┬─────────┬────────────┬──────────┬─────────────────────┬──────────┐")
+	fmt.Fprintln(out, "│ Batch │ Table                │ Mode    │ Rows       │ Rejected │ Loaded (UTC)        │ Status   │")
+	fmt.Fprintln(out, "├───────┼──────────────────────┼─────────┼────────────┼──────────┼─────────────────────┼──────────┤")
+	for _, batch := range batches {
+		fmt.Fprintf(out, "│ %5d │ %-20s │ %-7s │ %10d │ %8d │ %-19s │ %-8s │\n",
+			batch.ID, truncateString(batch.Table, 20), batch.Mode, batch.RowCount, batch.RejectedCount,
+			batch.LoadedAt.UTC().Format(time.DateTime), batch.Status)
+	}
+	fmt.Fprintln(out, "└───────┴──────────────────────┴─────────┴────────────┴──────────┴─────────────────────┴──────────┘")
+	fmt.Fprintf(out, "(%d loads)\n", len(batches))
+}
+
+// printLoadBatch displays everything recorded about one load batch
+func printLoadBatch(out io.Writer, batch *database.LoadBatch) {
+	fmt.Fprintf(out, "Load batch %d\n", batch.ID)
+	fmt.Fprintf(out, "  Table:    %s\n", batch.Table)
+	fmt.Fprintf(out, "  Mode:     %s\n", batch.Mode)
+	fmt.Fprintf(out, "  Loaded:   %s UTC\n", batch.LoadedAt.UTC().Format(time.DateTime))
+	fmt.Fprintf(out, "  Status:   %s", batch.Status)
+	if batch.UnloadedAt != nil {
+		fmt.Fprintf(out, " (%s UTC)", batch.UnloadedAt.UTC().Format(time.DateTime))
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "  Rows:     %d loaded, %d rejected\n", batch.RowCount, batch.RejectedCount)
+
+	fmt.Fprintf(out, "  Files:\n")
+	for _, file := range batch.Files {
+		path := file.Path
+		if path == stdinFile {
+			path = "(standard input)"
+		}
+		fmt.Fprintf(out, "    %s\n", path)
+		fmt.Fprintf(out, "      %d bytes, %d rows, sha256 %s\n", file.Size, file.RowCount, file.Checksum)
+	}
+
+	fmt.Fprintf(out, "  Schema:\n")
+	for _, line := range strings.Split(batch.Schema, "\n") {
+		fmt.Fprintf(out, "    %s\n", line)
+	}
+}
@@ -0,0 +1,94 @@
+package commands
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"server-log-analyzer/internal/database"
+)
+
+// loadForTest runs the load command with the given arguments
+func loadForTest(t *testing.T, args ...string) {
+	t.Helper()
+	cmd := NewLoadCommand()
+	cmd.SetArgs(args)
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("Load %v failed: %v", args, err)
+	}
+}
+
+// runForTest runs a command and returns its output
+func runForTest(t *testing.T, cmd *cobra.Command, args ...string) (string, error) {
+	t.Helper()
+	var out bytes.Buffer
+	cmd.SetArgs(args)
+	cmd.SetOut(&out)
+	cmd.SetErr(io.Discard)
+	err := cmd.Execute()
+	return out.String(), err
+}
+
+// TestHistoryCommand tests listing loads and showing one in detail
+func TestHistoryCommand(t *testing.T) {
+	tempDir := t.TempDir()
+
+	csvFile := filepath.Join(tempDir, "users.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	if err := os.WriteFile(csvFile, []byte("user_id,name\n1,John\n2,Jane\n"), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+
+	loadForTest(t, "--file", csvFile, "--db", dbFile, "--table", "users")
+	loadForTest(t, "--file", csvFile, "--db", dbFile, "--table", "users", "--append", "--force")
+	loadForTest(t, "--file", csvFile, "--db", dbFile, "--table", "others")
+
+	out, err := runForTest(t, NewHistoryCommand(), "--db", dbFile, "--table", "users")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	for _, want := range []string{"│     2 │ users", "append", "│     1 │ users", "replace", "(2 loads)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected history to contain %q, got:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "others") {
+		t.Errorf("Expected only loads into users, got:\n%s", out)
+	}
+
+	out, err = runForTest(t, NewHistoryCommand(), "--db", dbFile, "--batch", "1")
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	// printf 'user_id,name\n1,John\n2,Jane\n' | sha256sum
+	checksum := "f14fc5f9222bab0c2f4b2b4896c2a36c93bf17d43825fec98405ba26d73a0db2"
+	for _, want := range []string{"Load batch 1", "Rows:     2 loaded, 0 rejected", csvFile, "27 bytes, 2 rows, sha256 " + checksum, "CREATE TABLE IF NOT EXISTS users"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected batch details to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if _, err := runForTest(t, NewHistoryCommand(), "--db", dbFile, "--batch", "9"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+
+	// Every row carries its batch id
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	results, err := database.ExecuteQuery(db, "SELECT _batch_id, COUNT(*) AS count FROM users GROUP BY _batch_id ORDER BY _batch_id")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 2 || results[0]["_batch_id"] != int64(1) || results[1]["count"] != int64(2) {
+		t.Errorf("Expected two rows for each of batches 1 and 2, got %v", results)
+	}
+}
@@ -0,0 +1,406 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"server-log-analyzer/internal/config"
+	"server-log-analyzer/internal/parser"
+)
+
+// stdinFile is the --file value that reads from standard input
+const stdinFile = "-"
+
+// expandInputFiles resolves the --file values into the list of files to load
+// Each value may be a file path, a glob pattern, a directory or "-" for standard
+// input; directories contribute the loadable files they directly contain. The
+// result is sorted and free of duplicates so rotated logs load in a predictable order
+func expandInputFiles(patterns []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var files []string
+
+	add := func(path string) {
+		clean := filepath.Clean(path)
+		if !seen[clean] {
+			seen[clean] = true
+			files = append(files, clean)
+		}
+	}
+
+	for _, pattern := range patterns {
+		// Standard input
+		if pattern == stdinFile {
+			add(pattern)
+			continue
+		}
+
+		// Glob patterns
+		if strings.ContainsAny(pattern, "*?[") {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file pattern '%s': %w", pattern, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no files match pattern: %s", pattern)
+			}
+			for _, match := range matches {
+				if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+					add(match)
+				}
+			}
+			continue
+		}
+
+		info, err := os.Stat(pattern)
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("CSV file does not exist: %s", pattern)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to access %s: %w", pattern, err)
+		}
+
+		// Plain files
+		if !info.IsDir() {
+			add(pattern)
+			continue
+		}
+
+		// Directories
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read directory %s: %w", pattern, err)
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.Type().IsRegular() && isLoadableFile(entry.Name()) {
+				add(filepath.Join(pattern, entry.Name()))
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("no CSV or JSON Lines files found in directory: %s", pattern)
+		}
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// isLoadableFile reports whether a file found in a directory should be loaded
+// CSV and JSON Lines files are included, compressed or not (server_log.csv.gz)
+func isLoadableFile(name string) bool {
+	return strings.EqualFold(filepath.Ext(parser.TrimCompressionExtension(name)), ".csv") || parser.IsJSONLFile(name)
+}
+
+// inputSource opens the files of a load as record readers
+// Standard input can only be read once, so the reader and the rows sampled for
+// schema detection are kept and replayed when the records are streamed
+type inputSource struct {
+	stdin    *digestReader // Checksums standard input as it is read
+	read     parser.ReadOptions
+	buffered map[string]*bufferedInput
+	sums     map[string]fileChecksum // Checksums of files already computed
+}
+
+// fileChecksum is the SHA-256 checksum and size of a file's raw content
+type fileChecksum struct {
+	sum  string
+	size int64
+}
+
+// bufferedInput is an input whose first records have already been read
+type bufferedInput struct {
+	reader  parser.RecordReader
+	records [][]string
+	lines   []int
+}
+
+// newInputSource creates an input source reading "-" from stdin and parsing
+// every input with the given options
+func newInputSource(stdin io.Reader, read parser.ReadOptions) *inputSource {
+	return &inputSource{
+		stdin:    newDigestReader(stdin),
+		read:     read,
+		buffered: make(map[string]*bufferedInput),
+		sums:     make(map[string]fileChecksum),
+	}
+}
+
+// open returns a record reader for a file, or for standard input if file is "-"
+func (s *inputSource) open(file string) (parser.RecordReader, error) {
+	if file == stdinFile {
+		return parser.NewRecordReader(s.stdin, s.read)
+	}
+	return parser.OpenRecords(file, s.read)
+}
+
+// checksum returns the SHA-256 checksum, hex encoded, and the size of a file's
+// raw content; for standard input, of the bytes read from it so far
+// Files are read once: later calls return the checksum computed first
+func (s *inputSource) checksum(file string) (string, int64, error) {
+	if file == stdinFile {
+		return s.stdin.Sum(), s.stdin.size, nil
+	}
+	if sum, ok := s.sums[file]; ok {
+		return sum.sum, sum.size, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to checksum %s: %w", file, err)
+	}
+	defer f.Close()
+
+	digest := newDigestReader(f)
+	if _, err := io.Copy(io.Discard, digest); err != nil {
+		return "", 0, fmt.Errorf("failed to checksum %s: %w", file, err)
+	}
+	s.sums[file] = fileChecksum{sum: digest.Sum(), size: digest.size}
+	return digest.Sum(), digest.size, nil
+}
+
+// digestReader computes the SHA-256 checksum and size of what is read through it
+type digestReader struct {
+	r    io.Reader
+	hash hash.Hash
+	size int64
+}
+
+// newDigestReader wraps r; a nil reader reads as empty
+func newDigestReader(r io.Reader) *digestReader {
+	if r == nil {
+		r = strings.NewReader("")
+	}
+	return &digestReader{r: r, hash: sha256.New()}
+}
+
+// Read implements io.Reader
+func (d *digestReader) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	d.hash.Write(p[:n])
+	d.size += int64(n)
+	return n, err
+}
+
+// Sum returns the hex encoded checksum of the bytes read so far
+func (d *digestReader) Sum() string {
+	return hex.EncodeToString(d.hash.Sum(nil))
+}
+
+// reopenable reports whether a file can be read a second time
+func (s *inputSource) reopenable(file string) bool {
+	return file != stdinFile
+}
+
+// keep stores a reader and the records already read from it so that
+// streamFiles starts with those records and then continues from the reader
+// It must be called before streaming starts
+func (s *inputSource) keep(file string, reader parser.RecordReader, records [][]string, lines []int) {
+	s.buffered[file] = &bufferedInput{reader: reader, records: records, lines: lines}
+}
+
+// Close releases the readers kept for replay
+func (s *inputSource) Close() {
+	for _, b := range s.buffered {
+		b.reader.Close()
+	}
+}
+
+// recordBatch is a batch of records read from one input file
+type recordBatch struct {
+	file    string
+	headers []string
+	records [][]string
+	lines   []int // Line number of each record in the file
+}
+
+// streamFiles reads every file in batches and passes each batch to fn
+// Up to parallel files are read and parsed concurrently, but fn is only ever
+// called from the calling goroutine, so it can safely write to the database
+// Reading stops at the first error returned by fn or by a reader
+func streamFiles(src *inputSource, files []string, batchSize, parallel int, rejects *rejectLog, fn func(recordBatch) error) error {
+	jobs := make(chan string)
+	batches := make(chan recordBatch, parallel)
+	errs := make(chan error, parallel)
+	done := make(chan struct{})
+
+	var stopOnce sync.Once
+	stop := func() { stopOnce.Do(func() { close(done) }) }
+
+	// Feed the files to the readers
+	go func() {
+		defer close(jobs)
+		for _, file := range files {
+			select {
+			case jobs <- file:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Start the readers
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				if err := streamFile(src, file, batchSize, rejects, batches, done); err != nil {
+					errs <- err
+					stop()
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(batches)
+	}()
+
+	// Consume batches, draining the channel after an error so readers can exit
+	var err error
+	for batch := range batches {
+		if err != nil {
+			continue
+		}
+		if err = fn(batch); err != nil {
+			stop()
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+// streamFile reads one file in batches and sends them to out until the file
+// is exhausted or done is closed
+func streamFile(src *inputSource, file string, batchSize int, rejects *rejectLog, out chan<- recordBatch, done <-chan struct{}) error {
+	send := func(batch recordBatch) bool {
+		select {
+		case out <- batch:
+			return true
+		case <-done:
+			return false
+		}
+	}
+
+	var reader parser.RecordReader
+	if buffered := src.buffered[file]; buffered != nil {
+		// Replay the records read during schema detection; the reader is closed by src
+		reader = buffered.reader
+		for start := 0; start < len(buffered.records); start += batchSize {
+			end := min(start+batchSize, len(buffered.records))
+			batch := recordBatch{file: file, headers: reader.Headers(), records: buffered.records[start:end], lines: buffered.lines[start:end]}
+			if !send(batch) {
+				return nil
+			}
+		}
+	} else {
+		var err error
+		if reader, err = src.open(file); err != nil {
+			return fmt.Errorf("failed to parse CSV file %s: %w", file, err)
+		}
+		defer reader.Close()
+	}
+
+	for {
+		records, lines, err := readBatch(reader, file, batchSize, rejects)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse CSV file %s: %w", file, err)
+		}
+
+		if !send(recordBatch{file: file, headers: reader.Headers(), records: records, lines: lines}) {
+			return nil
+		}
+	}
+}
+
+// readBatch reads up to size records along with the line number of each one
+// Malformed CSV lines and JSON objects are handed to the reject log rather than
+// ending the read, so an error-tolerant load can step over them
+func readBatch(reader parser.RecordReader, file string, size int, rejects *rejectLog) ([][]string, []int, error) {
+	batch := make([][]string, 0, size)
+	lines := make([]int, 0, size)
+
+	for len(batch) < size {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var csvErr *csv.ParseError
+		if errors.As(err, &csvErr) {
+			if err := rejects.Reject(file, csvErr.Line, nil, csvErr.Err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		var parseErr *parser.ParseError
+		if errors.As(err, &parseErr) {
+			if err := rejects.Reject(file, parseErr.Line, nil, parseErr.Err); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		batch = append(batch, record)
+		lines = append(lines, reader.Line())
+	}
+
+	if len(batch) == 0 {
+		return nil, nil, io.EOF
+	}
+
+	return batch, lines, nil
+}
+
+// sampleWholeFile reads the records after the head sample of a file and
+// replaces sample records at random as it goes, so that every record of the
+// file is equally likely to end up in the sample (reservoir sampling). The
+// random source is seeded the same way for every file, so detection gives the
+// same schema each time a file is loaded
+func sampleWholeFile(reader parser.RecordReader, file string, sample [][]string) error {
+	rng := rand.New(rand.NewPCG(1, 2))
+	seen := len(sample)
+	for {
+		records, _, err := readBatch(reader, file, config.DefaultBatchSize, nil)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			seen++
+			if i := rng.IntN(seen); i < len(sample) {
+				sample[i] = record
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// TestExpandInputFiles tests resolving file paths, globs and directories
+func TestExpandInputFiles(t *testing.T) {
+	tempDir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tempDir, "empty"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.csv", "b.CSV", "c.txt", "e.csv.gz", "f.txt.gz", "sub/d.csv"} {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		patterns []string
+		want     []string
+		wantErr  string
+	}{
+		{
+			name:     "single file",
+			patterns: []string{"c.txt"},
+			want:     []string{"c.txt"},
+		},
+		{
+			name:     "directory keeps only CSV files and does not recurse",
+			patterns: []string{"."},
+			want:     []string{"a.csv", "b.CSV", "e.csv.gz"},
+		},
+		{
+			name:     "glob",
+			patterns: []string{"*.csv", "sub/*.csv"},
+			want:     []string{"a.csv", "sub/d.csv"},
+		},
+		{
+			name:     "duplicates are removed",
+			patterns: []string{"a.csv", "./a.csv", "*.csv"},
+			want:     []string{"a.csv"},
+		},
+		{
+			name:     "standard input",
+			patterns: []string{"-", "a.csv"},
+			want:     []string{"-", "a.csv"},
+		},
+		{
+			name:     "missing file",
+			patterns: []string{"missing.csv"},
+			wantErr:  "does not exist",
+		},
+		{
+			name:     "glob without matches",
+			patterns: []string{"*.json"},
+			wantErr:  "no files match",
+		},
+		{
+			name:     "equivalent paths are merged",
+			patterns: []string{"sub/../c.txt", "sub/.."},
+			want:     []string{"a.csv", "b.CSV", "c.txt", "e.csv.gz"},
+		},
+		{
+			name:     "directory without CSV files",
+			patterns: []string{"empty"},
+			wantErr:  "no CSV or JSON Lines files found",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patterns := make([]string, len(tt.patterns))
+			for i, p := range tt.patterns {
+				patterns[i] = inTempDir(tempDir, p)
+			}
+
+			files, err := expandInputFiles(patterns)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("expandInputFiles() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expandInputFiles() unexpected error: %v", err)
+			}
+
+			want := make([]string, len(tt.want))
+			for i, w := range tt.want {
+				want[i] = inTempDir(tempDir, w)
+			}
+			if fmt.Sprint(files) != fmt.Sprint(want) {
+				t.Errorf("expandInputFiles() = %v, want %v", files, want)
+			}
+		})
+	}
+}
+
+// inTempDir joins a test path onto dir, leaving "-" (standard input) as is
+func inTempDir(dir, path string) string {
+	if path == stdinFile {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// TestStreamFiles tests that every record of every file is delivered, sequentially and in parallel
+func TestStreamFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	var files []string
+	for i := 0; i < 5; i++ {
+		var sb strings.Builder
+		sb.WriteString("id,name\n")
+		for j := 0; j < 23; j++ {
+			fmt.Fprintf(&sb, "%d,file%d\n", j, i)
+		}
+		path := filepath.Join(tempDir, fmt.Sprintf("f%d.csv", i))
+		if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+
+	for _, parallel := range []int{1, 3} {
+		t.Run(fmt.Sprintf("parallel=%d", parallel), func(t *testing.T) {
+			counts := make(map[string]int)
+			err := streamFiles(newInputSource(nil, parser.ReadOptions{Format: parser.FormatAuto}), files, 10, parallel, nil, func(batch recordBatch) error {
+				if len(batch.records) != len(batch.lines) {
+					t.Errorf("Batch has %d records but %d line numbers", len(batch.records), len(batch.lines))
+				}
+				counts[batch.file] += len(batch.records)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("streamFiles() unexpected error: %v", err)
+			}
+
+			for _, file := range files {
+				if counts[file] != 23 {
+					t.Errorf("File %s delivered %d records, want 23", file, counts[file])
+				}
+			}
+		})
+	}
+
+	t.Run("callback error stops the stream", func(t *testing.T) {
+		err := streamFiles(newInputSource(nil, parser.ReadOptions{Format: parser.FormatAuto}), files, 10, 2, nil, func(batch recordBatch) error {
+			return fmt.Errorf("stop here")
+		})
+		if err == nil || err.Error() != "stop here" {
+			t.Errorf("streamFiles() error = %v, want stop here", err)
+		}
+	})
+}
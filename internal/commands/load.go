@@ -2,44 +2,168 @@
 package commands
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/spf13/cobra"
 	"server-log-analyzer/internal/config"
 	"server-log-analyzer/internal/database"
+	"server-log-analyzer/internal/models"
 	"server-log-analyzer/internal/parser"
 )
 
 // NewLoadCommand creates the 'load' subcommand for importing CSV data into SQLite
-// Usage: server-log-analyzer load --file server_log.csv [--db logs.db] [--table logs] [--append] [--no-schema-detection]
+// Usage: server-log-analyzer load --file server_log.csv [--file more/*.csv ...] [--db logs.db] [--table logs] [--append] [--no-schema-detection] [--batch-size N] [--on-error skip] [--max-errors N]
 func NewLoadCommand() *cobra.Command {
-	var csvFile string
-	var dbFile string
-	var tableName string
-	var appendMode bool
-	var schemaDetection bool
+	var opts loadOptions
 
 	cmd := &cobra.Command{
 		Use:   "load",
-		Short: "Load CSV log file into SQLite database",
-		Long: `Parse a CSV log file and store the data in a SQLite database for efficient querying.
+		Short: "Load CSV or JSON Lines log files into SQLite database",
+		Long: `Parse CSV or JSON Lines log files and store the data in a SQLite database for efficient querying.
+
+Input Files (--file):
+--file accepts a file path, a glob pattern, a directory (every *.csv, *.jsonl
+and *.ndjson file it contains) or "-" for standard input, and may be repeated.
+All files are loaded into the same table in one run: the schema is detected for
+each file and reconciled (INTEGER and REAL columns widen to REAL, other
+conflicts to TEXT); files whose columns differ are rejected. Use --parallel N
+to read and parse several files concurrently.
+
+JSON Lines (--format):
+Files ending in .jsonl, .ndjson or .json, and inputs whose content starts with
+'{', are read as one JSON object per line; --format=csv or --format=jsonl forces
+the format. Nested objects are flattened into underscored column names
+({"http": {"status": 200}} becomes http_status), arrays are stored as JSON
+text and null or missing keys become NULL. The columns are the keys found in
+the first 1000 objects; later objects with other keys are rejected, and keys
+that would share a column name (a_b and a.b) are an error.
+
+Access Logs (--format=combined|common):
+Apache/Nginx access logs in the Combined or Common Log Format are loaded into
+the columns ip, user, timestamp, method, path, status, bytes and, for the
+combined format, referrer and user_agent. The schema is fixed rather than
+detected, and columns such as ip, timestamp, method and status are indexed. Files whose
+first line is in either format are recognised automatically; lines that do not
+match are rejected like malformed CSV lines.
+
+Custom Line Formats (--pattern):
+Any line-oriented log can be loaded with a regular expression whose named
+groups, (?P<name>...), become columns. Grok-style tokens can be used instead of
+raw expressions: %{TOKEN} inserts a token, %{TOKEN:name} captures it as a
+column and %{TOKEN:name:type} also declares its type (int, float, text,
+timestamp or bool); other column types are inferred from the values. Built-in
+tokens include INT, NUMBER, WORD, NOTSPACE, DATA, GREEDYDATA, QUOTEDSTRING, IP,
+HOSTNAME, USER, PATH, LOGLEVEL, UUID, TIMESTAMP_ISO8601, HTTPDATE and
+SYSLOGTIMESTAMP. --pattern-file adds tokens from a file of "NAME expression"
+lines (# starts a comment). Lines that do not match are rejected.
+
+Compressed files (gzip, bzip2, zstd) are decompressed on the fly. The format is
+detected from the file content, falling back to the .gz, .bz2 or .zst extension;
+directories also pick up *.csv.gz, *.csv.bz2 and *.csv.zst files.
+
+CSV Dialect:
+Use --delimiter for semicolon, pipe or tab-separated files, --comment to skip
+comment lines, --lazy-quotes for sloppy quoting and --trim-leading-space to drop
+padding. By default the header row is guessed from the first row; --header=yes
+or --header=no overrides the guess. --columns names the columns explicitly: the
+file is then read as having no header row, unless --header=yes is also given, in
+which case the header row is skipped and replaced.
 
 Schema Detection (default: enabled):
 When schema detection is enabled, the tool automatically analyzes the CSV file to:
 - Detect column names from headers
-- Infer data types (TEXT, INTEGER, REAL, DATETIME, BOOLEAN)
+- Infer data types (TEXT, INTEGER, REAL, DATETIME, BOOLEAN): a column takes
+  the first of BOOLEAN (true/false, yes/no, y/n), DATETIME, INTEGER and REAL
+  that at least 80% of its non-empty sampled values convert to, else TEXT;
+  INTEGER columns with decimal values become REAL. Columns whose values do not
+  all fit their type, and TEXT columns mostly of another type, are reported
 - Create appropriate indexes on commonly queried columns
+- Detect categorical TEXT columns: at least 50 sampled values that are words
+  taking at most 10 distinct values. The column is indexed and its values are
+  shown, but not enforced, as the rest of the input may hold others.
+  --enforce-categories turns the values into a CHECK constraint, rejecting
+  records with another value (see --on-error); a --schema file restricts a
+  column to a list of values with enum
+
+The sample is the first 1000 records of each file; --sample=file spreads it
+over the whole file instead, which reads files once more (standard input is
+always sampled from its head). --dry-run prints, for each column, the inferred
+type, the share of sampled values that fit it, the share of empty values and
+examples of values that do not fit, then exits without touching the database.
 
 Legacy Mode (--no-schema-detection):
 Uses the original fixed schema expecting columns: timestamp, username, operation, size
-- timestamp: UNIX timestamp
+- timestamp: UNIX timestamp or date (see Timestamps)
 - username: unique user identifier
 - operation: "upload" or "download"
 - size: file size in kB (integer)
 
 By default, loading data will replace any existing data in the specified table.
 Use the --append flag to add data to an existing table without clearing it.
+When appending, the detected columns are matched to the table's columns by
+name: new columns are added to the table, INTEGER columns receiving decimal
+values are widened to REAL and NOT NULL is dropped from columns with empty or
+missing values. Other type differences keep the table type. The changes are
+printed before the records are loaded.
+
+Duplicates (--force, --dedupe-key):
+In append mode, a file whose content (SHA-256 checksum) was already loaded into
+the table by a load that is still active is skipped, as is a file with the same
+content as an earlier file of the run; --force loads them anyway. Standard input
+is always loaded. --dedupe-key lists columns that identify a record: a unique
+index is created on them and records whose key is already in the table, or
+earlier in the load, are skipped. Later loads into the table use the same key;
+a load with a different --dedupe-key replaces it.
+Records with an empty key column are never duplicates. The number of files and
+records skipped is printed with the load summary.
+
+Each load runs in a single transaction: if any record fails, nothing is written
+and, in replace mode, the previous table is kept. Records are streamed and
+inserted --batch-size rows at a time, which bounds memory usage.
+
+Following a File (--follow):
+--follow loads the file and then keeps loading the lines appended to it, every
+--poll-interval, until interrupted. Only complete lines are loaded, and CSV
+records whose quoted fields span lines once they are complete; each poll is
+a transaction that also saves how far the file was read, so a restart resumes
+after the last line loaded and appends to the table instead of replacing it.
+A file rotated or truncated while stopped is loaded again from the start, still
+appending. When the file is rotated (renamed and recreated) the rest of the old file is
+loaded and the new file is followed; a file truncated in place is read again
+from the start. One CSV, access log or --pattern file can be followed at a time.
+
+Timestamps (--input-tz, --epoch-columns):
+Timestamps are accepted as UNIX seconds or milliseconds, RFC 3339, '2006-01-02
+15:04:05', '01/02/2006 15:04:05', '2006-01-02' or 'Mon Jan 2 15:04:05 MST 2006',
+with optional fractional seconds. They are stored in UTC as '2006-01-02
+15:04:05', which sorts as text and is read by SQLite's date and time functions,
+so date(timestamp) = '2020-04-15' selects a UTC day whatever the file's format.
+Timestamps without a zone are read in --input-tz (default UTC). --epoch-columns
+adds to the table a generated <column>_epoch INTEGER column holding the UNIX
+seconds of each timestamp column; it is kept by later loads.
+
+Validation Rules (--schema):
+The columns of a --schema file can declare the values they accept: enum (a list
+of allowed values), min and max (numbers), pattern (a regular expression),
+not_empty, and not_before and not_after (timestamps such as 2020-01-01). Every
+value is checked while loading and records that break a rule are rejected with
+the column and the reason (see --on-error). Except for patterns, the rules are
+also compiled into CHECK constraints of new tables. Empty values only fail
+not_empty. Without schema detection the schema file may only declare rules for
+the timestamp, username, operation and size columns.
+
+Error Handling (--on-error, --max-errors):
+By default the first bad record (wrong field count, unparseable value, constraint
+violation) aborts the load. With --on-error=skip bad records are skipped and written
+to a reject CSV together with their line number and the reason; a summary is printed
+at the end. --max-errors N aborts the load once more than N records are rejected.
 
 Examples:
   # Load with automatic schema detection
@@ -53,46 +177,374 @@ Examples:
   server-log-analyzer load --file errors.csv --table errors --append
 
   # Append to existing table
-  server-log-analyzer load --file new_data.csv --table logs --append`,
+  server-log-analyzer load --file new_data.csv --table logs --append
+
+  # Append today's export, skipping records that are already loaded
+  server-log-analyzer load --file export.csv --append --dedupe-key timestamp,username,operation,size
+
+  # Load a month of rotated logs in one run, reading 4 files at a time
+  server-log-analyzer load --file 'logs/server_log-2020-04-*.csv' --parallel 4
+
+  # Load every CSV file in a directory plus one more file
+  server-log-analyzer load --file logs/ --file extra.csv --append
+
+  # Load a tab-separated export whose header row is not recognised
+  server-log-analyzer load --file export.tsv --delimiter '\t' --header=yes
+
+  # Load a headerless, semicolon-separated file with explicit column names
+  server-log-analyzer load --file data.csv --delimiter ';' --columns ts,user,op,kb
+
+  # Load an Nginx access log
+  server-log-analyzer load --file /var/log/nginx/access.log --format combined --table access
+
+  # Load a custom application log with a grok-style pattern
+  server-log-analyzer load --file app.log --table app \
+    --pattern '^%{TIMESTAMP_ISO8601:time:timestamp} %{LOGLEVEL:level} %{GREEDYDATA:message}$'
+
+  # Keep loading the lines the server appends to its log
+  server-log-analyzer load --file server_log.csv --follow
+
+  # Load filtered records from a pipeline
+  zcat logs/*.gz | grep -v healthcheck | server-log-analyzer load --file - --table logs
+
+  # Check the inferred types of a large export before loading it
+  server-log-analyzer load --file export.csv --dry-run --sample file
+
+  # Start a schema file from the detected schema, edit it, then load with it
+  server-log-analyzer load --file customers.csv --dump-schema > schema.yaml
+  server-log-analyzer load --file customers.csv --schema schema.yaml
+
+  # Reject records with unknown operations or negative sizes
+  server-log-analyzer load --file server_log.csv --schema rules.yaml --on-error skip
+
+  # Load a log written in local time, with UNIX seconds alongside each timestamp
+  server-log-analyzer load --file server_log.csv --input-tz America/New_York --epoch-columns
+
+  # Load a rotated, gzip-compressed log
+  server-log-analyzer load --file server_log.csv.gz --append
+
+  # Skip up to 100 garbage lines, writing them to rejects.csv
+  server-log-analyzer load --file server_log.csv --max-errors 100 --reject-file rejects.csv`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runLoadCommand(csvFile, dbFile, tableName, appendMode, schemaDetection)
+			opts.stdin = cmd.InOrStdin()
+			opts.out = cmd.OutOrStdout()
+			opts.ctx = cmd.Context()
+			return runLoadCommand(opts)
 		},
 	}
 
 	// Define command flags
-	cmd.Flags().StringVarP(&csvFile, "file", "f", "", "Path to CSV log file (required)")
-	cmd.Flags().StringVarP(&dbFile, "db", "d", config.DefaultDatabaseFile, config.DatabaseFileDescription)
-	cmd.Flags().StringVarP(&tableName, "table", "t", config.DefaultTableName, config.TableNameDescription)
-	cmd.Flags().BoolVar(&appendMode, "append", false, "Append data to existing table (default: replace existing data)")
-	cmd.Flags().BoolVar(&schemaDetection, "schema-detection", true, config.SchemaDetectionDescription)
+	cmd.Flags().StringArrayVarP(&opts.files, "file", "f", nil, "Path, glob or directory of CSV log files; repeat to load several (required)")
+	cmd.Flags().BoolVar(&opts.appendMode, "append", false, "Append data to existing table (default: replace existing data)")
+	cmd.Flags().BoolVar(&opts.follow, "follow", false, "Keep loading the lines appended to the file until interrupted, across log rotation")
+	cmd.Flags().DurationVar(&opts.pollInterval, "poll-interval", time.Second, "How often --follow checks the file for new lines")
+	cmd.Flags().BoolVar(&opts.force, "force", false, "With --append, also load files whose content was already loaded into the table")
+	cmd.Flags().IntVar(&opts.parallel, "parallel", 1, "Number of files read and parsed concurrently")
+	cmd.Flags().StringVar(&opts.rejectFile, "reject-file", "", "CSV file for rejected records (default: <file>.rejected.csv, or <table>.rejected.csv for several files)")
+	cmd.Flags().BoolVar(&opts.dumpSchema, "dump-schema", false, "Print the detected schema as a --schema file and exit without loading")
+	cmd.Flags().BoolVar(&opts.dryRun, "dry-run", false, "Print the type inference report of the detected schema and exit without loading")
+	addRecordFlags(cmd, &opts)
 	cmd.MarkFlagRequired("file")
 
 	return cmd
 }
 
+// addRecordFlags defines the flags shared by the commands that load files:
+// the target table, how records are parsed and converted, and what happens
+// to bad and duplicate records
+func addRecordFlags(cmd *cobra.Command, opts *loadOptions) {
+	cmd.Flags().StringVarP(&opts.dbFile, "db", "d", config.DefaultDatabaseFile, config.DatabaseFileDescription)
+	cmd.Flags().StringVarP(&opts.tableName, "table", "t", config.DefaultTableName, config.TableNameDescription)
+	cmd.Flags().StringSliceVar(&opts.dedupeKey, "dedupe-key", nil, "Comma-separated columns identifying a record; records already in the table are skipped")
+	cmd.Flags().BoolVar(&opts.schemaDetection, "schema-detection", true, config.SchemaDetectionDescription)
+	cmd.Flags().StringVar(&opts.sample, "sample", sampleHead, "Records schema detection samples: the 'head' of each file or records spread over the whole 'file'")
+	cmd.Flags().BoolVar(&opts.enforceDomain, "enforce-categories", false, "Restrict categorical columns to the values seen in the sample with a CHECK constraint")
+	cmd.Flags().IntVar(&opts.batchSize, "batch-size", config.DefaultBatchSize, "Number of records read and inserted per batch")
+	cmd.Flags().StringVar(&opts.onError, "on-error", onErrorAbort, "What to do with a bad record: 'abort' the load or 'skip' it")
+	cmd.Flags().IntVar(&opts.maxErrors, "max-errors", 0, "Abort once more than N records are rejected (implies --on-error=skip, 0 = no limit)")
+	cmd.Flags().StringVar(&opts.format, "format", string(parser.FormatAuto), "Input format: 'csv', 'jsonl' (NDJSON), 'combined' or 'common' (Apache/Nginx access logs) or 'auto' to detect it per file")
+	cmd.Flags().StringVar(&opts.pattern, "pattern", "", "Regular expression whose named groups, or %{TOKEN:name[:type]} fields, become columns")
+	cmd.Flags().StringVar(&opts.patternFile, "pattern-file", "", "File of 'NAME expression' token definitions for --pattern")
+	cmd.Flags().StringVar(&opts.delimiter, "delimiter", ",", "Field delimiter, e.g. ';', '|' or '\\t' for tab-separated files")
+	cmd.Flags().StringVar(&opts.comment, "comment", "", "Skip lines starting with this character, e.g. '#'")
+	cmd.Flags().BoolVar(&opts.lazyQuotes, "lazy-quotes", false, "Accept stray and unescaped quotes in fields")
+	cmd.Flags().BoolVar(&opts.trimLeadingSpace, "trim-leading-space", false, "Ignore leading white space in fields")
+	cmd.Flags().StringVar(&opts.header, "header", string(parser.HeaderAuto), "Whether the first row is a header row: 'yes', 'no' or 'auto'")
+	cmd.Flags().StringSliceVar(&opts.columns, "columns", nil, "Comma-separated column names (replace the header row with --header=yes)")
+	cmd.Flags().StringVar(&opts.schemaFile, "schema", "", "YAML or JSON file overriding the detected type, nullability, index, name, default or CHECK of columns, or declaring validation rules")
+	cmd.Flags().StringVar(&opts.inputTZ, "input-tz", "UTC", "Time zone of timestamps without one, e.g. 'America/New_York' or 'Local'")
+	cmd.Flags().BoolVar(&opts.epochColumns, "epoch-columns", false, "Add a <column>_epoch column holding the UNIX seconds of each timestamp column")
+}
+
+// Values accepted by the --on-error flag
+const (
+	onErrorAbort = "abort"
+	onErrorSkip  = "skip"
+)
+
+// Values accepted by the --sample flag
+const (
+	sampleHead = "head"
+	sampleFile = "file"
+)
+
+// loadOptions holds the flags of the load command
+type loadOptions struct {
+	files           []string
+	dbFile          string
+	tableName       string
+	appendMode      bool
+	follow          bool
+	pollInterval    time.Duration
+	force           bool
+	dedupeKey       []string
+	schemaDetection bool
+	sample          string
+	batchSize       int
+	enforceDomain   bool // Restrict categorical columns to their detected values
+	parallel        int
+	onError         string
+	maxErrors       int
+	rejectFile      string
+	stdin           io.Reader // Read when a --file value is "-"
+	format          string
+	pattern         string
+	patternFile     string
+	schemaFile      string
+	dumpSchema      bool
+	dryRun          bool
+	inputTZ         string
+	location        *time.Location // Loaded from inputTZ by runLoadCommand
+	epochColumns    bool
+	out             io.Writer       // Receives the --dump-schema and --dry-run output
+	ctx             context.Context // Stops --follow when cancelled
+
+	// CSV dialect
+	delimiter        string
+	comment          string
+	lazyQuotes       bool
+	trimLeadingSpace bool
+	header           string
+	columns          []string
+}
+
+// validate checks the numeric and error handling flags
+func (o loadOptions) validate() error {
+	if o.batchSize <= 0 {
+		return fmt.Errorf("batch size must be a positive number, got %d", o.batchSize)
+	}
+
+	if o.parallel <= 0 {
+		return fmt.Errorf("parallel must be a positive number, got %d", o.parallel)
+	}
+
+	if o.onError != onErrorAbort && o.onError != onErrorSkip {
+		return fmt.Errorf("invalid --on-error value '%s': must be '%s' or '%s'", o.onError, onErrorAbort, onErrorSkip)
+	}
+
+	if o.maxErrors < 0 {
+		return fmt.Errorf("max errors cannot be negative, got %d", o.maxErrors)
+	}
+
+	if o.sample != sampleHead && o.sample != sampleFile {
+		return fmt.Errorf("invalid --sample value '%s': must be '%s' or '%s'", o.sample, sampleHead, sampleFile)
+	}
+
+	if _, err := time.LoadLocation(o.inputTZ); err != nil {
+		return fmt.Errorf("invalid --input-tz: %w", err)
+	}
+
+	return nil
+}
+
+// readOptions converts the input format flags into parser options
+func (o loadOptions) readOptions() (parser.ReadOptions, error) {
+	var readOpts parser.ReadOptions
+
+	format, err := parser.ParseInputFormat(o.format)
+	if err != nil {
+		return readOpts, err
+	}
+	readOpts.Format = format
+
+	if readOpts.CSV, err = o.csvOptions(); err != nil {
+		return readOpts, err
+	}
+
+	// A line pattern selects the pattern format
+	if o.pattern == "" {
+		if format == parser.FormatPattern {
+			return readOpts, fmt.Errorf("--format=pattern requires --pattern")
+		}
+		if o.patternFile != "" {
+			return readOpts, fmt.Errorf("--pattern-file requires --pattern")
+		}
+		return readOpts, nil
+	}
+	if format != parser.FormatAuto && format != parser.FormatPattern {
+		return readOpts, fmt.Errorf("--pattern cannot be combined with --format=%s", format)
+	}
+
+	var tokens map[string]string
+	if o.patternFile != "" {
+		if tokens, err = parser.LoadPatternTokens(o.patternFile); err != nil {
+			return readOpts, err
+		}
+	}
+	if readOpts.Pattern, err = parser.CompilePattern(o.pattern, tokens); err != nil {
+		return readOpts, err
+	}
+	readOpts.Format = parser.FormatPattern
+
+	return readOpts, nil
+}
+
+// csvOptions converts the CSV dialect flags into parser options
+func (o loadOptions) csvOptions() (parser.CSVOptions, error) {
+	csvOpts := parser.CSVOptions{
+		LazyQuotes:       o.lazyQuotes,
+		TrimLeadingSpace: o.trimLeadingSpace,
+		Columns:          o.columns,
+	}
+
+	var err error
+	if csvOpts.Delimiter, err = parseDialectRune("delimiter", o.delimiter); err != nil {
+		return csvOpts, err
+	}
+	if csvOpts.Comment, err = parseDialectRune("comment", o.comment); err != nil {
+		return csvOpts, err
+	}
+
+	// An explicit --header wins; otherwise --columns implies there is no header row
+	if o.header != string(parser.HeaderAuto) || len(o.columns) == 0 {
+		if csvOpts.Header, err = parser.ParseHeaderMode(o.header); err != nil {
+			return csvOpts, err
+		}
+	}
+
+	return csvOpts, csvOpts.Validate()
+}
+
+// parseDialectRune converts a --delimiter or --comment value into a single character
+// Tabs can be given as "\t" or "tab" since they are awkward to type in a shell
+func parseDialectRune(flag, value string) (rune, error) {
+	switch value {
+	case "":
+		return 0, nil
+	case `\t`, "tab":
+		return '\t', nil
+	}
+
+	if utf8.RuneCountInString(value) != 1 {
+		return 0, fmt.Errorf("invalid --%s value '%s': must be a single character", flag, value)
+	}
+	r, _ := utf8.DecodeRuneInString(value)
+	return r, nil
+}
+
 // runLoadCommand executes the CSV loading logic with support for dynamic schema detection
-func runLoadCommand(csvFile, dbFile, tableName string, appendMode, schemaDetection bool) error {
-	// Validate input file exists
-	if _, err := os.Stat(csvFile); os.IsNotExist(err) {
-		return fmt.Errorf("CSV file does not exist: %s", csvFile)
+func runLoadCommand(opts loadOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+	opts.location, _ = time.LoadLocation(opts.inputTZ)
+
+	readOpts, err := opts.readOptions()
+	if err != nil {
+		return err
+	}
+
+	// The dump and the dry run show the detected schema, so they need
+	// detection; without it the schema file may only add validation rules to
+	// the legacy columns
+	var override *parser.SchemaOverride
+	if opts.dumpSchema && !opts.schemaDetection {
+		return fmt.Errorf("--dump-schema cannot be used with --schema-detection=false")
+	}
+	if opts.dryRun && !opts.schemaDetection {
+		return fmt.Errorf("--dry-run cannot be used with --schema-detection=false")
+	}
+	if opts.enforceDomain && !opts.schemaDetection {
+		return fmt.Errorf("--enforce-categories cannot be used with --schema-detection=false")
+	}
+	if opts.dryRun && (opts.dumpSchema || opts.follow) {
+		return fmt.Errorf("--dry-run cannot be used with --dump-schema or --follow")
+	}
+	if opts.schemaFile != "" {
+		if override, err = parser.LoadSchemaOverride(opts.schemaFile); err != nil {
+			return err
+		}
+	}
+	legacy := legacySchema(opts.tableName)
+	if !opts.schemaDetection && override != nil {
+		if legacy, err = applyLegacyRules(legacy, override); err != nil {
+			return err
+		}
+	}
+
+	// Resolve paths, globs and directories into the files to load
+	files, err := expandInputFiles(opts.files)
+	if err != nil {
+		return err
+	}
+
+	if opts.dumpSchema {
+		return dumpDetectedSchema(opts, readOpts, files, override)
+	}
+	if opts.dryRun {
+		return dryRunLoad(opts, readOpts, files, override)
+	}
+
+	if opts.follow {
+		if err := checkFollowable(opts, files); err != nil {
+			return err
+		}
 	}
 
 	// Check if database exists when in append mode
 	dbExists := true
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+	if _, err := os.Stat(opts.dbFile); os.IsNotExist(err) {
 		dbExists = false
-		if appendMode {
-			fmt.Printf("Warning: Database file does not exist: %s\n", dbFile)
+		if opts.appendMode {
+			fmt.Printf("Warning: Database file does not exist: %s\n", opts.dbFile)
 			fmt.Printf("A new database will be created.\n")
 		}
 	}
 
-	fmt.Printf("Loading CSV file: %s\n", csvFile)
-	fmt.Printf("Target database: %s\n", dbFile)
-	fmt.Printf("Target table: %s\n", tableName)
-	fmt.Printf("Schema detection: %t\n", schemaDetection)
+	src := newInputSource(opts.stdin, readOpts)
+	defer src.Close()
 
-	if appendMode {
+	// Appending a file twice would count its records twice; a followed
+	// file resumes from its saved offset instead
+	if opts.appendMode && dbExists && !opts.force && !opts.follow {
+		loaded := len(files)
+		if files, err = skipLoadedFiles(opts, src, files); err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			fmt.Printf("Nothing to load: every file has already been loaded into table '%s' (use --force to load them again)\n", opts.tableName)
+			return nil
+		}
+		if skipped := loaded - len(files); skipped > 0 {
+			fmt.Printf("Skipped %d of %d files already loaded into table '%s'\n", skipped, loaded, opts.tableName)
+		}
+	}
+
+	if len(files) == 1 && files[0] == stdinFile {
+		fmt.Printf("Loading from standard input\n")
+	} else if len(files) == 1 {
+		fmt.Printf("Loading file: %s\n", files[0])
+	} else {
+		fmt.Printf("Loading %d files:\n", len(files))
+		for _, file := range files {
+			fmt.Printf("  %s\n", file)
+		}
+	}
+	fmt.Printf("Target database: %s\n", opts.dbFile)
+	fmt.Printf("Target table: %s\n", opts.tableName)
+	fmt.Printf("Schema detection: %t\n", opts.schemaDetection)
+
+	if opts.appendMode {
 		if dbExists {
 			fmt.Printf("Mode: Append to existing table\n")
 		} else {
@@ -102,86 +554,542 @@ func runLoadCommand(csvFile, dbFile, tableName string, appendMode, schemaDetecti
 		fmt.Printf("Mode: Replace existing data\n")
 	}
 
-	var db database.DB
-	var err error
+	// Setting a limit on rejected records implies skipping them
+	skip := opts.onError == onErrorSkip || opts.maxErrors > 0
+	rejectFile := opts.rejectFile
+	if rejectFile == "" {
+		if len(files) == 1 && files[0] != stdinFile {
+			// The reject file is plain CSV even when the input is compressed
+			rejectFile = parser.TrimCompressionExtension(files[0]) + ".rejected.csv"
+		} else {
+			rejectFile = opts.tableName + ".rejected.csv"
+		}
+	}
+	rejects := newRejectLog(skip, opts.maxErrors, rejectFile)
+	defer rejects.Close()
+
+	if opts.follow {
+		err = followFile(opts, src, files[0], rejects, override)
+	} else if opts.schemaDetection {
+		err = loadWithSchemaDetection(opts, src, files, rejects, override)
+	} else {
+		err = loadWithLegacySchema(opts, src, files, rejects, legacy)
+	}
+
+	if rejects.Count() > 0 {
+		rejects.PrintSummary()
+	}
+
+	return err
+}
+
+// skipLoadedFiles leaves out the files whose content an active load batch
+// already loaded into the table, and files with the same content as a file
+// before them. Standard input is kept: its checksum is only known once read
+func skipLoadedFiles(opts loadOptions, src *inputSource, files []string) ([]string, error) {
+	db, err := database.Initialize(opts.dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	seen := make(map[string]string, len(files)) // Checksum to the first file with it
+	kept := make([]string, 0, len(files))
+	for _, file := range files {
+		if file == stdinFile {
+			kept = append(kept, file)
+			continue
+		}
+
+		checksum, _, err := src.checksum(file)
+		if err != nil {
+			return nil, err
+		}
+		if first, ok := seen[checksum]; ok {
+			fmt.Printf("Skipping %s: same content as %s\n", file, first)
+			continue
+		}
+		seen[checksum] = file
 
-	if schemaDetection {
-		// Parse CSV for schema detection
-		headers, records, err := parser.ParseCSVRaw(csvFile)
+		batchID, err := database.FindLoadedFile(db, opts.tableName, checksum)
 		if err != nil {
-			return fmt.Errorf("failed to parse CSV file: %w", err)
+			return nil, err
 		}
+		if batchID != 0 {
+			fmt.Printf("Skipping %s: already loaded into table '%s' by load batch %d\n", file, opts.tableName, batchID)
+			continue
+		}
+		kept = append(kept, file)
+	}
+	return kept, nil
+}
+
+// loadWithSchemaDetection detects the schema from a sample of each file and
+// streams every record into a table built from the reconciled schema
+func loadWithSchemaDetection(opts loadOptions, src *inputSource, files []string, rejects *rejectLog, override *parser.SchemaOverride) error {
+	schema, fileSchemas, sampled, err := detectFileSchemas(src, files, opts, rejects, override)
+	if err != nil {
+		return err
+	}
+
+	// Print detected schema for user confirmation
+	printDetectedSchema(schema, sampled)
 
-		if len(records) == 0 {
-			return fmt.Errorf("no data found in CSV file")
+	// Initialize database connection
+	db, err := database.Initialize(opts.dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// Create the table and insert every record in one transaction so a
+	// failure part-way through leaves the database untouched; in replace
+	// mode this includes the table that was dropped
+	var count, duplicates, batchID int64
+	var dedupeKey []string
+	rows := make(map[string]int64, len(files))
+	err = database.WithTransaction(db, func(tx database.Executor) error {
+		if err := prepareTable(tx, opts, schema, fileSchemas); err != nil {
+			return err
 		}
 
-		// Detect schema from CSV data
-		schema, err := parser.DetectSchema(headers, records, tableName)
+		// Record the load so every row can be traced back to it
+		var err error
+		if batchID, err = beginLoadBatch(tx, opts, schema); err != nil {
+			return err
+		}
+		insertOpts, err := insertOptions(tx, opts, batchID)
 		if err != nil {
-			return fmt.Errorf("failed to detect schema: %w", err)
+			return err
 		}
+		dedupeKey = insertOpts.DedupeKey
 
-		// Print detected schema for user confirmation
-		printDetectedSchema(schema, len(records))
+		// Stream every file; each batch is converted using its file's column order
+		err = streamFiles(src, files, opts.batchSize, opts.parallel, rejects, func(batch recordBatch) error {
+			fileSchema := fileSchemas[batch.file]
+			inserted, rejected, err := database.InsertRecordsSkippingErrors(tx, opts.tableName, fileSchema.ColumnNames(), batch.records, fileSchema, insertOpts)
+			count += inserted
+			rows[batch.file] += inserted
+			if err != nil {
+				return fmt.Errorf("failed to insert records: %w", err)
+			}
+			duplicates += int64(len(batch.records)-len(rejected)) - inserted
+			for _, r := range rejected {
+				if err := rejects.Reject(batch.file, batch.lines[r.Index], r.Record, r.Err); err != nil {
+					return fmt.Errorf("failed to insert records: %w", err)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 
-		// Initialize database connection
-		db, err = database.Initialize(dbFile)
+		return finishLoadBatch(tx, src, batchID, files, rows, rejects)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Successfully loaded %d records into table '%s' (load batch %d)\n", count, opts.tableName, batchID)
+	printDuplicates(dedupeKey, duplicates)
+	return nil
+}
+
+// prepareTable creates the table for the detected schema, dropping it first in
+// replace mode. Append mode adapts an existing table to the detected columns
+// and converts values to the types of the table columns
+func prepareTable(tx database.Executor, opts loadOptions, schema *parser.TableSchema, fileSchemas map[string]*parser.TableSchema) error {
+	if opts.appendMode {
+		table, changes, err := database.EvolveTable(tx, schema)
 		if err != nil {
-			return fmt.Errorf("failed to initialize database: %w", err)
+			return fmt.Errorf("failed to update table schema: %w", err)
 		}
-		defer db.Close()
+		if table != nil {
+			printSchemaChanges(opts.tableName, changes)
+			types := make(map[string]parser.ColumnType, len(table.Columns))
+			for _, col := range table.Columns {
+				types[col.Name] = col.Type
+			}
+			schema.ApplyColumnTypes(types)
+			for _, fileSchema := range fileSchemas {
+				fileSchema.ApplyColumnTypes(types)
+			}
+		}
+	}
 
-		// Create table from schema (skip in append mode to preserve existing structure)
-		if !appendMode {
-			if err := database.CreateTableFromSchema(db, schema, true); err != nil {
-				return fmt.Errorf("failed to create table: %w", err)
+	// Replace mode drops the existing table; append mode only creates it if missing
+	if err := database.CreateTableFromSchema(tx, schema, !opts.appendMode); err != nil {
+		return fmt.Errorf("failed to create table: %w", err)
+	}
+	return ensureEpochColumns(tx, opts, schema)
+}
+
+// ensureEpochColumns adds the --epoch-columns of the table's timestamp columns
+func ensureEpochColumns(tx database.Executor, opts loadOptions, schema *parser.TableSchema) error {
+	if !opts.epochColumns {
+		return nil
+	}
+	added, err := database.EnsureEpochColumns(tx, schema)
+	if err != nil {
+		return err
+	}
+	if len(added) > 0 {
+		fmt.Printf("Added epoch columns: %s\n", strings.Join(added, ", "))
+	}
+	return nil
+}
+
+// beginLoadBatch records the start of the load in the load history and makes
+// sure the table has the column that ties each row to its load batch
+func beginLoadBatch(tx database.Executor, opts loadOptions, schema *parser.TableSchema) (int64, error) {
+	if err := database.EnsureBatchColumn(tx, opts.tableName); err != nil {
+		return 0, err
+	}
+
+	mode := "replace"
+	if opts.appendMode {
+		mode = "append"
+	}
+	return database.BeginLoadBatch(tx, opts.tableName, mode, schema.GenerateCreateTableSQL())
+}
+
+// insertOptions returns how the records of the load batch are inserted, creating
+// the unique index of the --dedupe-key columns if the table does not have it yet
+// Without --dedupe-key, the key given to an earlier load of the table is used;
+// a different --dedupe-key replaces it
+func insertOptions(tx database.Executor, opts loadOptions, batchID int64) (database.InsertOptions, error) {
+	insertOpts := database.InsertOptions{BatchID: batchID, DedupeKey: opts.dedupeKey, Location: opts.location}
+	if len(opts.dedupeKey) == 0 {
+		var err error
+		insertOpts.DedupeKey, err = database.DedupeKey(tx, opts.tableName)
+		return insertOpts, err
+	}
+
+	replaced, err := database.EnsureDedupeKey(tx, opts.tableName, opts.dedupeKey)
+	if err != nil {
+		return insertOpts, fmt.Errorf("invalid --dedupe-key: %w", err)
+	}
+	if len(replaced) > 0 {
+		fmt.Printf("Replaced dedupe key %s of table '%s' with %s\n", strings.Join(replaced, ", "), opts.tableName, strings.Join(opts.dedupeKey, ", "))
+	}
+	return insertOpts, nil
+}
+
+// printDuplicates reports the records skipped because of the dedupe key
+func printDuplicates(key []string, duplicates int64) {
+	if len(key) > 0 {
+		fmt.Printf("Skipped %d duplicate records (dedupe key: %s)\n", duplicates, strings.Join(key, ", "))
+	}
+}
+
+// finishLoadBatch records the row counts and the size and checksum of every
+// input file of the load batch
+func finishLoadBatch(tx database.Executor, src *inputSource, batchID int64, files []string, rows map[string]int64, rejects *rejectLog) error {
+	batchFiles := make([]database.LoadBatchFile, 0, len(files))
+	var total int64
+	for _, file := range files {
+		checksum, size, err := src.checksum(file)
+		if err != nil {
+			return err
+		}
+
+		path := file
+		if file != stdinFile {
+			if abs, err := filepath.Abs(file); err == nil {
+				path = abs
 			}
+		}
+
+		batchFiles = append(batchFiles, database.LoadBatchFile{Path: path, Size: size, Checksum: checksum, RowCount: rows[file]})
+		total += rows[file]
+	}
+
+	return database.FinishLoadBatch(tx, batchID, total, int64(rejects.Count()), batchFiles)
+}
+
+// detectFileSchemas detects the schema of every file from a sample of its rows
+// and reconciles them into one table schema. It also returns, for each file,
+// the schema with columns in that file's order and the number of rows sampled
+// Files without data rows are skipped; they contribute nothing to the load
+// Inputs that cannot be reopened, like standard input, are kept open in src
+// together with their sample so that streamFiles continues where sampling stopped
+// With wholeFile the sample of a file that can be reopened is spread over all
+// of its records instead of being its first records
+// A non-nil override is applied to the reconciled schema
+func detectFileSchemas(src *inputSource, files []string, opts loadOptions, rejects *rejectLog, override *parser.SchemaOverride) (*parser.TableSchema, map[string]*parser.TableSchema, int, error) {
+	tableName, wholeFile := opts.tableName, opts.sample == sampleFile
+	var schema *parser.TableSchema
+	headersByFile := make(map[string][]string)
+	sampled := 0
+
+	for _, file := range files {
+		reader, err := src.open(file)
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to parse CSV file %s: %w", file, err)
+		}
+
+		// Read the sample used for schema detection; malformed lines are
+		// ignored here and reported when the file is read again to be loaded
+		var sampleRejects *rejectLog
+		if !src.reopenable(file) {
+			sampleRejects = rejects
+		}
+		sample, lines, err := readBatch(reader, file, config.SchemaDetectionSampleSize, sampleRejects)
+		if _, fixed := reader.(parser.SchemaProvider); err == nil && wholeFile && !fixed && src.reopenable(file) {
+			err = sampleWholeFile(reader, file, sample)
+		}
+		if src.reopenable(file) || err != nil {
+			reader.Close()
 		} else {
-			// In append mode, create table if it doesn't exist, but don't drop it
-			if err := database.CreateTableFromSchema(db, schema, false); err != nil {
-				return fmt.Errorf("failed to create table: %w", err)
+			src.keep(file, reader, sample, lines)
+		}
+		if err == io.EOF {
+			if len(files) > 1 {
+				fmt.Printf("Warning: no data found in CSV file %s\n", file)
 			}
+			continue
+		}
+		if err != nil {
+			return nil, nil, 0, fmt.Errorf("failed to parse CSV file %s: %w", file, err)
 		}
 
-		// Insert records using dynamic schema
-		count, err := database.InsertRecords(db, tableName, headers, records, schema)
+		// Detect schema from the sample rows, unless the format defines it
+		var detected *parser.TableSchema
+		if provider, ok := reader.(parser.SchemaProvider); ok {
+			detected, err = provider.Schema(tableName)
+		} else {
+			detected, err = parser.DetectSchema(reader.Headers(), sample, tableName)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to insert records: %w", err)
+			return nil, nil, 0, fmt.Errorf("failed to detect schema of %s: %w", file, err)
+		}
+		if declarer, ok := reader.(parser.TypeDeclarer); ok {
+			detected.ApplyColumnTypes(declarer.DeclaredTypes())
 		}
 
-		fmt.Printf("Successfully loaded %d records into table '%s'\n", count, tableName)
-	} else {
-		// Legacy mode - use fixed schema
-		fmt.Printf("Using legacy schema mode\n")
+		// Reconcile with the files seen so far
+		if schema == nil {
+			schema = detected
+		} else if schema, err = parser.MergeSchemas(schema, detected); err != nil {
+			return nil, nil, 0, fmt.Errorf("schema of %s does not match %s: %w", file, files[0], err)
+		}
 
-		// Initialize database connection with legacy schema
-		db, err = database.InitializeWithLegacySchema(dbFile)
+		headersByFile[file] = reader.Headers()
+		sampled += len(sample)
+	}
+
+	if schema == nil {
+		return nil, nil, 0, fmt.Errorf("no data found in CSV file")
+	}
+
+	if override != nil {
+		var err error
+		if schema, err = override.Apply(schema); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	if opts.enforceDomain {
+		schema.EnforceCategories()
+	}
+
+	// Map the reconciled schema onto each file's column order
+	fileSchemas := make(map[string]*parser.TableSchema, len(headersByFile))
+	for file, headers := range headersByFile {
+		fileSchema, err := schema.ForHeaders(headers)
 		if err != nil {
-			return fmt.Errorf("failed to initialize database: %w", err)
+			return nil, nil, 0, fmt.Errorf("schema of %s does not match: %w", file, err)
 		}
-		defer db.Close()
+		fileSchemas[file] = fileSchema
+	}
 
-		// Parse CSV file using legacy parser
-		entries, err := parser.ParseCSV(csvFile)
+	return schema, fileSchemas, sampled, nil
+}
+
+// dumpDetectedSchema writes the detected schema, with any override applied,
+// to opts.out in the --schema file format without loading anything
+func dumpDetectedSchema(opts loadOptions, readOpts parser.ReadOptions, files []string, override *parser.SchemaOverride) error {
+	src := newInputSource(opts.stdin, readOpts)
+	defer src.Close()
+
+	// Malformed sample lines are ignored, as they are during a load
+	schema, _, _, err := detectFileSchemas(src, files, opts, nil, override)
+	if err != nil {
+		return err
+	}
+
+	return parser.NewSchemaOverride(schema).WriteYAML(opts.out, opts.tableName)
+}
+
+// dryRunLoad writes the type inference report of the detected schema, with
+// any override applied, to opts.out without touching the database
+func dryRunLoad(opts loadOptions, readOpts parser.ReadOptions, files []string, override *parser.SchemaOverride) error {
+	src := newInputSource(opts.stdin, readOpts)
+	defer src.Close()
+
+	schema, _, sampled, err := detectFileSchemas(src, files, opts, nil, override)
+	if err != nil {
+		return err
+	}
+
+	writeInferenceReport(opts.out, schema, sampled, opts.sample)
+	fmt.Fprintf(opts.out, "Dry run: nothing was loaded into %s\n", opts.dbFile)
+	return nil
+}
+
+// loadWithLegacySchema loads the files into the fixed timestamp, username,
+// operation, size schema, validating each record with the legacy parser and
+// the validation rules of the schema's columns
+func loadWithLegacySchema(opts loadOptions, src *inputSource, files []string, rejects *rejectLog, schema *parser.TableSchema) error {
+	// Legacy mode - use fixed schema
+	fmt.Printf("Using legacy schema mode\n")
+
+	// Initialize database connection with legacy schema
+	db, err := database.InitializeWithLegacySchema(opts.dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	// Parse entries record by record and insert them one batch at a time,
+	// all inside one transaction so a bad line leaves the table untouched
+	// Replace mode clears the table first; a load without a single valid entry
+	// is rolled back, so it neither clears the table nor records a load batch
+	var count, duplicates, batchID int64
+	var dedupeKey []string
+	parsed := 0
+	rows := make(map[string]int64, len(files))
+	err = database.WithTransaction(db, func(tx database.Executor) error {
+		var err error
+		if batchID, err = beginLoadBatch(tx, opts, schema); err != nil {
+			return err
+		}
+		if err := ensureEpochColumns(tx, opts, schema); err != nil {
+			return err
+		}
+		insertOpts, err := insertOptions(tx, opts, batchID)
 		if err != nil {
-			return fmt.Errorf("failed to parse CSV file: %w", err)
+			return err
+		}
+		dedupeKey = insertOpts.DedupeKey
+		if !opts.appendMode {
+			if err := database.ClearTable(tx, opts.tableName); err != nil {
+				return err
+			}
 		}
 
-		fmt.Printf("Parsed %d log entries\n", len(entries))
+		entries := make([]models.LogEntry, 0, opts.batchSize)
+		err = streamFiles(src, files, opts.batchSize, opts.parallel, rejects, func(batch recordBatch) error {
+			entries = entries[:0]
+			order := legacyFieldOrder(batch.headers)
+			for i, record := range batch.records {
+				if order != nil && len(record) == len(batch.headers) {
+					record = []string{record[order[0]], record[order[1]], record[order[2]], record[order[3]]}
+				}
+				entry, err := parser.ParseLogEntry(record, opts.location)
+				if err == nil {
+					err = validateLegacyEntry(schema, record, entry)
+				}
+				if err != nil {
+					if err := rejects.Reject(batch.file, batch.lines[i], record, err); err != nil {
+						return fmt.Errorf("failed to parse CSV file: %w", err)
+					}
+					continue
+				}
+				entries = append(entries, entry)
+			}
 
-		// Insert entries into database using legacy method
-		count, err := database.InsertLogEntries(db, entries, appendMode, tableName)
+			inserted, err := database.InsertLogEntries(tx, entries, true, opts.tableName, insertOpts)
+			count += inserted
+			rows[batch.file] += inserted
+			parsed += len(entries)
+			if err != nil {
+				return fmt.Errorf("failed to insert log entries: %w", err)
+			}
+			duplicates += int64(len(entries)) - inserted
+			return nil
+		})
 		if err != nil {
-			return fmt.Errorf("failed to insert log entries: %w", err)
+			return err
+		}
+		if parsed == 0 {
+			return fmt.Errorf("failed to parse CSV file: no valid log entries found in CSV file")
 		}
 
-		fmt.Printf("Successfully loaded %d entries into table '%s'\n", count, tableName)
+		return finishLoadBatch(tx, src, batchID, files, rows, rejects)
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Parsed %d log entries\n", parsed)
+	fmt.Printf("Successfully loaded %d entries into table '%s' (load batch %d)\n", count, opts.tableName, batchID)
+	printDuplicates(dedupeKey, duplicates)
+	return nil
+}
+
+// legacySchema describes the fixed legacy columns, as recorded in the load history
+func legacySchema(tableName string) *parser.TableSchema {
+	return &parser.TableSchema{
+		Name: tableName,
+		Columns: []parser.ColumnSchema{
+			{Name: "timestamp", Type: parser.TypeTimestamp, Index: true},
+			{Name: "username", Type: parser.TypeText, Index: true},
+			{Name: "operation", Type: parser.TypeText, Index: true},
+			{Name: "size", Type: parser.TypeInteger, Index: true},
+		},
 	}
+}
 
+// applyLegacyRules adds the validation rules of a schema file to the legacy
+// columns. The legacy table is fixed, so the file cannot change anything else
+func applyLegacyRules(schema *parser.TableSchema, override *parser.SchemaOverride) (*parser.TableSchema, error) {
+	for _, col := range override.Columns {
+		if col.Type != "" || col.Nullable != nil || col.Index != nil || col.Rename != "" || col.Default != nil || col.Check != "" {
+			return nil, fmt.Errorf("schema file: column '%s': only validation rules can be set with --schema-detection=false", col.Name)
+		}
+	}
+	return override.Apply(schema)
+}
+
+// validateLegacyEntry checks a parsed entry against the validation rules of the legacy columns
+func validateLegacyEntry(schema *parser.TableSchema, record []string, entry models.LogEntry) error {
+	values := []interface{}{entry.Timestamp, entry.Username, entry.Operation, entry.Size}
+	for i, col := range schema.Columns {
+		if col.Rules == nil {
+			continue
+		}
+		if err := col.Rules.Validate(record[i], values[i]); err != nil {
+			return fmt.Errorf("column '%s': %w", col.Name, err)
+		}
+	}
 	return nil
 }
 
+// legacyFieldOrder returns the positions of the timestamp, username, operation
+// and size columns when the headers name all four, as JSON Lines keys do
+// It returns nil for anything else so the fields are taken in file order
+func legacyFieldOrder(headers []string) []int {
+	order := make([]int, 4)
+	for i, name := range []string{"timestamp", "username", "operation", "size"} {
+		pos := -1
+		for j, header := range headers {
+			if strings.EqualFold(strings.TrimSpace(header), name) {
+				pos = j
+			}
+		}
+		if pos < 0 {
+			return nil
+		}
+		order[i] = pos
+	}
+	return order
+}
+
 // printDetectedSchema displays the detected schema information to the user
 func printDetectedSchema(schema *parser.TableSchema, recordCount int) {
 	fmt.Printf("\nDetected schema for table '%s' (analyzed %d records):\n", schema.Name, recordCount)
@@ -198,6 +1106,125 @@ func printDetectedSchema(schema *parser.TableSchema, recordCount int) {
 			truncateString(col.Name, 23), col.Type.SQLType(), indexed)
 	}
 	fmt.Println("└─────────────────────────┴─────────────┴─────────┘")
+	for _, note := range categoryNotes(schema) {
+		fmt.Println(note)
+	}
+	for _, note := range inferenceNotes(schema) {
+		fmt.Printf("Warning: %s\n", note)
+	}
+	fmt.Println()
+}
+
+// categoryNotes lists the values of the categorical columns. Values declared
+// with enum are enforced; detected values only describe the sample, since the
+// rest of the input may hold others
+func categoryNotes(schema *parser.TableSchema) []string {
+	var notes []string
+	for _, col := range schema.Columns {
+		values := col.Categories()
+		if len(values) == 0 {
+			continue
+		}
+		source := "seen in the sample"
+		if col.EnforcesCategories() {
+			source = "enforced"
+		}
+		notes = append(notes, fmt.Sprintf("Values of %s (%s): %s", col.Name, source, strings.Join(values, ", ")))
+	}
+	return notes
+}
+
+// nearMissConfidence is the share of values of another type above which a
+// column inferred as TEXT is reported, since it may hold mistyped values
+const nearMissConfidence = 0.5
+
+// writeInferenceReport writes how the type of each column was inferred: the
+// share of sampled values that fit the type, the share of empty values and
+// examples of values that do not fit, followed by the inference notes
+func writeInferenceReport(w io.Writer, schema *parser.TableSchema, recordCount int, sample string) {
+	where := "the head of each file"
+	if sample == sampleFile {
+		where = "the whole of each file"
+	}
+	fmt.Fprintf(w, "Type inference for table '%s' (analyzed %d records from %s):\n", schema.Name, recordCount, where)
+	fmt.Fprintln(w, "┌─────────────────────────┬─────────────┬────────────┬────────┬────────────────────────────────┐")
+	fmt.Fprintln(w, "│ Column                  │ Type        │ Confidence │ Nulls  │ Non-conforming examples        │")
+	fmt.Fprintln(w, "├─────────────────────────┼─────────────┼────────────┼────────┼────────────────────────────────┤")
+
+	for _, col := range schema.Columns {
+		confidence, nulls, examples := "declared", "", ""
+		if ci := col.Inference; ci != nil {
+			confidence = "-" // Every value fits TEXT
+			if col.Type != parser.TypeText {
+				confidence = formatPercent(ci.Confidence(col.Type))
+			}
+			nulls = formatPercent(ci.NullRatio())
+			examples = quoteValues(ci.Examples(col.Type))
+		}
+		fmt.Fprintf(w, "│ %-23s │ %-11s │ %10s │ %6s │ %-30s │\n",
+			truncateString(col.Name, 23), col.Type.SQLType(), confidence, nulls, truncateString(examples, 30))
+	}
+	fmt.Fprintln(w, "└─────────────────────────┴─────────────┴────────────┴────────┴────────────────────────────────┘")
+	for _, note := range categoryNotes(schema) {
+		fmt.Fprintln(w, note)
+	}
+	for _, note := range inferenceNotes(schema) {
+		fmt.Fprintf(w, "Warning: %s\n", note)
+	}
+	fmt.Fprintln(w)
+}
+
+// inferenceNotes describes the columns whose inferred type does not fit every
+// sampled value, whose records would be rejected, and the TEXT columns most of
+// whose values are of another type
+func inferenceNotes(schema *parser.TableSchema) []string {
+	var notes []string
+	for _, col := range schema.Columns {
+		ci := col.Inference
+		if ci == nil {
+			continue
+		}
+		if col.Type != parser.TypeText {
+			if misfits := ci.NonEmpty() - ci.Fits(col.Type); misfits > 0 {
+				notes = append(notes, fmt.Sprintf("%d of %d sampled values of %s are not %s (e.g. %s); records with such values will be rejected",
+					misfits, ci.NonEmpty(), col.Name, col.Type, quoteValues(ci.Examples(col.Type))))
+			}
+			continue
+		}
+		if candidate, ok := ci.Candidate(); ok && ci.Confidence(candidate) >= nearMissConfidence {
+			notes = append(notes, fmt.Sprintf("%s is TEXT: %s of its sampled values are %s, below the %s needed (others: %s)",
+				col.Name, formatPercent(ci.Confidence(candidate)), candidate, formatPercent(config.TypeInferenceThreshold),
+				quoteValues(ci.Examples(candidate))))
+		}
+	}
+	return notes
+}
+
+// formatPercent formats a share as a percentage with one decimal
+func formatPercent(share float64) string {
+	return fmt.Sprintf("%.1f%%", share*100)
+}
+
+// quoteValues joins values in single quotes
+func quoteValues(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = "'" + value + "'"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// printSchemaChanges reports how an existing table was adapted for an append
+func printSchemaChanges(tableName string, changes []parser.SchemaChange) {
+	if len(changes) == 0 {
+		fmt.Printf("Existing table '%s' matches the detected schema\n\n", tableName)
+		return
+	}
+
+	fmt.Printf("Schema changes for existing table '%s':\n", tableName)
+	for _, change := range changes {
+		fmt.Printf("  %s\n", change)
+	}
 	fmt.Println()
 }
 
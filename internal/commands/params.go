@@ -0,0 +1,149 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// parseParams reads --param values given as name=value into a map
+// A value may hold any character, including '=' and ','
+func parseParams(params []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, param := range params {
+		name, value, ok := strings.Cut(param, "=")
+		name = strings.TrimPrefix(strings.TrimSpace(name), ":")
+		if !ok || !isParamName(name) {
+			return nil, fmt.Errorf("invalid --param '%s': expected name=value, where the name is letters, digits and underscores", param)
+		}
+		if _, ok := values[name]; ok {
+			return nil, fmt.Errorf("parameter '%s' is given more than once", name)
+		}
+		values[name] = value
+	}
+	return values, nil
+}
+
+// isParamName reports whether the name can follow ':' in a query
+func isParamName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if !isParamRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isParamRune reports whether the rune can be part of a parameter name
+func isParamRune(r rune) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// queryParams returns the names of the :name parameters of a query, in order
+// of first use. A ':' inside a string literal, a quoted identifier or a
+// comment does not start a parameter
+func queryParams(query string) []string {
+	var names []string
+	seen := make(map[string]bool)
+
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\'' || r == '"' || r == '`':
+			// Skip to the closing quote; doubled quotes stay inside
+			for i++; i < len(runes) && runes[i] != r; i++ {
+			}
+		case r == '[':
+			for i++; i < len(runes) && runes[i] != ']'; i++ {
+			}
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i++; i < len(runes) && runes[i] != '\n'; i++ {
+			}
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			for i += 2; i < len(runes) && !(runes[i] == '*' && i+1 < len(runes) && runes[i+1] == '/'); i++ {
+			}
+			i++
+		case r == ':' && i+1 < len(runes) && isParamRune(runes[i+1]):
+			start := i + 1
+			for i = start; i+1 < len(runes) && isParamRune(runes[i+1]); i++ {
+			}
+			name := string(runes[start : i+1])
+			if isParamName(name) && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// bindParams returns the arguments binding the :name parameters of a query
+// to the values given. Every parameter needs a value, and every value must be
+// used, so a misspelt name is reported rather than ignored
+// Values written as numbers are bound as numbers, see paramValue
+func bindParams(query string, values map[string]string) ([]interface{}, error) {
+	names := queryParams(query)
+
+	var args []interface{}
+	for _, name := range names {
+		value, ok := values[name]
+		if !ok {
+			return nil, fmt.Errorf("missing value for parameter :%s: pass --param %s=VALUE", name, name)
+		}
+		args = append(args, sql.Named(name, paramValue(value)))
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(values)) {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("parameter '%s' is not used by the query (parameters: %s)", name, formatParamNames(names))
+		}
+	}
+	return args, nil
+}
+
+// paramValue returns the value to bind for a --param value: an int64 or a
+// float64 when the value is a number written the way SQLite writes it, so that
+// size + 1 > :min compares numbers, and otherwise the text. Text columns still
+// match numbers, as SQLite compares them as text: user_id = :id works with
+// --param id=42, while --param id=007 stays text
+func paramValue(value string) interface{} {
+	if n, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(n, 10) == value {
+		return n
+	}
+	if f, err := strconv.ParseFloat(value, 64); err == nil && strconv.FormatFloat(f, 'f', -1, 64) == value && strings.Contains(value, ".") {
+		return f
+	}
+	return value
+}
+
+// formatParamNames lists parameter names as they are written in queries
+func formatParamNames(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return ":" + strings.Join(names, ", :")
+}
+
+// formatParameters lists parameter values as SQL literals, for echoing queries
+func formatParameters(args []interface{}) string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		prefix := ""
+		if named, ok := arg.(sql.NamedArg); ok {
+			prefix, arg = ":"+named.Name+" = ", named.Value
+		}
+		if s, ok := arg.(string); ok {
+			values[i] = prefix + "'" + strings.ReplaceAll(s, "'", "''") + "'"
+		} else {
+			values[i] = prefix + fmt.Sprint(arg)
+		}
+	}
+	return strings.Join(values, ", ")
+}
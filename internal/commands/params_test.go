@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"database/sql"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestQueryParams tests finding the :name parameters of a query
+func TestQueryParams(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"none", "SELECT * FROM logs", nil},
+		{"in order of first use", "SELECT * FROM logs WHERE username = :user AND size > :min OR username = :user", []string{"user", "min"}},
+		{"next to operators", "SELECT * FROM logs WHERE size BETWEEN :lo AND :hi+1", []string{"lo", "hi"}},
+		{"string literals", "SELECT * FROM logs WHERE timestamp > '2020-04-15 10:00:00' AND note = 'it''s :x' AND a = :a", []string{"a"}},
+		{"quoted identifiers", `SELECT "a:b", [c:d], ` + "`e:f`" + ` FROM logs`, nil},
+		{"comments", "SELECT * FROM logs -- where user = :user\nWHERE /* :size */ size > :min", []string{"min"}},
+		{"no name", "SELECT ':' || x FROM logs WHERE a = : b AND c = :1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := queryParams(tt.query); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queryParams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseParams tests reading --param values
+func TestParseParams(t *testing.T) {
+	values, err := parseParams([]string{"user=jeff22", ":min=50", "where=a=b,c", "empty="})
+	if err != nil {
+		t.Fatalf("parseParams() error = %v", err)
+	}
+	want := map[string]string{"user": "jeff22", "min": "50", "where": "a=b,c", "empty": ""}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("parseParams() = %v, want %v", values, want)
+	}
+
+	for _, params := range [][]string{{"user"}, {"=x"}, {"1st=x"}, {"a-b=x"}, {"a=1", "a=2"}} {
+		if _, err := parseParams(params); err == nil {
+			t.Errorf("Expected an error for %v", params)
+		}
+	}
+}
+
+// TestBindParams tests binding values to the parameters of a query
+func TestBindParams(t *testing.T) {
+	query := "SELECT * FROM logs WHERE username = :user AND size > :min AND ratio < :ratio AND code = :code"
+	args, err := bindParams(query, map[string]string{"user": "jeff22", "min": "50", "ratio": "0.5", "code": "007"})
+	if err != nil {
+		t.Fatalf("bindParams() error = %v", err)
+	}
+	want := []interface{}{
+		sql.Named("user", "jeff22"),
+		sql.Named("min", int64(50)),
+		sql.Named("ratio", 0.5),
+		sql.Named("code", "007"),
+	}
+	if !reflect.DeepEqual(args, want) {
+		t.Errorf("bindParams() = %v, want %v", args, want)
+	}
+	if got := formatParameters(args); got != ":user = 'jeff22', :min = 50, :ratio = 0.5, :code = '007'" {
+		t.Errorf("formatParameters() = %s", got)
+	}
+
+	tests := []struct {
+		name    string
+		values  map[string]string
+		wantErr string
+	}{
+		{"missing value", map[string]string{"user": "a", "min": "1", "ratio": "1"}, "missing value for parameter :code"},
+		{"unused value", map[string]string{"user": "a", "min": "1", "ratio": "1", "code": "1", "usr": "b"}, "parameter 'usr' is not used"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := bindParams(query, tt.values)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
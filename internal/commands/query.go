@@ -4,6 +4,7 @@ package commands
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"regexp"
 	"strings"
@@ -11,14 +12,31 @@ import (
 	"github.com/spf13/cobra"
 	"server-log-analyzer/internal/config"
 	"server-log-analyzer/internal/database"
+	"server-log-analyzer/internal/nlquery"
+	"server-log-analyzer/internal/output"
+	"server-log-analyzer/internal/parser"
 )
 
+// queryOptions holds the flags of the query command
+type queryOptions struct {
+	dbFile         string
+	tableName      string
+	sqlQuery       string
+	question       string
+	translatorName string
+	params         []string
+	saved          string
+	save           string
+	description    string
+	deleteSaved    string
+	listSaved      bool
+	output         outputOptions
+}
+
 // NewQueryCommand creates the 'query' subcommand for executing SQL queries
-// Usage: server-log-analyzer query [--db logs.db] [--table logs] [--sql "SELECT * FROM logs"]
+// Usage: server-log-analyzer query [--db logs.db] [--table logs] [--sql "SELECT * FROM logs" | --ask "how many uploads?" | --saved NAME] [--param name=value]
 func NewQueryCommand() *cobra.Command {
-	var dbFile string
-	var tableName string
-	var sqlQuery string
+	opts := &queryOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "query",
@@ -58,67 +76,311 @@ Direct query:
 Table-specific query:
   server-log-analyzer query --table users --sql "SELECT COUNT(*) FROM users"
 
-Note: This command currently accepts raw SQL queries. In future versions,
-this could be extended to support natural language queries that are
-automatically translated to SQL using AI/ML models.`,
+Output formats (--format, --output):
+Results are printed as a table unless --format chooses csv, tsv, json, ndjson,
+markdown or html. Columns keep the order of the SELECT list. NULL is null in
+JSON, an empty field in CSV and TSV, and NULL in the other formats. --output
+writes the results to a file, in the format of its extension (.csv, .tsv,
+.json, .ndjson, .md, .html) unless --format is given. With another format than
+table on standard output, the query is echoed to standard error so the results
+can be piped.
+  server-log-analyzer query --sql "SELECT * FROM {table}" --format json | jq .
+  server-log-analyzer query --sql "SELECT * FROM {table}" --output logs.csv
+
+Parameters (--param):
+Write :name in the query where a value goes and give it with --param name=value.
+Values are bound by SQLite, never spliced into the SQL, so they need no quoting
+and cannot change the query. Numbers such as 50 or 2.5 are bound as numbers,
+anything else as text. Every parameter needs a value, and every value must be
+used by the query.
+  server-log-analyzer query --sql "SELECT COUNT(*) FROM {table} WHERE username = :user" --param user=jeff22
+
+Saved queries (--save, --saved):
+--save stores the --sql query in the database under a name instead of running
+it; --saved runs it, with its parameters given by --param. {table} is replaced
+when the query runs, so one saved query serves every table.
+  server-log-analyzer query --save uploads_over --description "Uploads over a size in kB" \
+    --sql "SELECT COUNT(*) AS uploads FROM {table} WHERE operation = 'upload' AND size > :min"
+  server-log-analyzer query --saved uploads_over --param min=50
+  server-log-analyzer query --list-saved
+  server-log-analyzer query --delete-saved uploads_over
+
+Natural language questions (--ask):
+--ask translates a question about the --table table into SQL, prints the SQL
+and runs it; the SQL is checked like any other query. The default 'rules'
+translator reads the table's columns with PRAGMA table_info and understands:
+  - what to compute: how many, how many users, total, average, largest,
+    smallest, which users (or who), list
+  - users: user jeff22, by jeff22, did jeff22 do, jeff22's
+  - values of columns with few distinct values, in any form: uploads, downloaded
+  - sizes: over, under, at least, at most 50kB (also bytes, MB and GB)
+  - dates: on April 15th, before 2020-04-15, since 15 April 2020, in April
+  - grouping: per user, by day, hourly, by operation, top 5 users
+Dates without a year match that day of every year. Relative dates (yesterday,
+last week) and words that are neither a column nor a value of one are errors.
+The values in the question are bound as parameters, printed after the SQL.
+
+  server-log-analyzer query --ask "how many uploads over 50kB did jeff22 do on April 15th?"
+  server-log-analyzer query --ask "total size of downloads per day"`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return runQueryCommand(dbFile, tableName, sqlQuery)
+			if err := opts.validate(); err != nil {
+				return err
+			}
+			// The flags are valid: a failure from here on, such as a question
+			// that cannot be translated, is not helped by the usage text
+			cmd.SilenceUsage = true
+			switch {
+			case opts.listSaved:
+				return runListSavedQueries(cmd.OutOrStdout(), opts.dbFile)
+			case opts.deleteSaved != "":
+				return runDeleteSavedQuery(cmd.OutOrStdout(), opts.dbFile, opts.deleteSaved)
+			case opts.save != "":
+				return runSaveQuery(cmd.OutOrStdout(), opts)
+			case opts.question != "":
+				return runAskCommand(opts.dbFile, opts.tableName, opts.translatorName, opts.question, &opts.output)
+			}
+			return runQueryCommand(opts)
 		},
 	}
 
 	// Define command flags
-	cmd.Flags().StringVarP(&dbFile, "db", "d", config.DefaultDatabaseFile, config.DatabaseFileDescription)
-	cmd.Flags().StringVarP(&tableName, "table", "t", config.DefaultTableName, config.TableNameDescription+" (used as context for queries)")
-	cmd.Flags().StringVarP(&sqlQuery, "sql", "s", "", "SQL query to execute (if not provided, enters interactive mode)")
+	cmd.Flags().StringVarP(&opts.dbFile, "db", "d", config.DefaultDatabaseFile, config.DatabaseFileDescription)
+	cmd.Flags().StringVarP(&opts.tableName, "table", "t", config.DefaultTableName, config.TableNameDescription+" (used as context for queries)")
+	cmd.Flags().StringVarP(&opts.sqlQuery, "sql", "s", "", "SQL query to execute (if not provided, enters interactive mode)")
+	cmd.Flags().StringVarP(&opts.question, "ask", "a", "", "Question in plain English to translate to SQL and execute")
+	cmd.Flags().StringVar(&opts.translatorName, "translator", nlquery.DefaultTranslator,
+		"How --ask questions are translated: "+strings.Join(nlquery.Names(), ", "))
+	cmd.Flags().StringArrayVarP(&opts.params, "param", "p", nil, "Value of a :name parameter of the query, as name=value (repeatable)")
+	cmd.Flags().StringVar(&opts.saved, "saved", "", "Execute the query saved under this name")
+	cmd.Flags().StringVar(&opts.save, "save", "", "Save the --sql query under this name instead of executing it")
+	cmd.Flags().StringVar(&opts.description, "description", "", "Description of the query saved with --save")
+	cmd.Flags().StringVar(&opts.deleteSaved, "delete-saved", "", "Delete the query saved under this name")
+	cmd.Flags().BoolVar(&opts.listSaved, "list-saved", false, "List the saved queries")
+	cmd.Flags().StringVar(&opts.output.format, "format", "", formatFlagDescription)
+	cmd.Flags().StringVarP(&opts.output.file, "output", "o", "", outputFlagDescription)
 
 	return cmd
 }
 
+// validate checks that the flags given can be used together
+func (o *queryOptions) validate() error {
+	if o.sqlQuery != "" && o.question != "" {
+		return fmt.Errorf("--sql and --ask cannot be used together")
+	}
+	if o.saved != "" && (o.sqlQuery != "" || o.question != "") {
+		return fmt.Errorf("--saved cannot be used with --sql or --ask")
+	}
+	if o.save != "" && o.sqlQuery == "" {
+		return fmt.Errorf("--save needs the query to save, given with --sql")
+	}
+	if o.description != "" && o.save == "" {
+		return fmt.Errorf("--description can only be used with --save")
+	}
+	if (o.listSaved || o.deleteSaved != "") && (o.sqlQuery != "" || o.question != "" || o.saved != "" || o.save != "") {
+		return fmt.Errorf("--list-saved and --delete-saved cannot be used with other queries")
+	}
+	if len(o.params) > 0 && ((o.sqlQuery == "" && o.saved == "") || o.save != "") {
+		return fmt.Errorf("--param needs a query to execute, given with --sql or --saved")
+	}
+	if o.output.file != "" && ((o.sqlQuery == "" && o.saved == "" && o.question == "") || o.save != "") {
+		return fmt.Errorf("--output needs a query to execute, given with --sql, --saved or --ask")
+	}
+	return o.output.validate()
+}
+
 // runQueryCommand executes the query logic
-func runQueryCommand(dbFile, tableName, sqlQuery string) error {
+func runQueryCommand(opts *queryOptions) error {
+	values, err := parseParams(opts.params)
+	if err != nil {
+		return err
+	}
+
 	// Validate database file exists
-	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
-		return fmt.Errorf("database file does not exist: %s\nPlease run 'load' command first", dbFile)
+	if _, err := os.Stat(opts.dbFile); os.IsNotExist(err) {
+		return fmt.Errorf("database file does not exist: %s\nPlease run 'load' command first", opts.dbFile)
 	}
 
 	// Initialize database connection
-	db, err := database.Initialize(dbFile)
+	db, err := database.Initialize(opts.dbFile)
 	if err != nil {
 		return fmt.Errorf("failed to connect to database: %w", err)
 	}
 	defer db.Close()
 
+	sqlQuery := opts.sqlQuery
+	if opts.saved != "" {
+		saved, err := database.GetSavedQuery(db, opts.saved)
+		if err != nil {
+			return err
+		}
+		if saved == nil {
+			return fmt.Errorf("no query saved as '%s': see --list-saved", opts.saved)
+		}
+		sqlQuery = saved.SQL
+	}
+
 	// Execute single query or enter interactive mode
 	if sqlQuery != "" {
-		return executeSingleQuery(db, sqlQuery, tableName)
+		args, err := bindParams(sqlQuery, values)
+		if err != nil {
+			return err
+		}
+		return executeSingleQuery(db, sqlQuery, opts.tableName, &opts.output, args...)
+	}
+
+	return enterInteractiveMode(db, opts.dbFile, opts.tableName, opts.output.format)
+}
+
+// runAskCommand translates a question into SQL and executes it
+func runAskCommand(dbFile, tableName, translatorName, question string, out *outputOptions) error {
+	translator, err := nlquery.New(translatorName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+		return fmt.Errorf("database file does not exist: %s\nPlease run 'load' command first", dbFile)
+	}
+
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	table, err := readQuestionTable(db, tableName)
+	if err != nil {
+		return err
+	}
+	query, args, err := translator.Translate(question, table)
+	if err != nil {
+		return fmt.Errorf("failed to translate question: %w", err)
 	}
 
-	return enterInteractiveMode(db, dbFile, tableName)
+	// The translated query is echoed and validated like a query given with --sql
+	fmt.Fprintf(out.messages(), "Question: %s\n", question)
+	return executeSingleQuery(db, query, tableName, out, args...)
+}
+
+// readQuestionTable reads what a translator knows about a table: its columns
+// and the values of the TEXT columns that have few distinct values
+func readQuestionTable(db database.DB, tableName string) (nlquery.Table, error) {
+	schema, err := database.ReadTableSchema(db, tableName)
+	if err != nil {
+		return nlquery.Table{}, err
+	}
+	if schema == nil {
+		return nlquery.Table{}, fmt.Errorf("table '%s' does not exist", tableName)
+	}
+
+	table := nlquery.Table{Name: tableName, Columns: schema.Columns, Values: make(map[string][]string)}
+	for _, col := range schema.Columns {
+		if col.Type != parser.TypeText {
+			continue
+		}
+		query := fmt.Sprintf("SELECT DISTINCT %s AS value FROM %s WHERE %s IS NOT NULL ORDER BY 1 LIMIT %d",
+			col.Name, tableName, col.Name, config.MaxCategoricalValues+1)
+		results, err := database.ExecuteQuery(db, query)
+		if err != nil {
+			return nlquery.Table{}, fmt.Errorf("failed to read values of column '%s': %w", col.Name, err)
+		}
+		if len(results) > config.MaxCategoricalValues {
+			continue
+		}
+		for _, row := range results {
+			table.Values[col.Name] = append(table.Values[col.Name], fmt.Sprint(row["value"]))
+		}
+	}
+	return table, nil
 }
 
-// executeSingleQuery runs a single SQL query and displays results
-func executeSingleQuery(db database.DB, query string, tableName string) error {
+// executeSingleQuery runs a single SQL query and writes its results as the
+// output flags ask. The args are the values of the query's parameters, if any
+func executeSingleQuery(db database.DB, query string, tableName string, out *outputOptions, args ...interface{}) error {
 	// Substitute {table} placeholder with actual table name
 	query = strings.ReplaceAll(query, "{table}", tableName)
 
-	fmt.Printf("Executing query: %s\n\n", query)
+	messages := out.messages()
+	fmt.Fprintf(messages, "Executing query: %s\n", query)
+	if len(args) > 0 {
+		fmt.Fprintf(messages, "Parameters: %s\n", formatParameters(args))
+	}
+	fmt.Fprintln(messages)
 
 	// Validate that query is read-only
 	if err := ValidateReadOnlyQuery(query); err != nil {
 		return fmt.Errorf("query validation failed: %w", err)
 	}
 
-	results, err := database.ExecuteQuery(db, query)
+	result, err := database.ExecuteQueryResult(db, query, args...)
 	if err != nil {
 		return fmt.Errorf("query execution failed: %w", err)
 	}
 
-	displayResults(results)
+	return out.writeResults(result)
+}
+
+// outputOptions holds the flags choosing how query results are written
+type outputOptions struct {
+	format string
+	file   string
+}
+
+// Help text of the output flags, shared by the commands that write results
+var (
+	formatFlagDescription = "Format of the results: " + strings.Join(output.Formats, ", ") + " (default from the --output extension, else table)"
+	outputFlagDescription = "Write the results to this file instead of standard output"
+)
+
+// validate checks the format. Without --format, it follows the extension of
+// the --output file (results.csv is written as CSV), and is table otherwise
+func (o *outputOptions) validate() error {
+	if o.format == "" {
+		o.format = output.FormatTable
+		if format, ok := output.FormatForFile(o.file); ok && o.file != "" {
+			o.format = format
+		}
+	}
+	if !output.IsFormat(o.format) {
+		return fmt.Errorf("invalid --format '%s': must be one of %s", o.format, strings.Join(output.Formats, ", "))
+	}
+	return nil
+}
+
+// messages returns where to echo the query: standard error when the results
+// go to standard output in a format for other tools, so they can be piped
+func (o *outputOptions) messages() io.Writer {
+	if o.file == "" && o.format != output.FormatTable {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// writeResults writes the results to the --output file, or to standard output
+func (o *outputOptions) writeResults(result *database.QueryResult) error {
+	if o.file == "" {
+		return output.Write(os.Stdout, o.format, result)
+	}
+
+	file, err := os.Create(o.file)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	if err := output.Write(file, o.format, result); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", o.file, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", o.file, err)
+	}
+
+	fmt.Printf("Wrote %d rows to %s (%s)\n", len(result.Rows), o.file, o.format)
 	return nil
 }
 
 // enterInteractiveMode provides an interactive SQL query interface
-func enterInteractiveMode(db database.DB, dbFile string, tableName string) error {
+// Results are written to the terminal in the format given
+func enterInteractiveMode(db database.DB, dbFile string, tableName string, format string) error {
 	fmt.Printf("Connected to database: %s\n", dbFile)
 	fmt.Printf("Default table context: %s\n", tableName)
 	fmt.Println("Interactive SQL query mode. Type 'exit' or 'quit' to exit.")
@@ -172,13 +434,16 @@ func enterInteractiveMode(db database.DB, dbFile string, tableName string) error
 			continue
 		}
 
-		results, err := database.ExecuteQuery(db, query)
+		result, err := database.ExecuteQueryResult(db, query)
 		if err != nil {
 			fmt.Printf("Error: %v\n\n", err)
 			continue
 		}
 
-		displayResults(results)
+		if err := output.Write(os.Stdout, format, result); err != nil {
+			fmt.Printf("Error: %v\n\n", err)
+			continue
+		}
 		fmt.Println()
 	}
 
@@ -189,51 +454,6 @@ func enterInteractiveMode(db database.DB, dbFile string, tableName string) error
 	return nil
 }
 
-// displayResults formats and prints query results
-func displayResults(results []map[string]interface{}) {
-	if len(results) == 0 {
-		fmt.Println("No results found.")
-		return
-	}
-
-	// Get column names from first result
-	var columns []string
-	for column := range results[0] {
-		columns = append(columns, column)
-	}
-
-	// Print header
-	for i, column := range columns {
-		if i > 0 {
-			fmt.Print(" | ")
-		}
-		fmt.Printf("%-15s", column)
-	}
-	fmt.Println()
-
-	// Print separator
-	for i := range columns {
-		if i > 0 {
-			fmt.Print(" | ")
-		}
-		fmt.Print(strings.Repeat("-", 15))
-	}
-	fmt.Println()
-
-	// Print rows
-	for _, row := range results {
-		for i, column := range columns {
-			if i > 0 {
-				fmt.Print(" | ")
-			}
-			fmt.Printf("%-15v", row[column])
-		}
-		fmt.Println()
-	}
-
-	fmt.Printf("\n(%d rows)\n", len(results))
-}
-
 // ValidateReadOnlyQuery ensures the SQL query is read-only and safe to execute
 // Prevents data modification, schema changes, and other potentially harmful operations
 func ValidateReadOnlyQuery(query string) error {
@@ -7,6 +7,9 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"server-log-analyzer/internal/database"
+	"server-log-analyzer/internal/parser"
 )
 
 // TestValidateReadOnlyQuery tests the query validation function
@@ -673,3 +676,225 @@ func ExampleNewQueryCommand() {
 	fmt.Println("Query command configured")
 	// Output: Query command configured
 }
+
+// TestQueryCommandAsk tests answering a question about a loaded table
+func TestQueryCommandAsk(t *testing.T) {
+	tempDir := t.TempDir()
+
+	csvFile := filepath.Join(tempDir, "logs.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	content := "timestamp,username,operation,size\n" +
+		"2020-04-15 10:00:00,jeff22,upload,60\n" +
+		"2020-04-15 11:00:00,jeff22,upload,20\n" +
+		"2020-04-16 10:00:00,jeff22,download,70\n" +
+		"2020-04-15 12:00:00,alice,upload,90\n"
+	if err := os.WriteFile(csvFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+	loadForTest(t, "--file", csvFile, "--db", dbFile)
+
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	table, err := readQuestionTable(db, "logs")
+	db.Close()
+	if err != nil {
+		t.Fatalf("readQuestionTable() error = %v", err)
+	}
+	if got := strings.Join(table.Values["operation"], ","); got != "download,upload" {
+		t.Errorf("Expected the operation values download,upload, got %q", got)
+	}
+	if table.Column("size") == nil || table.Column("timestamp").Type != parser.TypeTimestamp {
+		t.Errorf("Expected the columns of the table, got %+v", table.Columns)
+	}
+
+	question := "how many uploads over 50kB did jeff22 do on April 15th?"
+	if _, err := runForTest(t, NewQueryCommand(), "--db", dbFile, "--ask", question); err != nil {
+		t.Errorf("Ask failed: %v", err)
+	}
+
+	// The values are bound as parameters, so the answer is that of the question
+	answer := filepath.Join(tempDir, "answer.csv")
+	if _, err := runForTest(t, NewQueryCommand(), "--db", dbFile, "--ask", "How many times did jeff22 upload to the server on April 15th, 2020?", "--output", answer); err != nil {
+		t.Fatalf("Ask failed: %v", err)
+	}
+	if got, _ := os.ReadFile(answer); string(got) != "count\n2\n" {
+		t.Errorf("Expected a count of 2, got %q", got)
+	}
+
+	// A question that cannot be translated is not followed by the usage text
+	cmd := NewQueryCommand()
+	if _, err := runForTest(t, cmd, "--db", dbFile, "--ask", "how many errors happened?"); err == nil || !cmd.SilenceUsage {
+		t.Errorf("Expected a translation error without usage, got %v (SilenceUsage %v)", err, cmd.SilenceUsage)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"with sql", []string{"--ask", question, "--sql", "SELECT 1"}, "cannot be used together"},
+		{"unknown translator", []string{"--ask", question, "--translator", "oracle"}, "unknown translator 'oracle'"},
+		{"missing table", []string{"--ask", question, "--table", "missing"}, "table 'missing' does not exist"},
+		{"no intent", []string{"--ask", "uploads by jeff22"}, "failed to translate question"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runForTest(t, NewQueryCommand(), append([]string{"--db", dbFile}, tt.args...)...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestQueryCommandSavedQueries tests saving a query and running it with parameters
+func TestQueryCommandSavedQueries(t *testing.T) {
+	tempDir := t.TempDir()
+
+	csvFile := filepath.Join(tempDir, "logs.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	content := "timestamp,username,operation,size\n" +
+		"2020-04-15 10:00:00,jeff22,upload,60\n" +
+		"2020-04-15 11:00:00,alice,upload,20\n"
+	if err := os.WriteFile(csvFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+	loadForTest(t, "--file", csvFile, "--db", dbFile)
+
+	sqlQuery := "SELECT COUNT(*) AS uploads FROM {table} WHERE operation = 'upload' AND size > :min"
+	out, err := runForTest(t, NewQueryCommand(), "--db", dbFile, "--save", "uploads_over", "--description", "Uploads over a size", "--sql", sqlQuery)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if !strings.Contains(out, "Saved query 'uploads_over' with parameters :min") {
+		t.Errorf("Expected the saved query to be reported, got:\n%s", out)
+	}
+
+	out, err = runForTest(t, NewQueryCommand(), "--db", dbFile, "--list-saved")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	for _, want := range []string{"uploads_over - Uploads over a size", "Parameters: :min", sqlQuery, "(1 saved queries)"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the list to contain %q, got:\n%s", want, out)
+		}
+	}
+
+	if _, err := runForTest(t, NewQueryCommand(), "--db", dbFile, "--saved", "uploads_over", "--param", "min=50"); err != nil {
+		t.Errorf("Running the saved query failed: %v", err)
+	}
+	if _, err := runForTest(t, NewQueryCommand(), "--db", dbFile, "--sql", "SELECT * FROM logs WHERE username = :user", "-p", "user=x' OR '1'='1"); err != nil {
+		t.Errorf("Running a parameterized query failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"missing parameter", []string{"--saved", "uploads_over"}, "missing value for parameter :min"},
+		{"unused parameter", []string{"--saved", "uploads_over", "-p", "min=1", "-p", "max=2"}, "parameter 'max' is not used"},
+		{"unknown saved query", []string{"--saved", "nope"}, "no query saved as 'nope'"},
+		{"save without sql", []string{"--save", "x"}, "--save needs the query to save"},
+		{"save a write", []string{"--save", "x", "--sql", "DELETE FROM logs"}, "only read-only queries are allowed"},
+		{"invalid name", []string{"--save", "my query", "--sql", "SELECT 1"}, "invalid saved query name"},
+		{"saved with sql", []string{"--saved", "uploads_over", "--sql", "SELECT 1"}, "--saved cannot be used with --sql or --ask"},
+		{"param without query", []string{"-p", "a=1"}, "--param needs a query to execute"},
+		{"param with save", []string{"--save", "x", "--sql", "SELECT :a", "-p", "a=1"}, "--param needs a query to execute"},
+		{"description without save", []string{"--sql", "SELECT 1", "--description", "x"}, "--description can only be used with --save"},
+		{"list with query", []string{"--list-saved", "--sql", "SELECT 1"}, "cannot be used with other queries"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runForTest(t, NewQueryCommand(), append([]string{"--db", dbFile}, tt.args...)...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	if _, err := runForTest(t, NewQueryCommand(), "--db", dbFile, "--delete-saved", "uploads_over"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := runForTest(t, NewQueryCommand(), "--db", dbFile, "--delete-saved", "uploads_over"); err == nil {
+		t.Error("Expected deleting a deleted query to fail")
+	}
+}
+
+// TestQueryCommandOutput tests writing results to a file in the chosen format
+func TestQueryCommandOutput(t *testing.T) {
+	tempDir := t.TempDir()
+
+	csvFile := filepath.Join(tempDir, "logs.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	content := "timestamp,username,operation,size\n" +
+		"2020-04-15 10:00:00,jeff22,upload,60\n" +
+		"2020-04-15 11:00:00,alice,upload,20\n"
+	if err := os.WriteFile(csvFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+	loadForTest(t, "--file", csvFile, "--db", dbFile)
+
+	sqlQuery := "SELECT username, size, NULL AS note FROM logs ORDER BY size"
+	tests := []struct {
+		name string
+		file string
+		args []string
+		want string
+	}{
+		{"format from extension", "out.csv", nil, "username,size,note\nalice,20,\njeff22,60,\n"},
+		{"format flag", "out.txt", []string{"--format", "ndjson"}, "{\"username\":\"alice\",\"size\":20,\"note\":null}\n{\"username\":\"jeff22\",\"size\":60,\"note\":null}\n"},
+		{"unknown extension", "out.dat", nil, "username | size | note\n-------- | ---- | ----\nalice    | 20   | NULL\njeff22   | 60   | NULL\n\n(2 rows)\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tempDir, tt.file)
+			args := append([]string{"--db", dbFile, "--sql", sqlQuery, "--output", path}, tt.args...)
+			if _, err := runForTest(t, NewQueryCommand(), args...); err != nil {
+				t.Fatalf("Query failed: %v", err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Output =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	// Statistics are written with the same formats
+	path := filepath.Join(tempDir, "users.json")
+	if _, err := runForTest(t, NewStatsCommand(), "users", "--db", dbFile, "--output", path); err != nil {
+		t.Fatalf("Stats failed: %v", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "[\n  {\"users\":2}\n]\n" {
+		t.Errorf("Stats output = %q", got)
+	}
+
+	errorTests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{"unknown format", []string{"--sql", sqlQuery, "--format", "xml"}, "invalid --format 'xml'"},
+		{"no format shorthand", []string{"--sql", sqlQuery, "-f", "json"}, "unknown shorthand flag: 'f'"}, // -f is --file in load
+		{"output without query", []string{"--output", filepath.Join(tempDir, "x.csv")}, "--output needs a query to execute"},
+		{"output with save", []string{"--save", "x", "--sql", sqlQuery, "--output", filepath.Join(tempDir, "x.csv")}, "--output needs a query to execute"},
+		{"unwritable output", []string{"--sql", sqlQuery, "--output", filepath.Join(tempDir, "missing", "x.csv")}, "failed to create output file"},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runForTest(t, NewQueryCommand(), append([]string{"--db", dbFile}, tt.args...)...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// maxReportedRejects is how many rejected records are listed in the load summary
+const maxReportedRejects = 5
+
+// rejectedRecord keeps the details of a rejected record for the load summary
+type rejectedRecord struct {
+	file   string
+	line   int
+	reason string
+}
+
+// rejectLog decides what happens to records that cannot be loaded
+// In abort mode the first rejected record fails the load. In skip mode records
+// are written to a reject CSV (file, line, reason, original fields) until the
+// optional error limit is exceeded
+// It is safe for concurrent use by the readers of a parallel load
+type rejectLog struct {
+	skip      bool
+	maxErrors int // 0 means no limit
+	path      string
+
+	mu     sync.Mutex
+	file   *os.File
+	writer *csv.Writer
+	count  int
+	first  []rejectedRecord
+}
+
+// newRejectLog creates a reject log; the reject file is only created once a record is rejected
+func newRejectLog(skip bool, maxErrors int, path string) *rejectLog {
+	return &rejectLog{
+		skip:      skip,
+		maxErrors: maxErrors,
+		path:      path,
+	}
+}
+
+// Reject records a bad record found at the given line of a file
+// It returns an error when the load should stop: always in abort mode, and in
+// skip mode once more than maxErrors records have been rejected
+// A nil rejectLog silently skips every record
+func (r *rejectLog) Reject(file string, line int, record []string, reason error) error {
+	if r == nil {
+		return nil
+	}
+
+	if !r.skip {
+		return fmt.Errorf("%s line %d: %w", file, line, reason)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.writer == nil {
+		f, err := os.Create(r.path)
+		if err != nil {
+			return fmt.Errorf("failed to create reject file: %w", err)
+		}
+		r.file = f
+		r.writer = csv.NewWriter(f)
+		if err := r.writer.Write([]string{"file", "line", "reason", "record"}); err != nil {
+			return fmt.Errorf("failed to write reject file: %w", err)
+		}
+	}
+
+	row := append([]string{file, strconv.Itoa(line), reason.Error()}, record...)
+	if err := r.writer.Write(row); err != nil {
+		return fmt.Errorf("failed to write reject file: %w", err)
+	}
+
+	r.count++
+	if len(r.first) < maxReportedRejects {
+		r.first = append(r.first, rejectedRecord{file: file, line: line, reason: reason.Error()})
+	}
+
+	if r.maxErrors > 0 && r.count > r.maxErrors {
+		return fmt.Errorf("too many rejected records: more than %d (last at %s line %d: %v)", r.maxErrors, file, line, reason)
+	}
+
+	return nil
+}
+
+// Count returns the number of rejected records
+func (r *rejectLog) Count() int {
+	return r.count
+}
+
+// PrintSummary displays how many records were rejected and a few examples
+func (r *rejectLog) PrintSummary() {
+	fmt.Printf("Rejected %d records (details written to %s)\n", r.count, r.path)
+	for _, rec := range r.first {
+		fmt.Printf("  %s line %d: %s\n", rec.file, rec.line, rec.reason)
+	}
+	if r.count > len(r.first) {
+		fmt.Printf("  ... and %d more\n", r.count-len(r.first))
+	}
+}
+
+// Close flushes and closes the reject file if one was written
+func (r *rejectLog) Close() error {
+	if r.writer == nil {
+		return nil
+	}
+
+	r.writer.Flush()
+	if err := r.writer.Error(); err != nil {
+		r.file.Close()
+		return fmt.Errorf("failed to write reject file: %w", err)
+	}
+
+	return r.file.Close()
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestRejectLogAbortMode tests that the first rejected record stops the load
+func TestRejectLogAbortMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rejects.csv")
+	rejects := newRejectLog(false, 0, path)
+	defer rejects.Close()
+
+	err := rejects.Reject("in.csv", 7, []string{"a", "b"}, fmt.Errorf("bad value"))
+	if err == nil || !strings.Contains(err.Error(), "in.csv line 7: bad value") {
+		t.Errorf("Reject() error = %v, want in.csv line 7: bad value", err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Reject file should not be created in abort mode")
+	}
+}
+
+// TestRejectLogSkipMode tests that rejected records are written to the reject file
+func TestRejectLogSkipMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rejects.csv")
+	rejects := newRejectLog(true, 0, path)
+
+	if err := rejects.Reject("in.csv", 3, []string{"x", "y,z"}, fmt.Errorf("wrong field count")); err != nil {
+		t.Fatalf("Reject() unexpected error: %v", err)
+	}
+	if err := rejects.Reject("in.csv", 9, nil, fmt.Errorf("bare quote")); err != nil {
+		t.Fatalf("Reject() unexpected error: %v", err)
+	}
+	if err := rejects.Close(); err != nil {
+		t.Fatalf("Close() unexpected error: %v", err)
+	}
+
+	if rejects.Count() != 2 {
+		t.Errorf("Count() = %d, want 2", rejects.Count())
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open reject file: %v", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read reject file: %v", err)
+	}
+
+	want := [][]string{
+		{"file", "line", "reason", "record"},
+		{"in.csv", "3", "wrong field count", "x", "y,z"},
+		{"in.csv", "9", "bare quote"},
+	}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("Reject file = %v, want %v", rows, want)
+	}
+}
+
+// TestRejectLogNil tests that a nil reject log skips records silently
+func TestRejectLogNil(t *testing.T) {
+	var rejects *rejectLog
+	if err := rejects.Reject("in.csv", 1, nil, fmt.Errorf("bad")); err != nil {
+		t.Errorf("Reject() on nil log error = %v, want nil", err)
+	}
+}
+
+// TestRejectLogMaxErrors tests that the load stops once the limit is exceeded
+func TestRejectLogMaxErrors(t *testing.T) {
+	rejects := newRejectLog(true, 2, filepath.Join(t.TempDir(), "rejects.csv"))
+	defer rejects.Close()
+
+	for line := 1; line <= 2; line++ {
+		if err := rejects.Reject("in.csv", line, nil, fmt.Errorf("bad")); err != nil {
+			t.Fatalf("Reject() unexpected error within limit: %v", err)
+		}
+	}
+
+	err := rejects.Reject("in.csv", 3, nil, fmt.Errorf("bad"))
+	if err == nil || !strings.Contains(err.Error(), "too many rejected records") {
+		t.Errorf("Reject() error = %v, want too many rejected records", err)
+	}
+}
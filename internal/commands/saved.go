@@ -0,0 +1,107 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"server-log-analyzer/internal/database"
+)
+
+// openQueryDatabase opens an existing database for the saved query flags
+func openQueryDatabase(dbFile string) (database.DB, error) {
+	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+		return nil, fmt.Errorf("database file does not exist: %s\nPlease run 'load' command first", dbFile)
+	}
+
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	return db, nil
+}
+
+// runSaveQuery checks the --sql query and saves it under the --save name
+func runSaveQuery(out io.Writer, opts *queryOptions) error {
+	if !isParamName(opts.save) {
+		return fmt.Errorf("invalid saved query name '%s': use letters, digits and underscores", opts.save)
+	}
+	if err := ValidateReadOnlyQuery(opts.sqlQuery); err != nil {
+		return fmt.Errorf("query validation failed: %w", err)
+	}
+
+	db, err := openQueryDatabase(opts.dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := database.Migrate(db); err != nil {
+		return fmt.Errorf("failed to migrate database: %w", err)
+	}
+	query := database.SavedQuery{Name: opts.save, SQL: opts.sqlQuery, Description: opts.description}
+	if err := database.SaveQuery(db, query); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Saved query '%s'", opts.save)
+	if names := queryParams(opts.sqlQuery); len(names) > 0 {
+		fmt.Fprintf(out, " with parameters %s", formatParamNames(names))
+	}
+	fmt.Fprintf(out, "\nRun it with: server-log-analyzer query --saved %s\n", opts.save)
+	return nil
+}
+
+// runListSavedQueries lists the saved queries with their parameters
+func runListSavedQueries(out io.Writer, dbFile string) error {
+	db, err := openQueryDatabase(dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	queries, err := database.ListSavedQueries(db)
+	if err != nil {
+		return err
+	}
+	if len(queries) == 0 {
+		fmt.Fprintln(out, "No saved queries. Save one with --save NAME --sql \"...\"")
+		return nil
+	}
+
+	for _, query := range queries {
+		fmt.Fprintf(out, "%s", query.Name)
+		if query.Description != "" {
+			fmt.Fprintf(out, " - %s", query.Description)
+		}
+		fmt.Fprintf(out, " (saved %s UTC)\n", query.UpdatedAt.UTC().Format(time.DateTime))
+		fmt.Fprintf(out, "  Parameters: %s\n", formatParamNames(queryParams(query.SQL)))
+		for _, line := range strings.Split(query.SQL, "\n") {
+			fmt.Fprintf(out, "  %s\n", line)
+		}
+	}
+	fmt.Fprintf(out, "(%d saved queries)\n", len(queries))
+	return nil
+}
+
+// runDeleteSavedQuery deletes a saved query
+func runDeleteSavedQuery(out io.Writer, dbFile, name string) error {
+	db, err := openQueryDatabase(dbFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	deleted, err := database.DeleteSavedQuery(db, name)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("no query saved as '%s'", name)
+	}
+	fmt.Fprintf(out, "Deleted saved query '%s'\n", name)
+	return nil
+}
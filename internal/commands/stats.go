@@ -0,0 +1,180 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"server-log-analyzer/internal/config"
+	"server-log-analyzer/internal/database"
+	"server-log-analyzer/internal/metrics"
+)
+
+// statsOptions holds the flags shared by the stats subcommands
+type statsOptions struct {
+	dbFile    string
+	tableName string
+	mapping   map[string]string
+	filter    metrics.Filter
+	output    outputOptions
+}
+
+// NewStatsCommand creates the 'stats' subcommand for the standard metrics
+// Usage: server-log-analyzer stats users|uploads|downloads|count|user NAME [filters]
+func NewStatsCommand() *cobra.Command {
+	opts := &statsOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "stats",
+		Short: "Answer the standard questions about the logs without writing SQL",
+		Long: `Compute the standard metrics over the loaded logs, without writing SQL.
+
+Each subcommand computes one metric over the records that pass every filter
+given. The filters compile into parameterized SQL, which is printed before it
+runs, and the result is written as the query command writes it, including
+--format and --output.
+
+Metrics:
+  users        Number of distinct users
+  uploads      Number of uploads (records whose operation is 'upload')
+  downloads    Number of downloads (records whose operation is 'download')
+  count        Number of records
+  user NAME    Number of records of one user
+
+Filters:
+  --user NAME              Records of this user
+  --op OPERATION           Records of this operation
+  --larger-than, --smaller-than
+                           Size strictly larger / smaller than this, such as
+                           50kB or 2MB (units are powers of 1024; a bare
+                           number is in the unit of the size column)
+  --min-size, --max-size   Size at least / at most this (inclusive)
+  --date YYYY-MM-DD        Records of this day (UTC)
+  --since, --before TIME   Records at or after / strictly before this time (UTC)
+
+Columns:
+The user, operation, size and time columns are found by name (username,
+operation, size and timestamp in the legacy schema, user and bytes in access
+logs, and so on). An access log's HTTP method is not taken as the operation;
+name it with --map operation=method if it should be. Name them with --map for
+other tables.
+
+Examples:
+  # How many users accessed the server?
+  server-log-analyzer stats users
+
+  # How many uploads were larger than 50kB?
+  server-log-analyzer stats uploads --larger-than 50kB
+
+  # How many times did jeff22 upload on April 15th, 2020?
+  server-log-analyzer stats user jeff22 --op upload --date 2020-04-15
+
+  # Users of a table whose columns are not found by name, on one day
+  server-log-analyzer stats users --table events --map user=who,time=created --date 2020-04-15`,
+	}
+
+	flags := cmd.PersistentFlags()
+	flags.StringVarP(&opts.dbFile, "db", "d", config.DefaultDatabaseFile, config.DatabaseFileDescription)
+	flags.StringVarP(&opts.tableName, "table", "t", config.DefaultTableName, "Table to compute the metrics over")
+	flags.StringToStringVar(&opts.mapping, "map", nil, "Columns to use for roles, as role=column (roles: user, operation, size, time)")
+	flags.StringVar(&opts.filter.User, "user", "", "Only count the records of this user")
+	flags.StringVar(&opts.filter.Operation, "op", "", "Only count the records of this operation")
+	flags.StringVar(&opts.filter.LargerThan, "larger-than", "", "Only count records strictly larger than this size, such as 50kB")
+	flags.StringVar(&opts.filter.SmallerThan, "smaller-than", "", "Only count records strictly smaller than this size, such as 2MB")
+	flags.StringVar(&opts.filter.MinSize, "min-size", "", "Only count records at least this size, inclusive, such as 50kB")
+	flags.StringVar(&opts.filter.MaxSize, "max-size", "", "Only count records at most this size, inclusive, such as 2MB")
+	flags.StringVar(&opts.filter.Date, "date", "", "Only count the records of this day, as YYYY-MM-DD")
+	flags.StringVar(&opts.filter.Since, "since", "", "Only count records at or after this time")
+	flags.StringVar(&opts.filter.Before, "before", "", "Only count records strictly before this time")
+	flags.StringVar(&opts.output.format, "format", "", formatFlagDescription)
+	flags.StringVarP(&opts.output.file, "output", "o", "", outputFlagDescription)
+
+	cmd.AddCommand(
+		newStatsSubcommand(opts, "users", "Number of distinct users", metrics.Users, ""),
+		newStatsSubcommand(opts, "uploads", "Number of uploads", metrics.Records, "upload"),
+		newStatsSubcommand(opts, "downloads", "Number of downloads", metrics.Records, "download"),
+		newStatsSubcommand(opts, "count", "Number of records", metrics.Records, ""),
+		newStatsUserCommand(opts),
+	)
+
+	return cmd
+}
+
+// newStatsSubcommand creates a stats subcommand computing the metric, over
+// the records of the operation when one is given
+func newStatsSubcommand(opts *statsOptions, name, short string, metric metrics.Metric, operation string) *cobra.Command {
+	return &cobra.Command{
+		Use:   name,
+		Short: short,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter := opts.filter
+			if operation != "" {
+				if filter.Operation != "" {
+					return fmt.Errorf("--op cannot be used with 'stats %s'", name)
+				}
+				filter.Operation = operation
+				metric.Name = name
+			}
+			return runStatsCommand(opts, metric, filter)
+		},
+	}
+}
+
+// newStatsUserCommand creates the 'stats user NAME' subcommand
+func newStatsUserCommand(opts *statsOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "user NAME",
+		Short: "Number of records of one user",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter := opts.filter
+			if filter.User != "" {
+				return fmt.Errorf("--user cannot be used with 'stats user'")
+			}
+			filter.User = args[0]
+			return runStatsCommand(opts, metrics.Records, filter)
+		},
+	}
+}
+
+// runStatsCommand compiles the metric for the table and executes it
+func runStatsCommand(opts *statsOptions, metric metrics.Metric, filter metrics.Filter) error {
+	if err := opts.output.validate(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(opts.dbFile); os.IsNotExist(err) {
+		return fmt.Errorf("database file does not exist: %s\nPlease run 'load' command first", opts.dbFile)
+	}
+
+	db, err := database.Initialize(opts.dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	schema, err := database.ReadTableSchema(db, opts.tableName)
+	if err != nil {
+		return err
+	}
+	if schema == nil {
+		return fmt.Errorf("table '%s' does not exist", opts.tableName)
+	}
+
+	columns, err := metrics.MapColumns(schema, opts.mapping)
+	if err != nil {
+		return err
+	}
+	query, err := metrics.Compile(metric, columns, filter)
+	var missing *metrics.MissingColumnError
+	if errors.As(err, &missing) {
+		return fmt.Errorf("%w: name it with --map %s=COLUMN", err, missing.Role)
+	}
+	if err != nil {
+		return err
+	}
+
+	return executeSingleQuery(db, query.SQL, opts.tableName, &opts.output, query.Args...)
+}
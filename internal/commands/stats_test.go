@@ -0,0 +1,95 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestStatsCommand tests computing metrics over a loaded table
+func TestStatsCommand(t *testing.T) {
+	tempDir := t.TempDir()
+
+	csvFile := filepath.Join(tempDir, "logs.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	content := "timestamp,username,operation,size\n" +
+		"2020-04-15 10:00:00,jeff22,upload,60\n" +
+		"2020-04-16 11:00:00,jeff22,upload,20\n" +
+		"2020-04-16 10:00:00,jeff22,download,70\n" +
+		"2020-04-15 12:00:00,alice,upload,90\n" +
+		"2020-04-15 13:00:00,alice,upload,50\n"
+	if err := os.WriteFile(csvFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+	loadForTest(t, "--file", csvFile, "--db", dbFile)
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string // Result as CSV
+		wantErr string
+	}{
+		{"users", []string{"users"}, "users\n2\n", ""},
+		{"uploads", []string{"uploads"}, "uploads\n4\n", ""},
+		{"large uploads", []string{"uploads", "--larger-than", "50kB"}, "uploads\n2\n", ""},
+		{"uploads of at least a size", []string{"uploads", "--min-size", "50kB"}, "uploads\n3\n", ""},
+		{"small records", []string{"count", "--smaller-than", "50kB", "--max-size", "60kB"}, "count\n1\n", ""},
+		{"downloads", []string{"downloads"}, "downloads\n1\n", ""},
+		{"user", []string{"user", "jeff22", "--op", "upload", "--date", "2020-04-15"}, "count\n1\n", ""},
+		{"users on a day", []string{"users", "--date", "2020-04-15"}, "users\n2\n", ""},
+		{"time range", []string{"count", "--since", "2020-04-15 12:00:00", "--before", "2020-04-16 10:00:00"}, "count\n2\n", ""},
+		{"mapped", []string{"count", "--map", "user=operation", "--user", "upload"}, "count\n4\n", ""},
+		{"op with uploads", []string{"uploads", "--op", "download"}, "", "--op cannot be used with 'stats uploads'"},
+		{"user with user", []string{"user", "jeff22", "--user", "alice"}, "", "--user cannot be used with 'stats user'"},
+		{"user without name", []string{"user"}, "", "accepts 1 arg"},
+		{"invalid size", []string{"count", "--max-size", "huge"}, "", "invalid size 'huge'"},
+		{"unknown role", []string{"count", "--map", "host=username"}, "", "unknown column role 'host'"},
+		{"missing column", []string{"count", "--map", "size=nope"}, "", "no column 'nope'"},
+		{"missing table", []string{"users", "--table", "missing"}, "", "table 'missing' does not exist"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outFile := filepath.Join(t.TempDir(), "result.csv")
+			_, err := runForTest(t, NewStatsCommand(), append(tt.args, "--db", dbFile, "--output", outFile)...)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Stats %v failed: %v", tt.args, err)
+			}
+			got, err := os.ReadFile(outFile)
+			if err != nil {
+				t.Fatalf("Failed to read output: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Stats %v = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestStatsCommandMissingColumn tests naming the flag that maps a missing column
+func TestStatsCommandMissingColumn(t *testing.T) {
+	tempDir := t.TempDir()
+
+	csvFile := filepath.Join(tempDir, "users.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	if err := os.WriteFile(csvFile, []byte("who,created\nJohn,2020-04-15\nJane,2020-04-16\n"), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+	loadForTest(t, "--file", csvFile, "--db", dbFile, "--table", "people")
+
+	_, err := runForTest(t, NewStatsCommand(), "users", "--db", dbFile, "--table", "people")
+	if err == nil || !strings.Contains(err.Error(), "table 'people' has no user column: name it with --map user=COLUMN") {
+		t.Fatalf("Expected a missing user column error, got %v", err)
+	}
+
+	if _, err := runForTest(t, NewStatsCommand(), "users", "--db", dbFile, "--table", "people", "--map", "user=who,time=created", "--date", "2020-04-15"); err != nil {
+		t.Errorf("Stats with a mapped user column failed: %v", err)
+	}
+}
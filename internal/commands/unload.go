@@ -0,0 +1,74 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"server-log-analyzer/internal/config"
+	"server-log-analyzer/internal/database"
+)
+
+// NewUnloadCommand creates the 'unload' subcommand for rolling back a load
+// Usage: server-log-analyzer unload --batch N [--db logs.db]
+func NewUnloadCommand() *cobra.Command {
+	var dbFile string
+	var batchID int64
+
+	cmd := &cobra.Command{
+		Use:   "unload",
+		Short: "Remove the rows inserted by a load",
+		Long: `Remove every row a load inserted, using the batch id stored in each row.
+
+Use 'history' to find the batch id of a load. The batch is marked as unloaded
+in the load history. Only active batches can be unloaded: the rows of a batch
+that was replaced by a later load are already gone. Rows loaded before load
+history was recorded have no batch id and cannot be unloaded.
+
+Examples:
+  # Find the bad load, then roll it back
+  server-log-analyzer history --table logs
+  server-log-analyzer unload --batch 7`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runUnloadCommand(cmd.OutOrStdout(), dbFile, batchID)
+		},
+	}
+
+	cmd.Flags().StringVarP(&dbFile, "db", "d", config.DefaultDatabaseFile, config.DatabaseFileDescription)
+	cmd.Flags().Int64Var(&batchID, "batch", 0, "Id of the load batch to remove (required)")
+	cmd.MarkFlagRequired("batch")
+
+	return cmd
+}
+
+// runUnloadCommand deletes the rows of a load batch in one transaction
+func runUnloadCommand(out io.Writer, dbFile string, batchID int64) error {
+	if batchID <= 0 {
+		return fmt.Errorf("batch must be a positive number, got %d", batchID)
+	}
+
+	if _, err := os.Stat(dbFile); os.IsNotExist(err) {
+		return fmt.Errorf("database file does not exist: %s", dbFile)
+	}
+
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+	defer db.Close()
+
+	var batch *database.LoadBatch
+	var deleted int64
+	err = database.WithTransaction(db, func(tx database.Executor) error {
+		batch, deleted, err = database.UnloadBatch(tx, batchID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Unloaded batch %d: deleted %d rows from table '%s'\n", batchID, deleted, batch.Table)
+	return nil
+}
@@ -0,0 +1,77 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"server-log-analyzer/internal/database"
+)
+
+// TestUnloadCommand tests rolling back one load of a legacy table
+func TestUnloadCommand(t *testing.T) {
+	tempDir := t.TempDir()
+
+	goodFile := filepath.Join(tempDir, "good.csv")
+	badFile := filepath.Join(tempDir, "bad.csv")
+	dbFile := filepath.Join(tempDir, "test.db")
+	if err := os.WriteFile(goodFile, []byte("timestamp,username,operation,size\n1587772800,jeff22,upload,45\n"), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+	if err := os.WriteFile(badFile, []byte("timestamp,username,operation,size\n1587772900,alice42,upload,99999\n1587773000,bob,download,1\n"), 0644); err != nil {
+		t.Fatalf("Failed to create CSV: %v", err)
+	}
+
+	loadForTest(t, "--file", goodFile, "--db", dbFile, "--schema-detection=false")
+	loadForTest(t, "--file", badFile, "--db", dbFile, "--schema-detection=false", "--append")
+
+	out, err := runForTest(t, NewUnloadCommand(), "--db", dbFile, "--batch", "2")
+	if err != nil {
+		t.Fatalf("Unload failed: %v", err)
+	}
+	if !strings.Contains(out, "Unloaded batch 2: deleted 2 rows from table 'logs'") {
+		t.Errorf("Unexpected unload output: %s", out)
+	}
+
+	db, err := database.Initialize(dbFile)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	results, err := database.ExecuteQuery(db, "SELECT username FROM logs")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 || results[0]["username"] != "jeff22" {
+		t.Errorf("Expected only the first load to remain, got %v", results)
+	}
+
+	out, err = runForTest(t, NewHistoryCommand(), "--db", dbFile)
+	if err != nil {
+		t.Fatalf("History failed: %v", err)
+	}
+	if !strings.Contains(out, "unloaded") {
+		t.Errorf("Expected the batch to be listed as unloaded, got:\n%s", out)
+	}
+
+	// A batch can only be unloaded once
+	if _, err := runForTest(t, NewUnloadCommand(), "--db", dbFile, "--batch", "2"); err == nil || !strings.Contains(err.Error(), "cannot be unloaded") {
+		t.Errorf("Expected error unloading twice, got %v", err)
+	}
+}
+
+// TestUnloadCommandValidation tests unload argument checks
+func TestUnloadCommandValidation(t *testing.T) {
+	tempDir := t.TempDir()
+
+	if _, err := runForTest(t, NewUnloadCommand(), "--db", filepath.Join(tempDir, "missing.db"), "--batch", "1"); err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("Expected missing database error, got %v", err)
+	}
+	if _, err := runForTest(t, NewUnloadCommand(), "--db", filepath.Join(tempDir, "missing.db"), "--batch", "0"); err == nil || !strings.Contains(err.Error(), "positive") {
+		t.Errorf("Expected invalid batch error, got %v", err)
+	}
+	if _, err := runForTest(t, NewUnloadCommand(), "--db", filepath.Join(tempDir, "missing.db")); err == nil {
+		t.Error("Expected an error without --batch")
+	}
+}
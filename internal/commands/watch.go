@@ -0,0 +1,234 @@
+// Package commands implements the CLI commands for the server log analyzer
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"server-log-analyzer/internal/parser"
+)
+
+// watchOptions holds the flags of the watch command
+type watchOptions struct {
+	load         loadOptions // Options of each file's load
+	dir          string
+	processedDir string
+	failedDir    string
+	pollInterval time.Duration
+	ctx          context.Context // Stops watching when cancelled
+}
+
+// NewWatchCommand creates the 'watch' subcommand for loading files dropped into a directory
+// Usage: server-log-analyzer watch --dir incoming/ [--db logs.db] [--table logs] [--poll-interval 5s]
+func NewWatchCommand() *cobra.Command {
+	var opts watchOptions
+
+	cmd := &cobra.Command{
+		Use:   "watch",
+		Short: "Load every file dropped into a directory",
+		Long: `Watch a directory and append every CSV or JSON Lines file that appears in it
+to the table, as 'load --append' would.
+
+Every --poll-interval the directory (not its subdirectories) is scanned for
+files; a file is loaded once its size has not changed between two scans, so
+files still being written are left alone. Hidden files and names ending in .tmp
+or .part are ignored. After its load a file is moved to the processed directory,
+or, if the load failed, to the failed directory together with a .error file
+holding the reason. Rejected records of a file are written next to it in the
+processed directory. A file whose content was already loaded into the table is
+not loaded again, and is moved to the processed directory.
+
+Each file is loaded in its own transaction. On SIGINT or SIGTERM the file being
+loaded is finished, then the command exits.
+
+The parsing, schema and error handling flags are those of the load command.
+
+Examples:
+  # Load the hourly exports dropped into incoming/
+  server-log-analyzer watch --dir incoming/ --table logs
+
+  # Skip records that are already loaded, and check for files every minute
+  server-log-analyzer watch --dir incoming/ --dedupe-key timestamp,username,operation,size --poll-interval 1m`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts.ctx = cmd.Context()
+			return runWatchCommand(opts)
+		},
+	}
+
+	cmd.Flags().StringVar(&opts.dir, "dir", "", "Directory to watch for new files (required)")
+	cmd.Flags().StringVar(&opts.processedDir, "processed-dir", "", "Where loaded files are moved (default: <dir>/processed)")
+	cmd.Flags().StringVar(&opts.failedDir, "failed-dir", "", "Where files that failed to load are moved (default: <dir>/failed)")
+	cmd.Flags().DurationVar(&opts.pollInterval, "poll-interval", 5*time.Second, "How often the directory is scanned for new files")
+	addRecordFlags(cmd, &opts.load)
+	cmd.MarkFlagRequired("dir")
+
+	return cmd
+}
+
+// runWatchCommand loads the files appearing in the directory until interrupted
+func runWatchCommand(opts watchOptions) error {
+	if opts.pollInterval <= 0 {
+		return fmt.Errorf("poll interval must be positive, got %s", opts.pollInterval)
+	}
+
+	// Bad flags would fail every file, so check them before moving any
+	opts.load.parallel = 1
+	if err := opts.load.validate(); err != nil {
+		return err
+	}
+	if _, err := opts.load.readOptions(); err != nil {
+		return err
+	}
+	if opts.load.schemaFile != "" {
+		override, err := parser.LoadSchemaOverride(opts.load.schemaFile)
+		if err != nil {
+			return err
+		}
+		if !opts.load.schemaDetection {
+			if _, err := applyLegacyRules(legacySchema(opts.load.tableName), override); err != nil {
+				return err
+			}
+		}
+	}
+	if info, err := os.Stat(opts.dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("watch directory does not exist: %s", opts.dir)
+	}
+	if opts.processedDir == "" {
+		opts.processedDir = filepath.Join(opts.dir, "processed")
+	}
+	if opts.failedDir == "" {
+		opts.failedDir = filepath.Join(opts.dir, "failed")
+	}
+	for _, dir := range []string{opts.processedDir, opts.failedDir} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+	}
+
+	ctx := opts.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Watching %s for files to load into table '%s'; press Ctrl-C to stop\n", opts.dir, opts.load.tableName)
+
+	sizes := make(map[string]int64)
+	for {
+		ready, err := scanDropDir(opts.dir, sizes)
+		if err != nil {
+			return err
+		}
+		for _, name := range ready {
+			if ctx.Err() != nil {
+				break
+			}
+			if err := loadDroppedFile(opts, name); err != nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Stopped watching %s\n", opts.dir)
+			return nil
+		case <-time.After(opts.pollInterval):
+		}
+	}
+}
+
+// scanDropDir returns the names of the files in the directory that are ready
+// to be loaded: those whose size is the same as at the previous scan, recorded
+// in sizes. Files that are not loadable or look like temporary files are ignored
+func scanDropDir(dir string, sizes map[string]int64) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watch directory: %w", err)
+	}
+
+	var ready []string
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !isLoadableFile(name) || strings.HasPrefix(name, ".") ||
+			strings.HasSuffix(name, ".tmp") || strings.HasSuffix(name, ".part") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed since the directory was read
+		}
+		seen[name] = true
+
+		if size, ok := sizes[name]; ok && size == info.Size() {
+			ready = append(ready, name)
+			delete(sizes, name)
+			continue
+		}
+		sizes[name] = info.Size()
+	}
+
+	// Forget files that disappeared before they were loaded
+	for name := range sizes {
+		if !seen[name] {
+			delete(sizes, name)
+		}
+	}
+
+	sort.Strings(ready)
+	return ready, nil
+}
+
+// loadDroppedFile appends one file to the table and moves it to the processed
+// or failed directory. Only a failure to move the file is returned: a file that
+// cannot be moved would be loaded again at the next scan
+func loadDroppedFile(opts watchOptions, name string) error {
+	path := filepath.Join(opts.dir, name)
+
+	loadOpts := opts.load
+	loadOpts.files = []string{path}
+	loadOpts.appendMode = true
+	loadOpts.rejectFile = filepath.Join(opts.processedDir, parser.TrimCompressionExtension(name)+".rejected.csv")
+
+	loadErr := runLoadCommand(loadOpts)
+
+	dir := opts.processedDir
+	if loadErr != nil {
+		dir = opts.failedDir
+		fmt.Printf("Failed to load %s: %v\n", path, loadErr)
+	}
+	dest, err := moveToDir(path, dir)
+	if err != nil {
+		return fmt.Errorf("failed to move %s to %s: %w", path, dir, err)
+	}
+
+	if loadErr != nil {
+		if err := os.WriteFile(dest+".error", []byte(loadErr.Error()+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to record load error: %w", err)
+		}
+	}
+	fmt.Printf("Moved %s to %s\n", path, dir)
+	return nil
+}
+
+// moveToDir moves a file into a directory, adding a timestamp to its name if a
+// file with that name is already there, and returns its new path
+func moveToDir(path, dir string) (string, error) {
+	dest := filepath.Join(dir, filepath.Base(path))
+	if _, err := os.Stat(dest); err == nil {
+		dest = fmt.Sprintf("%s.%s", dest, time.Now().UTC().Format("20060102T150405.000000000"))
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	return dest, os.Rename(path, dest)
+}
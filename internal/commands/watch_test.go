@@ -0,0 +1,105 @@
+package commands
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// waitForFile waits until a file exists
+func waitForFile(t *testing.T, path string) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+	}
+	t.Fatalf("Expected %s to exist", path)
+}
+
+// TestWatchCommand tests loading dropped files and moving them away
+func TestWatchCommand(t *testing.T) {
+	tempDir := t.TempDir()
+	dropDir := filepath.Join(tempDir, "incoming")
+	dbFile := filepath.Join(tempDir, "test.db")
+	if err := os.Mkdir(dropDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	hour1 := "user_id,name\n1,a\n2,b\n"
+	if err := os.WriteFile(filepath.Join(dropDir, "hour1.csv"), []byte(hour1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dropDir, "notes.txt"), []byte("not a log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := NewWatchCommand()
+	cmd.SetArgs([]string{"--dir", dropDir, "--db", dbFile, "--table", "users", "--poll-interval", "10ms"})
+	cmd.SetOut(io.Discard)
+	cmd.SetErr(io.Discard)
+	done := make(chan error, 1)
+	go func() { done <- cmd.ExecuteContext(ctx) }()
+
+	waitForFile(t, filepath.Join(dropDir, "processed", "hour1.csv"))
+	waitForNames(t, dbFile, "a,b")
+
+	// A file that fails to load is moved to failed/ with the reason
+	if err := os.WriteFile(filepath.Join(dropDir, "hour2.csv"), []byte("user_id,name\n3,c\n4\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, filepath.Join(dropDir, "failed", "hour2.csv.error"))
+
+	// A second drop of the same content is not loaded again
+	if err := os.WriteFile(filepath.Join(dropDir, "hour1-again.csv"), []byte(hour1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dropDir, "hour3.csv"), []byte("user_id,name\n5,e\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitForFile(t, filepath.Join(dropDir, "processed", "hour3.csv"))
+	waitForFile(t, filepath.Join(dropDir, "processed", "hour1-again.csv"))
+	waitForNames(t, dbFile, "a,b,e")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	reason, err := os.ReadFile(filepath.Join(dropDir, "failed", "hour2.csv.error"))
+	if err != nil || !strings.Contains(string(reason), "line 3") {
+		t.Errorf("Expected the load error to be recorded, got %q, %v", reason, err)
+	}
+	if _, err := os.Stat(filepath.Join(dropDir, "notes.txt")); err != nil {
+		t.Errorf("Expected other files to be left alone: %v", err)
+	}
+}
+
+// TestScanDropDir tests that files are only ready once their size is stable
+func TestScanDropDir(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{"a.csv": "x\n1\n", ".hidden.csv": "x\n", "b.csv.part": "x\n"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sizes := make(map[string]int64)
+	if ready, _ := scanDropDir(dir, sizes); len(ready) != 0 {
+		t.Errorf("Expected no file ready at the first scan, got %v", ready)
+	}
+
+	// a.csv grows between scans, so it is not ready yet
+	appendToFile(t, filepath.Join(dir, "a.csv"), "2\n")
+	if ready, _ := scanDropDir(dir, sizes); len(ready) != 0 {
+		t.Errorf("Expected a growing file not to be ready, got %v", ready)
+	}
+	if ready, _ := scanDropDir(dir, sizes); len(ready) != 1 || ready[0] != "a.csv" {
+		t.Errorf("Expected a.csv to be ready, got %v", ready)
+	}
+}
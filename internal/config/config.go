@@ -22,4 +22,15 @@ const (
 	// Schema detection settings
 	SchemaDetectionSampleSize = 1000
 	TypeInferenceThreshold    = 0.8 // 80% of values must match for type assignment
+	InferenceExamples         = 3   // Values that do not match a type kept as examples per column
+
+	// Categorical column detection: a TEXT column whose sampled values are
+	// words taking at most MaxCategoricalValues distinct values, over at least
+	// CategoricalMinSamples values, is indexed and its values are shown
+	MaxCategoricalValues  = 10
+	CategoricalMinSamples = 50
+
+	// DefaultBatchSize is the number of records read and inserted at a time
+	// while streaming a file, which bounds memory usage during load
+	DefaultBatchSize = 1000
 )
@@ -0,0 +1,300 @@
+// Package database provides SQLite database operations for the server log analyzer
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// BatchColumn is the column of a data table that records the load batch each row came from
+// Rows loaded before load history was recorded have NULL in it
+const BatchColumn = "_batch_id"
+
+// Load batch statuses
+const (
+	BatchActive   = "active"   // The rows of the batch are in the table
+	BatchReplaced = "replaced" // A later load in replace mode cleared the table
+	BatchUnloaded = "unloaded" // The rows were removed with unload
+)
+
+// createLoadHistoryTables creates the tables recording every load
+// load_batches has one row per load run; load_batch_files one row per input file
+func createLoadHistoryTables(db Executor) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS load_batches (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		table_name TEXT NOT NULL,
+		mode TEXT NOT NULL,
+		schema TEXT NOT NULL,
+		row_count INTEGER NOT NULL DEFAULT 0,
+		rejected_count INTEGER NOT NULL DEFAULT 0,
+		status TEXT NOT NULL DEFAULT 'active',
+		loaded_at DATETIME NOT NULL,
+		unloaded_at DATETIME
+	);
+
+	CREATE TABLE IF NOT EXISTS load_batch_files (
+		batch_id INTEGER NOT NULL REFERENCES load_batches (id),
+		path TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		checksum TEXT NOT NULL,
+		row_count INTEGER NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_load_batches_table_name ON load_batches (table_name);
+	CREATE INDEX IF NOT EXISTS idx_load_batch_files_batch_id ON load_batch_files (batch_id);
+	`
+
+	if _, err := db.Exec(createSQL); err != nil {
+		return fmt.Errorf("failed to create load history tables: %w", err)
+	}
+	return nil
+}
+
+// LoadBatch describes one run of the load command
+type LoadBatch struct {
+	ID            int64
+	Table         string
+	Mode          string // "replace" or "append"
+	Schema        string // CREATE TABLE statement of the schema the rows were loaded with
+	RowCount      int64
+	RejectedCount int64
+	Status        string
+	LoadedAt      time.Time
+	UnloadedAt    *time.Time
+	Files         []LoadBatchFile
+}
+
+// LoadBatchFile describes one input file of a load batch
+type LoadBatchFile struct {
+	Path     string // "-" for standard input
+	Size     int64
+	Checksum string // SHA-256 of the file content, hex encoded
+	RowCount int64
+}
+
+// BeginLoadBatch records the start of a load into a table and returns the batch id
+// to store with every inserted row. In replace mode the earlier batches of the
+// table are marked as replaced and the offsets of followed files are forgotten.
+// Call it in the load's transaction, then FinishLoadBatch once the rows are inserted
+func BeginLoadBatch(db Executor, table, mode, schema string) (int64, error) {
+	if mode == "replace" {
+		updateSQL := "UPDATE load_batches SET status = ? WHERE table_name = ? AND status = ?"
+		if _, err := db.Exec(updateSQL, BatchReplaced, table, BatchActive); err != nil {
+			return 0, fmt.Errorf("failed to update load history: %w", err)
+		}
+		if _, err := db.Exec("DELETE FROM load_offsets WHERE table_name = ?", table); err != nil {
+			return 0, fmt.Errorf("failed to clear load offsets: %w", err)
+		}
+	}
+
+	insertSQL := "INSERT INTO load_batches (table_name, mode, schema, status, loaded_at) VALUES (?, ?, ?, ?, ?)"
+	result, err := db.Exec(insertSQL, table, mode, schema, BatchActive, time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to record load batch: %w", err)
+	}
+	return result.LastInsertId()
+}
+
+// FinishLoadBatch records the row counts and input files of a load batch
+func FinishLoadBatch(db Executor, batchID, rowCount, rejectedCount int64, files []LoadBatchFile) error {
+	updateSQL := "UPDATE load_batches SET row_count = ?, rejected_count = ? WHERE id = ?"
+	if _, err := db.Exec(updateSQL, rowCount, rejectedCount, batchID); err != nil {
+		return fmt.Errorf("failed to record load batch: %w", err)
+	}
+
+	for _, file := range files {
+		insertSQL := "INSERT INTO load_batch_files (batch_id, path, size, checksum, row_count) VALUES (?, ?, ?, ?, ?)"
+		if _, err := db.Exec(insertSQL, batchID, file.Path, file.Size, file.Checksum, file.RowCount); err != nil {
+			return fmt.Errorf("failed to record load batch file: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AddLoadBatchCounts adds to the row counts of a load batch that is loaded in
+// several transactions, such as the batch of 'load --follow'
+func AddLoadBatchCounts(db Executor, batchID, rowCount, rejectedCount int64) error {
+	updateSQL := "UPDATE load_batches SET row_count = row_count + ?, rejected_count = rejected_count + ? WHERE id = ?"
+	if _, err := db.Exec(updateSQL, rowCount, rejectedCount, batchID); err != nil {
+		return fmt.Errorf("failed to record load batch: %w", err)
+	}
+	return nil
+}
+
+// EnsureBatchColumn adds the batch column, and an index on it, to a data table
+// that does not have it yet, such as a table loaded by an older version
+func EnsureBatchColumn(db Executor, table string) error {
+	if err := addBatchColumn(db, table); err != nil {
+		return err
+	}
+
+	indexSQL := fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_%s ON %s (%s)", table, BatchColumn, table, BatchColumn)
+	if _, err := db.Exec(indexSQL); err != nil {
+		return fmt.Errorf("failed to create index: %w", err)
+	}
+	return nil
+}
+
+// addBatchColumn adds the batch column to a table that does not have it yet
+func addBatchColumn(db Executor, table string) error {
+	columns, err := tableColumnNames(db, table)
+	if err != nil {
+		return err
+	}
+	for _, name := range columns {
+		if name == BatchColumn {
+			return nil
+		}
+	}
+
+	alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s INTEGER", table, BatchColumn)
+	if _, err := db.Exec(alterSQL); err != nil {
+		return fmt.Errorf("failed to add column '%s': %w", BatchColumn, err)
+	}
+	return nil
+}
+
+// tableColumnNames returns the names of every column of a table, in table order
+func tableColumnNames(db Executor, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read table info: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+// ListLoadBatches returns the load batches, most recent first
+// An empty table name lists the batches of every table; files are not included
+func ListLoadBatches(db Executor, table string) ([]LoadBatch, error) {
+	if table == "" {
+		return queryLoadBatches(db, "")
+	}
+	return queryLoadBatches(db, "WHERE table_name = ?", table)
+}
+
+// queryLoadBatches reads the load batches matching a WHERE clause, most recent first
+// Databases last written before load history was recorded have no batches
+func queryLoadBatches(db Executor, where string, args ...interface{}) ([]LoadBatch, error) {
+	if history, err := ReadTableSchema(db, "load_batches"); err != nil || history == nil {
+		return nil, err
+	}
+
+	query := "SELECT id, table_name, mode, schema, row_count, rejected_count, status, loaded_at, unloaded_at FROM load_batches " +
+		where + " ORDER BY id DESC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load history: %w", err)
+	}
+	defer rows.Close()
+
+	var batches []LoadBatch
+	for rows.Next() {
+		var batch LoadBatch
+		var unloadedAt sql.NullTime
+		if err := rows.Scan(&batch.ID, &batch.Table, &batch.Mode, &batch.Schema, &batch.RowCount,
+			&batch.RejectedCount, &batch.Status, &batch.LoadedAt, &unloadedAt); err != nil {
+			return nil, fmt.Errorf("failed to read load history: %w", err)
+		}
+		if unloadedAt.Valid {
+			batch.UnloadedAt = &unloadedAt.Time
+		}
+		batches = append(batches, batch)
+	}
+	return batches, rows.Err()
+}
+
+// GetLoadBatch returns a load batch together with its files, or nil if there is no such batch
+func GetLoadBatch(db Executor, batchID int64) (*LoadBatch, error) {
+	batches, err := queryLoadBatches(db, "WHERE id = ?", batchID)
+	if err != nil || len(batches) == 0 {
+		return nil, err
+	}
+	batch := &batches[0]
+
+	rows, err := db.Query("SELECT path, size, checksum, row_count FROM load_batch_files WHERE batch_id = ? ORDER BY rowid", batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var file LoadBatchFile
+		if err := rows.Scan(&file.Path, &file.Size, &file.Checksum, &file.RowCount); err != nil {
+			return nil, fmt.Errorf("failed to read load history: %w", err)
+		}
+		batch.Files = append(batch.Files, file)
+	}
+	return batch, rows.Err()
+}
+
+// UnloadBatch deletes the rows a load batch inserted and marks it as unloaded
+// Only active batches can be unloaded; the rows of a replaced batch are already gone
+// It returns the batch and the number of rows deleted
+func UnloadBatch(db Executor, batchID int64) (*LoadBatch, int64, error) {
+	batch, err := GetLoadBatch(db, batchID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if batch == nil {
+		return nil, 0, fmt.Errorf("load batch %d not found", batchID)
+	}
+	if batch.Status != BatchActive {
+		return nil, 0, fmt.Errorf("load batch %d cannot be unloaded: it is %s", batchID, batch.Status)
+	}
+
+	deleteSQL := fmt.Sprintf("DELETE FROM %s WHERE %s = ?", batch.Table, BatchColumn)
+	result, err := db.Exec(deleteSQL, batchID)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to delete rows of load batch %d: %w", batchID, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to delete rows of load batch %d: %w", batchID, err)
+	}
+
+	updateSQL := "UPDATE load_batches SET status = ?, unloaded_at = ? WHERE id = ?"
+	if _, err := db.Exec(updateSQL, BatchUnloaded, time.Now().UTC(), batchID); err != nil {
+		return nil, 0, fmt.Errorf("failed to update load history: %w", err)
+	}
+
+	return batch, deleted, nil
+}
+
+// FindLoadedFile returns the id of the active load batch of a table that loaded
+// a file with the given checksum, or 0 if no batch still in the table did
+func FindLoadedFile(db Executor, table, checksum string) (int64, error) {
+	if history, err := ReadTableSchema(db, "load_batch_files"); err != nil || history == nil {
+		return 0, err
+	}
+
+	query := `SELECT b.id FROM load_batch_files f JOIN load_batches b ON b.id = f.batch_id
+		WHERE b.table_name = ? AND b.status = ? AND f.checksum = ? ORDER BY b.id DESC LIMIT 1`
+
+	rows, err := db.Query(query, table, BatchActive, checksum)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read load history: %w", err)
+	}
+	defer rows.Close()
+
+	var batchID int64
+	if rows.Next() {
+		if err := rows.Scan(&batchID); err != nil {
+			return 0, fmt.Errorf("failed to read load history: %w", err)
+		}
+	}
+	return batchID, rows.Err()
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// TestLoadBatches tests recording, listing and unloading load batches
+func TestLoadBatches(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	schema := &parser.TableSchema{
+		Name:    "test_table",
+		Columns: []parser.ColumnSchema{{Name: "name", Type: parser.TypeText}},
+	}
+	if err := CreateTableFromSchema(db, schema, false); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if err := EnsureBatchColumn(db, "test_table"); err != nil {
+		t.Fatalf("EnsureBatchColumn() error = %v", err)
+	}
+
+	// Two loads of two and one rows
+	load := func(mode string, names ...string) int64 {
+		batchID, err := BeginLoadBatch(db, "test_table", mode, schema.GenerateCreateTableSQL())
+		if err != nil {
+			t.Fatalf("BeginLoadBatch() error = %v", err)
+		}
+		records := make([][]string, len(names))
+		for i, name := range names {
+			records[i] = []string{name}
+		}
+		count, err := InsertRecords(db, "test_table", []string{"name"}, records, schema, InsertOptions{BatchID: batchID})
+		if err != nil {
+			t.Fatalf("InsertRecords() error = %v", err)
+		}
+		files := []LoadBatchFile{{Path: "/data/names.csv", Size: 42, Checksum: "abc123", RowCount: count}}
+		if err := FinishLoadBatch(db, batchID, count, 1, files); err != nil {
+			t.Fatalf("FinishLoadBatch() error = %v", err)
+		}
+		return batchID
+	}
+	first := load("replace", "alice", "bob")
+	second := load("append", "carol")
+
+	batches, err := ListLoadBatches(db, "test_table")
+	if err != nil {
+		t.Fatalf("ListLoadBatches() error = %v", err)
+	}
+	if len(batches) != 2 || batches[0].ID != second || batches[1].ID != first {
+		t.Fatalf("Expected batches %d and %d, most recent first, got %+v", second, first, batches)
+	}
+	if batches[1].RowCount != 2 || batches[1].RejectedCount != 1 || batches[1].Mode != "replace" || batches[1].Status != BatchActive {
+		t.Errorf("Unexpected first batch: %+v", batches[1])
+	}
+	if !strings.Contains(batches[1].Schema, "CREATE TABLE") {
+		t.Errorf("Expected the schema to be recorded, got %q", batches[1].Schema)
+	}
+
+	batch, err := GetLoadBatch(db, first)
+	if err != nil {
+		t.Fatalf("GetLoadBatch() error = %v", err)
+	}
+	if len(batch.Files) != 1 || batch.Files[0].Checksum != "abc123" || batch.Files[0].RowCount != 2 {
+		t.Errorf("Unexpected batch files: %+v", batch.Files)
+	}
+
+	// Files are found by checksum among the active batches of the table
+	if found, err := FindLoadedFile(db, "test_table", "abc123"); err != nil || found != second {
+		t.Errorf("Expected file found in batch %d, got %d, %v", second, found, err)
+	}
+	if found, _ := FindLoadedFile(db, "other_table", "abc123"); found != 0 {
+		t.Errorf("Expected file not found in another table, got batch %d", found)
+	}
+
+	// Unloading removes only the rows of that batch
+	_, deleted, err := UnloadBatch(db, first)
+	if err != nil {
+		t.Fatalf("UnloadBatch() error = %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("Expected 2 rows deleted, got %d", deleted)
+	}
+	results, err := ExecuteQuery(db, "SELECT name FROM test_table")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 1 || results[0]["name"] != "carol" {
+		t.Errorf("Expected only carol to remain, got %v", results)
+	}
+
+	batch, _ = GetLoadBatch(db, first)
+	if batch.Status != BatchUnloaded || batch.UnloadedAt == nil {
+		t.Errorf("Expected batch to be marked unloaded, got %+v", batch)
+	}
+	if _, _, err := UnloadBatch(db, first); err == nil || !strings.Contains(err.Error(), "it is unloaded") {
+		t.Errorf("Expected error unloading twice, got %v", err)
+	}
+	if _, _, err := UnloadBatch(db, 99); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+
+	// A replace load marks the earlier active batches as replaced
+	load("replace", "dave")
+	batch, _ = GetLoadBatch(db, second)
+	if batch.Status != BatchReplaced {
+		t.Errorf("Expected batch %d to be replaced, got %s", second, batch.Status)
+	}
+}
+
+// TestListLoadBatchesWithoutHistory tests databases without load history tables
+func TestListLoadBatchesWithoutHistory(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	batches, err := ListLoadBatches(db, "")
+	if err != nil || len(batches) != 0 {
+		t.Errorf("Expected no batches, got %v, %v", batches, err)
+	}
+	batch, err := GetLoadBatch(db, 1)
+	if err != nil || batch != nil {
+		t.Errorf("Expected no batch, got %v, %v", batch, err)
+	}
+}
+
+// TestEnsureBatchColumn tests adding the batch column to an existing table once
+func TestEnsureBatchColumn(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := setupLogsTable(db); err != nil {
+		t.Fatalf("Failed to setup logs table: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := EnsureBatchColumn(db, "logs"); err != nil {
+			t.Fatalf("EnsureBatchColumn() error = %v", err)
+		}
+	}
+
+	columns, err := tableColumnNames(db, "logs")
+	if err != nil {
+		t.Fatalf("tableColumnNames() error = %v", err)
+	}
+	if columns[len(columns)-1] != BatchColumn {
+		t.Errorf("Expected %s to be added, got columns %v", BatchColumn, columns)
+	}
+
+	// The batch column is not part of the table's detected schema
+	schema, err := ReadTableSchema(db, "logs")
+	if err != nil {
+		t.Fatalf("ReadTableSchema() error = %v", err)
+	}
+	if schema.Column(BatchColumn) != nil {
+		t.Errorf("Expected ReadTableSchema to leave out %s", BatchColumn)
+	}
+}
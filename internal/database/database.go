@@ -3,23 +3,35 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3" // SQLite driver
+	"github.com/mattn/go-sqlite3" // SQLite driver
 	"server-log-analyzer/internal/models"
 	"server-log-analyzer/internal/parser"
 )
 
+// maxSQLVariables is SQLite's limit on bound parameters per statement
+// Multi-row inserts are split so they never exceed it
+const maxSQLVariables = 32766
+
+// Executor is the set of operations shared by a database connection and a transaction
+// Schema and insert helpers accept an Executor so they can run inside a transaction
+type Executor interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Prepare(query string) (*sql.Stmt, error)
+}
+
 // DB interface defines database operations for easier testing and extensibility
 // This interface could be extended to support other database backends (PostgreSQL, MySQL, etc.)
 type DB interface {
+	Executor
 	Close() error
-	Query(query string, args ...interface{}) (*sql.Rows, error)
-	Exec(query string, args ...interface{}) (sql.Result, error)
-	Prepare(query string) (*sql.Stmt, error)
+	Begin() (*sql.Tx, error)
 }
 
 // sqliteDB implements the DB interface for SQLite
@@ -56,18 +68,43 @@ func InitializeWithLegacySchema(dbPath string) (DB, error) {
 		return nil, err
 	}
 
-	// Create tables if they don't exist
-	if err := createTables(db); err != nil {
+	// Create or upgrade the tables, including the legacy logs table
+	if err := migrate(db, true); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
 	return db, nil
 }
 
+// WithTransaction runs fn inside a single transaction
+// The transaction is committed if fn succeeds and rolled back if it returns an error,
+// so a failed load leaves the database exactly as it was, including any dropped table
+func WithTransaction(db DB, fn func(tx Executor) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback also failed: %v)", err, rbErr)
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
 // createTables sets up the database schema for the legacy logs table
 // The logs table is designed for efficient querying with appropriate indexes
-func createTables(db DB) error {
+// It is migration 1; databases created before migrations existed already
+// have the table, so every statement must be safe to run again
+func createTables(db Executor) error {
 	// Create the main logs table
 	// Using INTEGER PRIMARY KEY for id provides auto-increment functionality
 	// Indexes on commonly queried columns improve performance
@@ -98,7 +135,7 @@ func createTables(db DB) error {
 }
 
 // CreateTableFromSchema creates a table based on detected schema
-func CreateTableFromSchema(db DB, schema *parser.TableSchema, replaceMode bool) error {
+func CreateTableFromSchema(db Executor, schema *parser.TableSchema, replaceMode bool) error {
 	// Validate schema
 	if schema.Name == "" {
 		return fmt.Errorf("table name cannot be empty")
@@ -133,61 +170,202 @@ func CreateTableFromSchema(db DB, schema *parser.TableSchema, replaceMode bool)
 	return nil
 }
 
-// convertValue converts a string value to the appropriate type based on the column type
-func convertValue(value string, columnType parser.ColumnType) (interface{}, error) {
-	switch columnType {
-	case parser.TypeTimestamp:
-		// Use the same parsing logic as in csv.go
-		return parseTimestamp(value)
-	case parser.TypeInteger:
-		return strconv.Atoi(value)
-	case parser.TypeReal:
-		return strconv.ParseFloat(value, 64)
-	case parser.TypeBoolean:
-		return strconv.ParseBool(value)
-	case parser.TypeText:
-		fallthrough
-	default:
-		return value, nil
+// ReadTableSchema reads the schema of an existing table with PRAGMA table_info
+// The generated id and batch columns are left out. Declared types this tool does not create
+// are read as TEXT, and CHECK constraints are not reported by SQLite, so they
+// are not part of the result (a rebuild keeps them from the stored definition,
+// see EvolveTable). It returns nil if the table does not exist
+func ReadTableSchema(db Executor, tableName string) (*parser.TableSchema, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", tableName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	defer rows.Close()
+
+	schema := &parser.TableSchema{Name: tableName}
+	found := false
+	for rows.Next() {
+		var (
+			cid, notNull, pk int
+			name, sqlType    string
+			defaultValue     sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &sqlType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, fmt.Errorf("failed to read table info: %w", err)
+		}
+		found = true
+		if (pk > 0 && name == "id") || name == BatchColumn {
+			continue
+		}
+
+		columnType, err := parser.ParseColumnType(sqlType)
+		if err != nil {
+			columnType = parser.TypeText
+		}
+		schema.Columns = append(schema.Columns, parser.ColumnSchema{
+			Name:     name,
+			Type:     columnType,
+			Nullable: notNull == 0,
+			Default:  unquoteSQLLiteral(defaultValue.String),
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+
+	if !found {
+		return nil, nil
+	}
+	return schema, nil
+}
+
+// unquoteSQLLiteral turns a default value as reported by PRAGMA table_info,
+// e.g. 'o''hare' or 0, back into the plain value
+func unquoteSQLLiteral(literal string) string {
+	if len(literal) >= 2 && strings.HasPrefix(literal, "'") && strings.HasSuffix(literal, "'") {
+		return strings.ReplaceAll(literal[1:len(literal)-1], "''", "'")
 	}
+	return literal
 }
 
-// parseTimestamp converts a timestamp string to time.Time
-// This mirrors the logic from parser/csv.go to ensure consistency
-func parseTimestamp(timestampStr string) (interface{}, error) {
-	// First try to parse as UNIX timestamp
-	if timestamp, err := strconv.ParseInt(timestampStr, 10, 64); err == nil {
-		// Handle both second and millisecond precision
-		// If timestamp > year 2100 in seconds, assume it's milliseconds
-		if timestamp > 4102444800 { // January 1, 2100 in seconds
-			return time.Unix(timestamp/1000, (timestamp%1000)*1000000), nil
+// EvolveTable prepares an existing table to receive records of the detected schema
+// New columns are added with ALTER TABLE ADD COLUMN. SQLite cannot change the type
+// or nullability of a column in place, so when a column is widened or must allow
+// NULL the table is rebuilt: copied into a new table created from its stored
+// definition with only those columns changed, which then replaces it, keeping
+// its CHECK constraints and indexes
+// It returns the evolved table schema and the differences found (see
+// parser.EvolveSchema), or a nil schema if the table does not exist yet
+func EvolveTable(db Executor, detected *parser.TableSchema) (*parser.TableSchema, []parser.SchemaChange, error) {
+	existing, err := ReadTableSchema(db, detected.Name)
+	if err != nil || existing == nil {
+		return nil, nil, err
+	}
+
+	evolved, changes := parser.EvolveSchema(existing, detected)
+
+	rebuild := false
+	for i, col := range existing.Columns {
+		if evolved.Columns[i].Type != col.Type || evolved.Columns[i].Nullable != col.Nullable {
+			rebuild = true
 		}
-		return time.Unix(timestamp, 0), nil
 	}
 
-	// Try multiple timestamp formats
-	timestampFormats := []string{
-		time.RFC3339,                     // 2006-01-02T15:04:05Z07:00
-		"2006-01-02 15:04:05",           // 2020-04-15 10:00:00
-		"2006-01-02T15:04:05",           // 2020-04-15T10:00:00
-		"2006-01-02 15:04:05.000",       // 2020-04-15 10:00:00.000
-		"01/02/2006 15:04:05",           // 04/15/2020 10:00:00
-		"2006-01-02",                    // 2023-01-15
-		"Mon Jan 2 15:04:05 MST 2006",   // Sun Apr 12 22:10:38 UTC 2020
-		"Mon Jan 2 15:04:05 2006",       // Sun Apr 12 22:10:38 2020
+	if rebuild {
+		if err := rebuildTable(db, existing, evolved); err != nil {
+			return nil, nil, err
+		}
+		return evolved, changes, nil
 	}
 
-	for _, format := range timestampFormats {
-		if t, err := time.Parse(format, timestampStr); err == nil {
-			return t, nil
+	for _, col := range evolved.Columns[len(existing.Columns):] {
+		alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", evolved.Name, col.SQLDefinition())
+		if _, err := db.Exec(alterSQL); err != nil {
+			return nil, nil, fmt.Errorf("failed to add column '%s': %w", col.Name, err)
 		}
 	}
 
-	return nil, fmt.Errorf("timestamp format not recognized, expected UNIX timestamp or common date formats like '2006-01-02 15:04:05', '2006-01-02', or 'Mon Jan 2 15:04:05 MST 2006'")
+	return evolved, changes, nil
+}
+
+// rebuildTable replaces a table with one created from its stored definition
+// rewritten for the evolved schema (see evolvedTableSQL), copying every row (including its id and batch) and recreating the table's indexes
+// Run it inside a transaction so a failure leaves the original table in place
+func rebuildTable(db Executor, existing, evolved *parser.TableSchema) error {
+	indexSQL, err := tableIndexSQL(db, existing.Name)
+	if err != nil {
+		return err
+	}
+	existingColumns, err := tableColumnNames(db, existing.Name)
+	if err != nil {
+		return err
+	}
+
+	// The stored definition keeps the CHECK constraints and generated columns,
+	// which PRAGMA table_info does not report
+	definition, err := tableDefinition(db, existing.Name)
+	if err != nil {
+		return err
+	}
+	rebuiltName := evolved.Name + "_rebuild"
+	createSQL, err := evolvedTableSQL(definition, rebuiltName, existing, evolved)
+	if err != nil {
+		return err
+	}
+
+	statements := []string{
+		fmt.Sprintf("DROP TABLE IF EXISTS %s", rebuiltName),
+		createSQL,
+	}
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("failed to rebuild table '%s': %w", existing.Name, err)
+		}
+	}
+	if err := addBatchColumn(db, rebuiltName); err != nil {
+		return err
+	}
+
+	// Copy every column the rebuilt table still has
+	rebuiltColumns, err := tableColumnNames(db, rebuiltName)
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for _, name := range existingColumns {
+		if slices.Contains(rebuiltColumns, name) {
+			columns = append(columns, name)
+		}
+	}
+
+	statements = []string{
+		fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s",
+			rebuiltName, strings.Join(columns, ", "), strings.Join(columns, ", "), existing.Name),
+		fmt.Sprintf("DROP TABLE %s", existing.Name),
+		fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuiltName, evolved.Name),
+	}
+	statements = append(statements, indexSQL...)
+
+	for _, statement := range statements {
+		if _, err := db.Exec(statement); err != nil {
+			return fmt.Errorf("failed to rebuild table '%s': %w", existing.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// tableIndexSQL returns the CREATE INDEX statements of the indexes on a table
+// Indexes SQLite creates automatically have no statement and are left out
+func tableIndexSQL(db Executor, tableName string) ([]string, error) {
+	rows, err := db.Query("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", tableName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer rows.Close()
+
+	var statements []string
+	for rows.Next() {
+		var statement string
+		if err := rows.Scan(&statement); err != nil {
+			return nil, fmt.Errorf("failed to read indexes: %w", err)
+		}
+		statements = append(statements, statement)
+	}
+	return statements, rows.Err()
+}
+
+// convertValue converts a string value to the appropriate type based on the column type
+// It uses the conversions of schema detection, so every value that made a column
+// take its inferred type converts to that type
+func convertValue(value string, columnType parser.ColumnType, loc *time.Location) (interface{}, error) {
+	return parser.ParseValue(value, columnType, loc)
 }
 
 // InsertRecords inserts CSV records using dynamic schema with proper type conversion
-func InsertRecords(db DB, tableName string, headers []string, records [][]string, schema *parser.TableSchema) (int64, error) {
+// Records are written with multi-row INSERT statements; wrap the call in
+// WithTransaction to make a load atomic and avoid a disk sync per statement
+func InsertRecords(db Executor, tableName string, headers []string, records [][]string, schema *parser.TableSchema, opts InsertOptions) (int64, error) {
 	if len(records) == 0 {
 		return 0, nil
 	}
@@ -200,91 +378,276 @@ func InsertRecords(db DB, tableName string, headers []string, records [][]string
 		return 0, fmt.Errorf("schema is required for type conversion")
 	}
 
-	// Build INSERT statement with placeholders
-	placeholders := make([]string, len(headers))
-	for i := range placeholders {
-		placeholders[i] = "?"
+	// Convert every record before touching the database
+	rows := make([][]interface{}, len(records))
+	for i, record := range records {
+		args, err := convertRecord(record, headers, schema, opts)
+		if err != nil {
+			return 0, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		rows[i] = args
 	}
 
-	insertSQL := fmt.Sprintf(
-		"INSERT INTO %s (%s) VALUES (%s)",
-		tableName,
-		strings.Join(headers, ", "),
-		strings.Join(placeholders, ", "),
-	)
+	inserted, _, err := insertRows(db, tableName, insertColumns(headers, opts.BatchID), rows, opts.DedupeKey)
+	return inserted, err
+}
 
-	stmt, err := db.Prepare(insertSQL)
-	if err != nil {
-		return 0, fmt.Errorf("failed to prepare insert statement: %w", err)
+// InsertOptions controls how the insert functions write rows
+type InsertOptions struct {
+	// BatchID, if non-zero, is stored in the batch column of every row (see BeginLoadBatch)
+	BatchID int64
+
+	// DedupeKey lists the columns of a unique index created by EnsureDedupeKey
+	// Rows whose key matches an existing row are skipped rather than rejected,
+	// so the number of rows inserted can be lower than the number given
+	DedupeKey []string
+
+	// Location is the time zone of timestamps written without one (nil = UTC)
+	Location *time.Location
+}
+
+// RecordError describes a single record rejected by InsertRecordsSkippingErrors
+type RecordError struct {
+	Index  int      // Position of the record in the slice passed to the insert
+	Record []string // The raw record as read from the input
+	Err    error    // Why the record was rejected
+}
+
+// Error implements the error interface
+func (e *RecordError) Error() string {
+	return fmt.Sprintf("record %d: %v", e.Index+1, e.Err)
+}
+
+// Unwrap returns the underlying cause
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// InsertRecordsSkippingErrors inserts records like InsertRecords, but instead of failing
+// on the first bad record it skips records that cannot be converted or that violate a
+// table constraint and returns them as RecordErrors
+// Any other failure (I/O, missing table, ...) is still returned as an error
+// Duplicates skipped because of opts.DedupeKey are neither inserted nor rejected
+func InsertRecordsSkippingErrors(db Executor, tableName string, headers []string, records [][]string, schema *parser.TableSchema, opts InsertOptions) (int64, []RecordError, error) {
+	if len(records) == 0 {
+		return 0, nil, nil
 	}
-	defer stmt.Close()
 
-	var insertedCount int64
+	if len(headers) == 0 {
+		return 0, nil, fmt.Errorf("no headers provided")
+	}
+
+	if schema == nil {
+		return 0, nil, fmt.Errorf("schema is required for type conversion")
+	}
+
+	var rejected []RecordError
+	rows := make([][]interface{}, 0, len(records))
+	indexes := make([]int, 0, len(records)) // Original position of each converted row
 
 	for i, record := range records {
-		// Ensure record has the right number of fields
-		if len(record) != len(headers) {
-			return insertedCount, fmt.Errorf("record %d has %d fields, expected %d", i+1, len(record), len(headers))
+		args, err := convertRecord(record, headers, schema, opts)
+		if err != nil {
+			rejected = append(rejected, RecordError{Index: i, Record: record, Err: err})
+			continue
 		}
+		rows = append(rows, args)
+		indexes = append(indexes, i)
+	}
 
-		// Convert record to interface{} slice with proper type conversion
-		args := make([]interface{}, len(record))
-		for j, value := range record {
-			// Convert empty strings to NULL for non-text columns
-			if value == "" {
-				args[j] = nil
-			} else {
-				// Apply type conversion based on schema
-				convertedValue, err := convertValue(value, schema.Columns[j].Type)
-				if err != nil {
-					return insertedCount, fmt.Errorf("failed to convert value '%s' for column '%s' (type %s) in record %d: %w",
-						value, headers[j], schema.Columns[j].Type.String(), i+1, err)
-				}
-				args[j] = convertedValue
+	if len(rows) == 0 {
+		return 0, rejected, nil
+	}
+	columns := insertColumns(headers, opts.BatchID)
+
+	// Fast path: the whole batch goes in with multi-row statements
+	// A failed statement is rolled back on its own, so nothing is left half-written
+	insertedCount, written, err := insertRows(db, tableName, columns, rows, opts.DedupeKey)
+	if err == nil {
+		return insertedCount, rejected, nil
+	}
+	if !isRecordLevelError(err) {
+		return 0, rejected, err
+	}
+
+	// Slow path: some row violates a constraint, so insert the rest of the
+	// batch one row at a time to find out which. Statements before the
+	// failing one succeeded, so resume from where the fast path stopped
+	for i := written; i < len(rows); i++ {
+		row := rows[i]
+		inserted, _, err := insertRows(db, tableName, columns, [][]interface{}{row}, opts.DedupeKey)
+		if err != nil {
+			if !isRecordLevelError(err) {
+				return insertedCount, rejected, err
+			}
+			rejected = append(rejected, RecordError{Index: indexes[i], Record: records[indexes[i]], Err: err})
+			continue
+		}
+		insertedCount += inserted
+	}
+
+	return insertedCount, rejected, nil
+}
+
+// convertRecord converts the fields of a record to the types declared in the schema
+// A non-zero opts.BatchID is appended as the value of the batch column
+func convertRecord(record []string, headers []string, schema *parser.TableSchema, opts InsertOptions) ([]interface{}, error) {
+	// Ensure record has the right number of fields
+	if len(record) != len(headers) {
+		return nil, fmt.Errorf("has %d fields, expected %d", len(record), len(headers))
+	}
+
+	// Convert record to interface{} slice with proper type conversion
+	args := make([]interface{}, len(record), len(record)+1)
+	for j, value := range record {
+		// Empty values take the column default, if any; so do blank values
+		// of non-TEXT columns, which schema detection counts as empty
+		if value == "" || (schema.Columns[j].Type != parser.TypeText && strings.TrimSpace(value) == "") {
+			value = schema.Columns[j].Default
+		}
+
+		// Convert empty strings to NULL for non-text columns
+		if value == "" {
+			args[j] = nil
+		} else {
+			// Apply type conversion based on schema
+			convertedValue, err := convertValue(value, schema.Columns[j].Type, opts.Location)
+			if err != nil {
+				return nil, fmt.Errorf("failed to convert value '%s' for column '%s' (type %s): %w",
+					value, headers[j], schema.Columns[j].Type.String(), err)
+			}
+			args[j] = convertedValue
+		}
+
+		if rules := schema.Columns[j].Rules; rules != nil {
+			if err := rules.Validate(value, args[j]); err != nil {
+				return nil, fmt.Errorf("column '%s': %w", headers[j], err)
 			}
 		}
 
-		if _, err := stmt.Exec(args...); err != nil {
-			return insertedCount, fmt.Errorf("failed to insert record %d: %w", i+1, err)
+		// Timestamps are stored as UTC text in one sortable format
+		if t, ok := args[j].(time.Time); ok {
+			args[j] = parser.FormatTimestamp(t)
 		}
-		insertedCount++
 	}
 
-	return insertedCount, nil
+	if opts.BatchID != 0 {
+		args = append(args, opts.BatchID)
+	}
+	return args, nil
+}
+
+// insertColumns returns the columns written for records of the given headers,
+// including the batch column when rows are loaded as part of a batch
+func insertColumns(headers []string, batchID int64) []string {
+	if batchID == 0 {
+		return headers
+	}
+	return append(slices.Clip(headers), BatchColumn)
+}
+
+// isRecordLevelError reports whether an insert failed because of the data in a
+// row (constraint violation or type mismatch) rather than a database problem
+func isRecordLevelError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrConstraint || sqliteErr.Code == sqlite3.ErrMismatch
+	}
+	return false
+}
+
+// insertRows writes already-converted rows using as few INSERT statements as
+// SQLite's parameter limit allows. With a dedupe key, rows conflicting with an
+// existing row on those columns are skipped
+// It returns the number of rows inserted and the number of rows written by the
+// statements that succeeded, which differ when duplicates were skipped
+func insertRows(db Executor, tableName string, columns []string, rows [][]interface{}, dedupeKey []string) (int64, int, error) {
+	rowsPerStatement := maxSQLVariables / len(columns)
+
+	// Build the placeholder group for one row, e.g. (?, ?, ?)
+	placeholders := make([]string, len(columns))
+	for i := range placeholders {
+		placeholders[i] = "?"
+	}
+	rowPlaceholder := "(" + strings.Join(placeholders, ", ") + ")"
+
+	// Only conflicts on the dedupe key are ignored; other constraint
+	// violations still fail the statement
+	var conflict string
+	if len(dedupeKey) > 0 {
+		conflict = fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", strings.Join(dedupeKey, ", "))
+	}
+
+	var insertedCount int64
+
+	for start := 0; start < len(rows); start += rowsPerStatement {
+		end := min(start+rowsPerStatement, len(rows))
+		chunk := rows[start:end]
+
+		values := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*len(columns))
+		for i, row := range chunk {
+			values[i] = rowPlaceholder
+			args = append(args, row...)
+		}
+
+		insertSQL := fmt.Sprintf(
+			"INSERT INTO %s (%s) VALUES %s%s",
+			tableName,
+			strings.Join(columns, ", "),
+			strings.Join(values, ", "),
+			conflict,
+		)
+
+		result, err := db.Exec(insertSQL, args...)
+		if err != nil {
+			return insertedCount, start, fmt.Errorf("failed to insert records %d-%d: %w", start+1, end, err)
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return insertedCount, start, fmt.Errorf("failed to insert records %d-%d: %w", start+1, end, err)
+		}
+		insertedCount += inserted
+	}
+
+	return insertedCount, len(rows), nil
+}
+
+// ClearTable deletes every row of a table
+func ClearTable(db Executor, tableName string) error {
+	if _, err := db.Exec(fmt.Sprintf("DELETE FROM %s", tableName)); err != nil {
+		return fmt.Errorf("failed to clear existing data: %w", err)
+	}
+	return nil
 }
 
 // InsertLogEntries bulk inserts log entries into the database
-// Uses a transaction for better performance and data consistency
 // If appendMode is false, existing data will be cleared before insertion
-func InsertLogEntries(db DB, entries []models.LogEntry, appendMode bool, tableName string) (int64, error) {
+// Wrap the call in WithTransaction so the clear and the inserts succeed or fail together
+func InsertLogEntries(db Executor, entries []models.LogEntry, appendMode bool, tableName string, opts InsertOptions) (int64, error) {
 	if len(entries) == 0 {
 		return 0, nil
 	}
 
 	// Clear existing data for fresh import (unless in append mode)
 	if !appendMode {
-		clearSQL := fmt.Sprintf("DELETE FROM %s", tableName)
-		_, err := db.Exec(clearSQL)
-		if err != nil {
-			return 0, fmt.Errorf("failed to clear existing data: %w", err)
+		if err := ClearTable(db, tableName); err != nil {
+			return 0, err
 		}
 	}
 
-	// Prepare the insert statement
-	insertSQL := fmt.Sprintf(`
-	INSERT INTO %s (timestamp, username, operation, size)
-	VALUES (?, ?, ?, ?)
-	`, tableName)
-
-	// Insert entries in a transaction for better performance
-	// Note: For very large datasets, you might want to batch the inserts
-	var insertedCount int64
-	for _, entry := range entries {
-		_, err := db.Exec(insertSQL, entry.Timestamp, entry.Username, entry.Operation, entry.Size)
-		if err != nil {
-			return insertedCount, fmt.Errorf("failed to insert entry: %w", err)
+	rows := make([][]interface{}, len(entries))
+	for i, entry := range entries {
+		rows[i] = []interface{}{parser.FormatTimestamp(entry.Timestamp), entry.Username, entry.Operation, entry.Size}
+		if opts.BatchID != 0 {
+			rows[i] = append(rows[i], opts.BatchID)
 		}
-		insertedCount++
+	}
+
+	columns := insertColumns([]string{"timestamp", "username", "operation", "size"}, opts.BatchID)
+	insertedCount, _, err := insertRows(db, tableName, columns, rows, opts.DedupeKey)
+	if err != nil {
+		return insertedCount, fmt.Errorf("failed to insert entry: %w", err)
 	}
 
 	return insertedCount, nil
@@ -292,8 +655,41 @@ func InsertLogEntries(db DB, entries []models.LogEntry, appendMode bool, tableNa
 
 // ExecuteQuery executes a SQL query and returns results as a slice of maps
 // This generic approach allows for flexible query results without predefined structs
-func ExecuteQuery(db DB, query string) ([]map[string]interface{}, error) {
-	rows, err := db.Query(query)
+// The args are the values of the query's ? parameters, if any
+func ExecuteQuery(db DB, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	result, err := ExecuteQueryResult(db, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create a map for each row, with BLOBs as strings
+	var results []map[string]interface{}
+	for _, values := range result.Rows {
+		row := make(map[string]interface{})
+		for i, column := range result.Columns {
+			if b, ok := values[i].([]byte); ok {
+				row[column] = string(b)
+			} else {
+				row[column] = values[i]
+			}
+		}
+		results = append(results, row)
+	}
+	return results, nil
+}
+
+// QueryResult holds the rows of a query, with the columns in the order of
+// its SELECT list. NULL values are nil
+type QueryResult struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// ExecuteQueryResult executes a SQL query and returns its columns and rows in order
+// Values are int64, float64, bool, string, []byte for BLOBs or nil; timestamps
+// are shown as stored
+func ExecuteQueryResult(db DB, query string, args ...interface{}) (*QueryResult, error) {
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("query execution failed: %w", err)
 	}
@@ -304,9 +700,7 @@ func ExecuteQuery(db DB, query string) ([]map[string]interface{}, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to get columns: %w", err)
 	}
-
-	// Prepare result slice
-	var results []map[string]interface{}
+	result := &QueryResult{Columns: columns}
 
 	// Process each row
 	for rows.Next() {
@@ -323,18 +717,14 @@ func ExecuteQuery(db DB, query string) ([]map[string]interface{}, error) {
 			return nil, fmt.Errorf("failed to scan row: %w", err)
 		}
 
-		// Create map for this row
-		row := make(map[string]interface{})
-		for i, column := range columns {
-			// Handle NULL values and convert byte slices to strings
-			val := values[i]
-			if b, ok := val.([]byte); ok {
-				val = string(b)
+		for i, val := range values {
+			// The driver reads DATETIME columns back as times; show them as stored
+			if t, ok := val.(time.Time); ok {
+				values[i] = parser.FormatTimestamp(t)
 			}
-			row[column] = val
 		}
 
-		results = append(results, row)
+		result.Rows = append(result.Rows, values)
 	}
 
 	// Check for iteration errors
@@ -342,5 +732,5 @@ func ExecuteQuery(db DB, query string) ([]map[string]interface{}, error) {
 		return nil, fmt.Errorf("error during row iteration: %w", err)
 	}
 
-	return results, nil
+	return result, nil
 }
@@ -1,8 +1,10 @@
 package database
 
 import (
+	"bytes"
 	"fmt"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -126,7 +128,7 @@ func TestInsertLogEntries(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			inserted, err := InsertLogEntries(db, tt.entries, false, "logs")
+			inserted, err := InsertLogEntries(db, tt.entries, false, "logs", InsertOptions{})
 
 			if (err != nil) != tt.wantErr {
 				t.Errorf("InsertLogEntries() error = %v, wantErr %v", err, tt.wantErr)
@@ -185,7 +187,7 @@ func TestInsertLogEntriesAppendMode(t *testing.T) {
 	}
 
 	// Insert first batch (replace mode - should clear any existing data)
-	count1, err := InsertLogEntries(db, firstBatch, false, "logs")
+	count1, err := InsertLogEntries(db, firstBatch, false, "logs", InsertOptions{})
 	if err != nil {
 		t.Fatalf("Failed to insert first batch: %v", err)
 	}
@@ -213,7 +215,7 @@ func TestInsertLogEntriesAppendMode(t *testing.T) {
 	}
 
 	// Insert second batch in append mode
-	count2, err := InsertLogEntries(db, secondBatch, true, "logs")
+	count2, err := InsertLogEntries(db, secondBatch, true, "logs", InsertOptions{})
 	if err != nil {
 		t.Fatalf("Failed to insert second batch in append mode: %v", err)
 	}
@@ -256,7 +258,7 @@ func TestInsertLogEntriesAppendMode(t *testing.T) {
 		},
 	}
 
-	count3, err := InsertLogEntries(db, thirdBatch, false, "logs")
+	count3, err := InsertLogEntries(db, thirdBatch, false, "logs", InsertOptions{})
 	if err != nil {
 		t.Fatalf("Failed to insert third batch in replace mode: %v", err)
 	}
@@ -282,6 +284,93 @@ func TestInsertLogEntriesAppendMode(t *testing.T) {
 	}
 }
 
+// TestWithTransaction tests that loads commit on success and roll back on failure
+func TestWithTransaction(t *testing.T) {
+	db, err := Initialize(filepath.Join(t.TempDir(), "tx.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := setupLogsTable(db); err != nil {
+		t.Fatalf("Failed to setup logs table: %v", err)
+	}
+
+	entries := []models.LogEntry{
+		{Timestamp: time.Unix(1587772800, 0), Username: "user1", Operation: "upload", Size: 100},
+		{Timestamp: time.Unix(1587772900, 0), Username: "user2", Operation: "download", Size: 200},
+	}
+
+	// Successful transaction commits its rows
+	err = WithTransaction(db, func(tx Executor) error {
+		_, err := InsertLogEntries(tx, entries, false, "logs", InsertOptions{})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction() unexpected error: %v", err)
+	}
+
+	// Failing transaction rolls back the drop, the new table and its rows
+	schema := parser.TableSchema{
+		Name:    "logs",
+		Columns: []parser.ColumnSchema{{Name: "other", Type: parser.TypeText}},
+	}
+	err = WithTransaction(db, func(tx Executor) error {
+		if err := CreateTableFromSchema(tx, &schema, true); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO logs (other) VALUES ('x')"); err != nil {
+			return err
+		}
+		return fmt.Errorf("simulated failure")
+	})
+	if err == nil || !strings.Contains(err.Error(), "simulated failure") {
+		t.Fatalf("WithTransaction() error = %v, want simulated failure", err)
+	}
+
+	results, err := ExecuteQuery(db, "SELECT COUNT(*) as count FROM logs WHERE username IS NOT NULL")
+	if err != nil {
+		t.Fatalf("Original table was not restored: %v", err)
+	}
+	if count := results[0]["count"].(int64); count != 2 {
+		t.Errorf("Expected 2 rows after rollback, got %d", count)
+	}
+}
+
+// TestInsertRecordsLargeBatch tests that batches larger than SQLite's
+// parameter limit are split across several statements
+func TestInsertRecordsLargeBatch(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := parser.TableSchema{
+		Name: "wide",
+		Columns: []parser.ColumnSchema{
+			{Name: "a", Type: parser.TypeInteger},
+			{Name: "b", Type: parser.TypeText},
+		},
+	}
+	if err := CreateTableFromSchema(db, &schema, false); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	records := make([][]string, maxSQLVariables)
+	for i := range records {
+		records[i] = []string{fmt.Sprint(i), "value"}
+	}
+
+	count, err := InsertRecords(db, "wide", []string{"a", "b"}, records, &schema, InsertOptions{})
+	if err != nil {
+		t.Fatalf("InsertRecords() unexpected error: %v", err)
+	}
+	if count != int64(len(records)) {
+		t.Errorf("InsertRecords() inserted %d, want %d", count, len(records))
+	}
+}
+
 // TestExecuteQuery tests SQL query execution
 func TestExecuteQuery(t *testing.T) {
 	db, err := Initialize(":memory:")
@@ -316,7 +405,7 @@ func TestExecuteQuery(t *testing.T) {
 			Size:      75,
 		},
 	}
-	_, err = InsertLogEntries(db, testEntries, false, "logs")
+	_, err = InsertLogEntries(db, testEntries, false, "logs", InsertOptions{})
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -545,7 +634,7 @@ func BenchmarkInsertLogEntries(b *testing.B) {
 
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		_, err := InsertLogEntries(db, entries, false, "logs")
+		_, err := InsertLogEntries(db, entries, false, "logs", InsertOptions{})
 		if err != nil {
 			b.Fatal(err)
 		}
@@ -575,7 +664,7 @@ func BenchmarkExecuteQuery(b *testing.B) {
 			Size:      i * 10,
 		}
 	}
-	_, err = InsertLogEntries(db, entries, false, "logs")
+	_, err = InsertLogEntries(db, entries, false, "logs", InsertOptions{})
 	if err != nil {
 		b.Fatal(err)
 	}
@@ -615,7 +704,7 @@ func ExampleInitialize() {
 		},
 	}
 
-	count, err := InsertLogEntries(db, entries, false, "logs")
+	count, err := InsertLogEntries(db, entries, false, "logs", InsertOptions{})
 	if err != nil {
 		return
 	}
@@ -785,6 +874,286 @@ func TestCreateTableFromSchemaReplaceMode(t *testing.T) {
 	}
 }
 
+// TestReadTableSchema tests reading the schema of an existing table
+func TestReadTableSchema(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := &parser.TableSchema{
+		Name: "test_table",
+		Columns: []parser.ColumnSchema{
+			{Name: "created", Type: parser.TypeTimestamp, Index: true},
+			{Name: "size", Type: parser.TypeReal, Nullable: true},
+			{Name: "region", Type: parser.TypeText, Default: "o'hare"},
+		},
+	}
+	if err := CreateTableFromSchema(db, schema, false); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	got, err := ReadTableSchema(db, "test_table")
+	if err != nil {
+		t.Fatalf("ReadTableSchema() error = %v", err)
+	}
+	want := []parser.ColumnSchema{
+		{Name: "created", Type: parser.TypeTimestamp},
+		{Name: "size", Type: parser.TypeReal, Nullable: true},
+		{Name: "region", Type: parser.TypeText, Default: "o'hare"},
+	}
+	if !reflect.DeepEqual(got.Columns, want) {
+		t.Errorf("Columns = %+v, want %+v", got.Columns, want)
+	}
+
+	missing, err := ReadTableSchema(db, "no_such_table")
+	if err != nil || missing != nil {
+		t.Errorf("Expected nil schema for a missing table, got %+v, %v", missing, err)
+	}
+}
+
+// TestEvolveTable tests adapting an existing table to a detected schema
+func TestEvolveTable(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := &parser.TableSchema{
+		Name: "test_table",
+		Columns: []parser.ColumnSchema{
+			{Name: "username", Type: parser.TypeText, Index: true},
+			{Name: "size", Type: parser.TypeInteger},
+		},
+	}
+	if err := CreateTableFromSchema(db, schema, false); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO test_table (username, size) VALUES ('alice', 10)"); err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+
+	// A new column only needs ALTER TABLE
+	detected := &parser.TableSchema{
+		Name: "test_table",
+		Columns: []parser.ColumnSchema{
+			{Name: "size", Type: parser.TypeInteger},
+			{Name: "username", Type: parser.TypeText},
+			{Name: "region", Type: parser.TypeText},
+		},
+	}
+	table, changes, err := EvolveTable(db, detected)
+	if err != nil {
+		t.Fatalf("EvolveTable() error = %v", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != parser.ColumnAdded || len(table.Columns) != 3 {
+		t.Errorf("Expected one added column, got changes %+v, columns %+v", changes, table.Columns)
+	}
+	if _, err := db.Exec("INSERT INTO test_table (username, size, region) VALUES ('bob', 20, 'eu')"); err != nil {
+		t.Fatalf("Failed to insert into evolved table: %v", err)
+	}
+
+	// Widening a type and allowing NULL rebuilds the table
+	detected.Columns[0] = parser.ColumnSchema{Name: "size", Type: parser.TypeReal, Nullable: true}
+	table, changes, err = EvolveTable(db, detected)
+	if err != nil {
+		t.Fatalf("EvolveTable() error = %v", err)
+	}
+	if len(changes) != 2 || table.Column("size").Type != parser.TypeReal {
+		t.Errorf("Expected size widened to REAL, got changes %+v, columns %+v", changes, table.Columns)
+	}
+	if _, err := db.Exec("INSERT INTO test_table (username, size, region) VALUES ('carol', NULL, NULL), ('dave', 1.5, 'us')"); err != nil {
+		t.Fatalf("Failed to insert into rebuilt table: %v", err)
+	}
+
+	results, err := ExecuteQuery(db, "SELECT id, username, size, region FROM test_table ORDER BY id")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Expected 4 rows, got %d: %v", len(results), results)
+	}
+	if results[0]["id"] != int64(1) || results[0]["username"] != "alice" || results[0]["size"] != float64(10) {
+		t.Errorf("Expected the first row to be kept with its id, got %v", results[0])
+	}
+	if results[3]["size"] != 1.5 {
+		t.Errorf("Expected size 1.5, got %v", results[3]["size"])
+	}
+
+	// The index survives the rebuild
+	indexes, err := ExecuteQuery(db, "SELECT name FROM sqlite_master WHERE type = 'index' AND name = 'idx_test_table_username'")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(indexes) != 1 {
+		t.Error("Expected index idx_test_table_username to be recreated")
+	}
+
+	// Nothing to do for a table that does not exist
+	detected.Name = "new_table"
+	if table, _, err := EvolveTable(db, detected); err != nil || table != nil {
+		t.Errorf("Expected nil schema for a missing table, got %+v, %v", table, err)
+	}
+}
+
+// TestEvolveTableKeepsConstraints tests that a rebuild keeps the CHECK
+// constraints of the table, which PRAGMA table_info does not report
+func TestEvolveTableKeepsConstraints(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(db DB) error
+		detected *parser.TableSchema
+		valid    string
+		invalid  []string
+	}{
+		{
+			name:  "legacy logs table",
+			setup: func(db DB) error { return migrate(db, true) },
+			detected: &parser.TableSchema{
+				Name: "logs",
+				Columns: []parser.ColumnSchema{
+					{Name: "timestamp", Type: parser.TypeTimestamp},
+					{Name: "username", Type: parser.TypeText},
+					{Name: "operation", Type: parser.TypeText},
+					{Name: "size", Type: parser.TypeInteger, Nullable: true},
+				},
+			},
+			valid: "INSERT INTO logs (timestamp, username, operation, size) VALUES ('2020-04-15 10:00:00', 'jeff22', 'upload', NULL)",
+			invalid: []string{
+				"INSERT INTO logs (timestamp, username, operation, size) VALUES ('2020-04-15 10:00:00', 'jeff22', 'hack', 1)",
+				"INSERT INTO logs (timestamp, username, operation, size) VALUES ('2020-04-15 10:00:00', 'jeff22', 'upload', -5)",
+				"INSERT INTO logs (timestamp, username, operation, size) VALUES ('2020-04-15 10:00:00', NULL, 'upload', 1)",
+			},
+		},
+		{
+			name: "declared checks and rules",
+			setup: func(db DB) error {
+				return CreateTableFromSchema(db, &parser.TableSchema{
+					Name: "events",
+					Columns: []parser.ColumnSchema{
+						{Name: "level", Type: parser.TypeText, Rules: &parser.ValidationRules{Enum: []string{"INFO", "WARN"}}},
+						{Name: "latency", Type: parser.TypeInteger, Check: "latency < 1000", Default: "0"},
+					},
+				}, false)
+			},
+			detected: &parser.TableSchema{
+				Name: "events",
+				Columns: []parser.ColumnSchema{
+					{Name: "level", Type: parser.TypeText, Nullable: true},
+					{Name: "latency", Type: parser.TypeReal},
+					{Name: "host", Type: parser.TypeText},
+				},
+			},
+			valid: "INSERT INTO events (level, latency, host) VALUES (NULL, 1.5, 'web1')",
+			invalid: []string{
+				"INSERT INTO events (level, latency, host) VALUES ('ERROR', 1, 'web1')",
+				"INSERT INTO events (level, latency, host) VALUES ('INFO', 1000.5, 'web1')",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, err := Initialize(":memory:")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			if err := tt.setup(db); err != nil {
+				t.Fatalf("setup error = %v", err)
+			}
+
+			before, err := tableDefinition(db, tt.detected.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := EvolveTable(db, tt.detected); err != nil {
+				t.Fatalf("EvolveTable() error = %v", err)
+			}
+			after, err := tableDefinition(db, tt.detected.Name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if after == before {
+				t.Fatalf("Expected the table to be rebuilt, definition unchanged: %s", after)
+			}
+			if got, want := strings.Count(after, "CHECK"), strings.Count(before, "CHECK"); got != want {
+				t.Errorf("Expected %d CHECK constraints after the rebuild, got %d:\n%s", want, got, after)
+			}
+
+			if _, err := db.Exec(tt.valid); err != nil {
+				t.Errorf("Expected the evolved table to accept %q, got %v", tt.valid, err)
+			}
+			for _, statement := range tt.invalid {
+				if _, err := db.Exec(statement); err == nil {
+					t.Errorf("Expected the evolved table to reject %q", statement)
+				}
+			}
+		})
+	}
+}
+
+// TestEvolvedTableSQL tests rewriting a stored table definition
+func TestEvolvedTableSQL(t *testing.T) {
+	existing := &parser.TableSchema{
+		Name: "t",
+		Columns: []parser.ColumnSchema{
+			{Name: "a", Type: parser.TypeInteger},
+			{Name: "b", Type: parser.TypeText},
+		},
+	}
+	evolved := &parser.TableSchema{
+		Name: "t",
+		Columns: []parser.ColumnSchema{
+			{Name: "a", Type: parser.TypeReal, Nullable: true},
+			{Name: "b", Type: parser.TypeText},
+			{Name: "c", Type: parser.TypeText, Nullable: true},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		statement string
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:      "constraints kept",
+			statement: "CREATE TABLE t (id INTEGER PRIMARY KEY, a INTEGER NOT NULL DEFAULT 0 CHECK (a IS NOT NULL OR a >= 0), b TEXT NOT NULL, CHECK (b <> 'x, y'))",
+			want:      "CREATE TABLE t_rebuild (\n  id INTEGER PRIMARY KEY,\n  a REAL DEFAULT 0 CHECK (a IS NOT NULL OR a >= 0),\n  b TEXT NOT NULL,\n  c TEXT,\n  CHECK (b <> 'x, y')\n)",
+		},
+		{
+			name:      "quoted names",
+			statement: "CREATE TABLE \"t\" (\"a\" INTEGER NOT NULL, [b] TEXT NOT NULL) STRICT",
+			want:      "CREATE TABLE t_rebuild (\n  \"a\" REAL,\n  [b] TEXT NOT NULL,\n  c TEXT\n) STRICT",
+		},
+		{
+			name:      "conflict clause",
+			statement: "CREATE TABLE t (a INTEGER NOT NULL ON CONFLICT REPLACE, b TEXT)",
+			wantErr:   true,
+		},
+		{
+			name:      "column missing",
+			statement: "CREATE TABLE t (b TEXT)",
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evolvedTableSQL(tt.statement, "t_rebuild", existing, evolved)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evolvedTableSQL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("evolvedTableSQL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 // TestInsertRecordsEdgeCases tests edge cases in record insertion
 func TestInsertRecordsEdgeCases(t *testing.T) {
 	db, err := Initialize(":memory:")
@@ -870,7 +1239,7 @@ func TestInsertRecordsEdgeCases(t *testing.T) {
 				t.Fatalf("Failed to clear table: %v", err)
 			}
 
-			count, err := InsertRecords(db, "test_records", tt.headers, tt.records, &schema)
+			count, err := InsertRecords(db, "test_records", tt.headers, tt.records, &schema, InsertOptions{})
 
 			if tt.wantErr {
 				if err == nil {
@@ -890,6 +1259,65 @@ func TestInsertRecordsEdgeCases(t *testing.T) {
 	}
 }
 
+// TestInsertRecordsSkippingErrors tests that bad records are skipped and reported
+func TestInsertRecordsSkippingErrors(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := parser.TableSchema{
+		Name: "skip_records",
+		Columns: []parser.ColumnSchema{
+			{Name: "name", Type: parser.TypeText},
+			{Name: "value", Type: parser.TypeInteger},
+		},
+	}
+	if err := CreateTableFromSchema(db, &schema, false); err != nil {
+		t.Fatalf("Failed to create test table: %v", err)
+	}
+
+	records := [][]string{
+		{"ok1", "1"},
+		{"short"},      // Wrong field count
+		{"bad", "abc"}, // Conversion error
+		{"ok2", "2"},
+		{"missing", ""}, // NOT NULL constraint violation
+		{"ok3", "3"},
+	}
+
+	count, rejected, err := InsertRecordsSkippingErrors(db, "skip_records", []string{"name", "value"}, records, &schema, InsertOptions{})
+	if err != nil {
+		t.Fatalf("InsertRecordsSkippingErrors() unexpected error: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 records inserted, got %d", count)
+	}
+
+	var indexes []int
+	for _, r := range rejected {
+		indexes = append(indexes, r.Index)
+	}
+	if fmt.Sprint(indexes) != "[1 2 4]" {
+		t.Errorf("Expected rejected indexes [1 2 4], got %v", indexes)
+	}
+
+	results, err := ExecuteQuery(db, "SELECT COUNT(*) as count FROM skip_records")
+	if err != nil {
+		t.Fatalf("Failed to count records: %v", err)
+	}
+	if results[0]["count"].(int64) != 3 {
+		t.Errorf("Expected 3 records in table, got %v", results[0]["count"])
+	}
+
+	// Errors unrelated to the data are still fatal
+	_, _, err = InsertRecordsSkippingErrors(db, "missing_table", []string{"name", "value"}, records, &schema, InsertOptions{})
+	if err == nil {
+		t.Error("Expected error for missing table")
+	}
+}
+
 // TestExecuteQueryEdgeCases tests edge cases in query execution
 func TestExecuteQueryEdgeCases(t *testing.T) {
 	db, err := Initialize(":memory:")
@@ -918,7 +1346,7 @@ func TestExecuteQueryEdgeCases(t *testing.T) {
 			Size:      120,
 		},
 	}
-	_, err = InsertLogEntries(db, testEntries, false, "logs")
+	_, err = InsertLogEntries(db, testEntries, false, "logs", InsertOptions{})
 	if err != nil {
 		t.Fatalf("Failed to insert test data: %v", err)
 	}
@@ -1072,7 +1500,7 @@ func TestDatabaseConcurrency(t *testing.T) {
 			}
 
 			// Use append mode for concurrency and specify table name
-			_, err := InsertLogEntries(db, entries, true, "logs")
+			_, err := InsertLogEntries(db, entries, true, "logs", InsertOptions{})
 			errChan <- err
 		}(i)
 	}
@@ -1152,3 +1580,38 @@ func TestDatabaseIndexCreation(t *testing.T) {
 		}
 	}
 }
+
+// TestExecuteQueryResult tests that columns keep the order of the SELECT list
+func TestExecuteQueryResult(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	result, err := ExecuteQueryResult(db, "SELECT 'b' AS zeta, NULL AS alpha, 2.5 AS mid, ? AS param", int64(7))
+	if err != nil {
+		t.Fatalf("ExecuteQueryResult() error = %v", err)
+	}
+	if got := strings.Join(result.Columns, ","); got != "zeta,alpha,mid,param" {
+		t.Errorf("Columns = %s, want zeta,alpha,mid,param", got)
+	}
+	if len(result.Rows) != 1 {
+		t.Fatalf("Expected one row, got %d", len(result.Rows))
+	}
+	want := []interface{}{"b", nil, 2.5, int64(7)}
+	for i, value := range result.Rows[0] {
+		if value != want[i] {
+			t.Errorf("Column %s = %#v, want %#v", result.Columns[i], value, want[i])
+		}
+	}
+
+	// BLOBs keep their bytes for the output formats to encode
+	result, err = ExecuteQueryResult(db, "SELECT x'00ff' AS data")
+	if err != nil {
+		t.Fatalf("ExecuteQueryResult() error = %v", err)
+	}
+	if data, ok := result.Rows[0][0].([]byte); !ok || !bytes.Equal(data, []byte{0x00, 0xff}) {
+		t.Errorf("BLOB = %#v, want []byte{0x0, 0xff}", result.Rows[0][0])
+	}
+}
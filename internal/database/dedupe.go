@@ -0,0 +1,111 @@
+// Package database provides SQLite database operations for the server log analyzer
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// EnsureDedupeKey creates a unique index on the key columns of a table, so that
+// inserts with InsertOptions.DedupeKey skip rows that are already in the table
+// A dedupe index of another key is dropped, as it would still skip rows that
+// are not duplicates on the new key; that key is returned
+// It fails if the table already contains rows that are duplicates on the key
+// Rows with a NULL in any key column are never considered duplicates
+func EnsureDedupeKey(db Executor, table string, key []string) ([]string, error) {
+	columns, err := tableColumnNames(db, table)
+	if err != nil {
+		return nil, err
+	}
+	for i, name := range key {
+		if !slices.Contains(columns, name) {
+			return nil, fmt.Errorf("dedupe key column '%s' is not a column of table '%s'", name, table)
+		}
+		if slices.Contains(key[:i], name) {
+			return nil, fmt.Errorf("dedupe key column '%s' is listed twice", name)
+		}
+	}
+
+	indexes, err := dedupeIndexes(db, table)
+	if err != nil {
+		return nil, err
+	}
+	var replaced []string
+	for _, index := range indexes {
+		if index == dedupeIndexName(table, key) {
+			continue
+		}
+		if replaced, err = indexColumns(db, index); err != nil {
+			return nil, err
+		}
+		if _, err := db.Exec(fmt.Sprintf("DROP INDEX %s", index)); err != nil {
+			return nil, fmt.Errorf("failed to drop dedupe index: %w", err)
+		}
+	}
+
+	indexSQL := fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)",
+		dedupeIndexName(table, key), table, strings.Join(key, ", "))
+	if _, err := db.Exec(indexSQL); err != nil {
+		if isRecordLevelError(err) {
+			return nil, fmt.Errorf("table '%s' already contains rows with the same %s: %w", table, strings.Join(key, ", "), err)
+		}
+		return nil, fmt.Errorf("failed to create dedupe index: %w", err)
+	}
+	return replaced, nil
+}
+
+// dedupeIndexName names the unique index of a dedupe key after its columns, so
+// that different keys on the same table get different indexes
+func dedupeIndexName(table string, key []string) string {
+	return fmt.Sprintf("idx_%s_dedupe_%s", table, strings.Join(key, "_"))
+}
+
+// DedupeKey returns the key columns of the dedupe index EnsureDedupeKey created
+// on a table, or nil if the table has none
+func DedupeKey(db Executor, table string) ([]string, error) {
+	indexes, err := dedupeIndexes(db, table)
+	if err != nil || len(indexes) == 0 {
+		return nil, err
+	}
+	return indexColumns(db, indexes[0])
+}
+
+// dedupeIndexes returns the names of the dedupe indexes of a table
+func dedupeIndexes(db Executor, table string) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND name GLOB ? ORDER BY name",
+		table, dedupeIndexName(table, nil)+"*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read indexes: %w", err)
+	}
+	defer rows.Close()
+
+	var indexes []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read indexes: %w", err)
+		}
+		indexes = append(indexes, name)
+	}
+	return indexes, rows.Err()
+}
+
+// indexColumns returns the columns of an index in key order
+func indexColumns(db Executor, index string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_index_info('%s') ORDER BY seqno", index))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index info: %w", err)
+	}
+	defer rows.Close()
+
+	var key []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read index info: %w", err)
+		}
+		key = append(key, name)
+	}
+	return key, rows.Err()
+}
@@ -0,0 +1,115 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// TestEnsureDedupeKey tests that rows with a key already in the table are skipped
+func TestEnsureDedupeKey(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := parser.TableSchema{
+		Name: "events",
+		Columns: []parser.ColumnSchema{
+			{Name: "name", Type: parser.TypeText},
+			{Name: "value", Type: parser.TypeInteger, Check: "value >= 0"},
+		},
+	}
+	if err := CreateTableFromSchema(db, &schema, false); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	if key, err := DedupeKey(db, "events"); err != nil || key != nil {
+		t.Errorf("Expected no dedupe key, got %v, %v", key, err)
+	}
+	if _, err := EnsureDedupeKey(db, "events", []string{"name", "missing"}); err == nil || !strings.Contains(err.Error(), "not a column") {
+		t.Errorf("Expected unknown column error, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := EnsureDedupeKey(db, "events", []string{"name", "value"}); err != nil {
+			t.Fatalf("EnsureDedupeKey() error = %v", err)
+		}
+	}
+	key, err := DedupeKey(db, "events")
+	if err != nil || !reflect.DeepEqual(key, []string{"name", "value"}) {
+		t.Errorf("Expected dedupe key name, value, got %v, %v", key, err)
+	}
+
+	opts := InsertOptions{DedupeKey: key}
+	headers := []string{"name", "value"}
+	count, err := InsertRecords(db, "events", headers, [][]string{{"a", "1"}, {"b", "2"}, {"a", "1"}}, &schema, opts)
+	if err != nil || count != 2 {
+		t.Fatalf("Expected 2 rows inserted, got %d, %v", count, err)
+	}
+
+	// Duplicates are skipped, other constraint violations are still rejected
+	records := [][]string{{"b", "2"}, {"c", "-1"}, {"c", "3"}}
+	count, rejected, err := InsertRecordsSkippingErrors(db, "events", headers, records, &schema, opts)
+	if err != nil {
+		t.Fatalf("InsertRecordsSkippingErrors() error = %v", err)
+	}
+	if count != 1 || len(rejected) != 1 || rejected[0].Index != 1 {
+		t.Errorf("Expected 1 row inserted and record 2 rejected, got %d and %v", count, rejected)
+	}
+
+	// Without the dedupe key a duplicate violates the unique index
+	if _, err := InsertRecords(db, "events", headers, [][]string{{"a", "1"}}, &schema, InsertOptions{}); err == nil {
+		t.Error("Expected a duplicate to fail without the dedupe key")
+	}
+
+	// A key that existing rows already repeat cannot be added
+	if _, err := db.Exec("INSERT INTO events (name, value) VALUES ('a', 5)"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EnsureDedupeKey(db, "events", []string{"name"}); err == nil || !strings.Contains(err.Error(), "already contains rows with the same name") {
+		t.Errorf("Expected duplicate rows error, got %v", err)
+	}
+}
+
+// TestEnsureDedupeKeyReplacesKey tests that a new key replaces the dedupe index
+// of the old one, which would otherwise keep skipping rows
+func TestEnsureDedupeKeyReplacesKey(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := parser.TableSchema{
+		Name: "events",
+		Columns: []parser.ColumnSchema{
+			{Name: "name", Type: parser.TypeText},
+			{Name: "value", Type: parser.TypeInteger},
+		},
+	}
+	if err := CreateTableFromSchema(db, &schema, false); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	if replaced, err := EnsureDedupeKey(db, "events", []string{"name"}); err != nil || replaced != nil {
+		t.Fatalf("EnsureDedupeKey() = %v, %v, want no replaced key", replaced, err)
+	}
+	replaced, err := EnsureDedupeKey(db, "events", []string{"name", "value"})
+	if err != nil || !reflect.DeepEqual(replaced, []string{"name"}) {
+		t.Fatalf("EnsureDedupeKey() = %v, %v, want replaced key name", replaced, err)
+	}
+	key, err := DedupeKey(db, "events")
+	if err != nil || !reflect.DeepEqual(key, []string{"name", "value"}) {
+		t.Errorf("Expected dedupe key name, value, got %v, %v", key, err)
+	}
+
+	// Rows with the same name but another value are no longer duplicates
+	headers := []string{"name", "value"}
+	count, err := InsertRecords(db, "events", headers, [][]string{{"a", "1"}, {"a", "2"}, {"a", "2"}}, &schema, InsertOptions{DedupeKey: key})
+	if err != nil || count != 2 {
+		t.Errorf("Expected 2 rows inserted, got %d, %v", count, err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package database provides SQLite database operations for the server log analyzer
+package database
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// EpochSuffix is added to the name of a TIMESTAMP column to name its epoch column
+const EpochSuffix = "_epoch"
+
+// EnsureEpochColumns adds to a table an epoch column for each TIMESTAMP
+// column of the schema that has none: a generated INTEGER column holding the
+// UNIX seconds of the timestamp, named <column>_epoch. Generated columns are
+// computed when read, so existing rows get their value too
+// It returns the names of the columns added
+func EnsureEpochColumns(db Executor, schema *parser.TableSchema) ([]string, error) {
+	var timestamps []string
+	for _, col := range schema.Columns {
+		if col.Type == parser.TypeTimestamp {
+			timestamps = append(timestamps, col.Name)
+		}
+	}
+	return addEpochColumns(db, schema.Name, timestamps)
+}
+
+// addEpochColumns adds the epoch columns of the given timestamp columns,
+// skipping names the table already has
+func addEpochColumns(db Executor, table string, timestamps []string) ([]string, error) {
+	existing, err := queryNames(db, fmt.Sprintf("SELECT name FROM pragma_table_xinfo('%s')", table))
+	if err != nil {
+		return nil, err
+	}
+
+	var added []string
+	for _, column := range timestamps {
+		name := column + EpochSuffix
+		if existing[name] {
+			continue
+		}
+		alterSQL := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s INTEGER GENERATED ALWAYS AS (CAST(strftime('%%s', %s) AS INTEGER)) VIRTUAL",
+			table, name, column)
+		if _, err := db.Exec(alterSQL); err != nil {
+			return nil, fmt.Errorf("failed to add column '%s': %w", name, err)
+		}
+		added = append(added, name)
+	}
+	return added, nil
+}
+
+// epochSources returns the timestamp columns whose epoch columns a table has
+func epochSources(db Executor, table string) ([]string, error) {
+	// Generated columns are reported as hidden 2 (virtual) or 3 (stored)
+	generated, err := queryNames(db, fmt.Sprintf("SELECT name FROM pragma_table_xinfo('%s') WHERE hidden IN (2, 3)", table))
+	if err != nil {
+		return nil, err
+	}
+	var sources []string
+	for name := range generated {
+		if source, ok := strings.CutSuffix(name, EpochSuffix); ok {
+			sources = append(sources, source)
+		}
+	}
+	slices.Sort(sources)
+	return sources, nil
+}
+
+// queryNames returns the set of names a single-column query returns
+func queryNames(db Executor, query string) (map[string]bool, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table info: %w", err)
+	}
+	defer rows.Close()
+
+	names := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to read table info: %w", err)
+		}
+		names[name] = true
+	}
+	return names, rows.Err()
+}
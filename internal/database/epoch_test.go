@@ -0,0 +1,79 @@
+package database
+
+import (
+	"testing"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// TestEnsureEpochColumns tests adding epoch columns and keeping them across a table rebuild
+func TestEnsureEpochColumns(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := &parser.TableSchema{
+		Name: "test_table",
+		Columns: []parser.ColumnSchema{
+			{Name: "timestamp", Type: parser.TypeTimestamp},
+			{Name: "size", Type: parser.TypeInteger},
+		},
+	}
+	if err := CreateTableFromSchema(db, schema, false); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	records := [][]string{{"2020-04-15T23:30:00-04:00", "10"}, {"1586995200", "20"}}
+	if _, err := InsertRecords(db, "test_table", []string{"timestamp", "size"}, records, schema, InsertOptions{}); err != nil {
+		t.Fatalf("InsertRecords() error = %v", err)
+	}
+
+	added, err := EnsureEpochColumns(db, schema)
+	if err != nil {
+		t.Fatalf("EnsureEpochColumns() error = %v", err)
+	}
+	if len(added) != 1 || added[0] != "timestamp_epoch" {
+		t.Errorf("Expected timestamp_epoch to be added, got %v", added)
+	}
+	if added, err := EnsureEpochColumns(db, schema); err != nil || len(added) != 0 {
+		t.Errorf("Expected nothing added the second time, got %v, %v", added, err)
+	}
+
+	check := func(when string) {
+		t.Helper()
+		results, err := ExecuteQuery(db, "SELECT timestamp, timestamp_epoch FROM test_table ORDER BY id")
+		if err != nil {
+			t.Fatalf("Query failed %s: %v", when, err)
+		}
+		want := []struct {
+			timestamp string
+			epoch     int64
+		}{
+			{"2020-04-16 03:30:00", 1587007800},
+			{"2020-04-16 00:00:00", 1586995200},
+		}
+		if len(results) != len(want) {
+			t.Fatalf("Expected %d rows %s, got %v", len(want), when, results)
+		}
+		for i, w := range want {
+			if results[i]["timestamp"] != w.timestamp || results[i]["timestamp_epoch"] != w.epoch {
+				t.Errorf("Row %d %s = %v, want %s and %d", i, when, results[i], w.timestamp, w.epoch)
+			}
+		}
+	}
+	check("after adding")
+
+	// Widening size rebuilds the table, which must keep the epoch column
+	widened := &parser.TableSchema{
+		Name: "test_table",
+		Columns: []parser.ColumnSchema{
+			{Name: "timestamp", Type: parser.TypeTimestamp},
+			{Name: "size", Type: parser.TypeReal},
+		},
+	}
+	if _, _, err := EvolveTable(db, widened); err != nil {
+		t.Fatalf("EvolveTable() error = %v", err)
+	}
+	check("after a rebuild")
+}
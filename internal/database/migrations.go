@@ -0,0 +1,146 @@
+// Package database provides SQLite database operations for the server log analyzer
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// migrationsTable records which migrations have been applied to a database
+const migrationsTable = "schema_migrations"
+
+// Migration is one versioned change to the tables the tool itself owns
+// Tables created by schema detection are not migrated; they follow the
+// detected schema (see EvolveTable). Only their stored values may be rewritten,
+// when the storage format changes
+type Migration struct {
+	Version     int
+	Description string
+	Legacy      bool // Only applied to databases used with the legacy fixed schema
+	Up          func(tx Executor) error
+}
+
+// migrations lists every migration in version order
+// Never change or remove a released migration: databases are kept across
+// tool upgrades, so fixes must be made by appending a new one
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create legacy logs table and indexes",
+		Legacy:      true,
+		Up:          createTables,
+	},
+	{
+		Version:     2,
+		Description: "create load history tables",
+		Up:          createLoadHistoryTables,
+	},
+	{
+		Version:     3,
+		Description: "create load offsets table",
+		Up:          createLoadOffsetsTable,
+	},
+	{
+		Version:     4,
+		Description: "create saved queries table",
+		Up:          createSavedQueriesTable,
+	},
+	{
+		Version:     5,
+		Description: "normalize stored timestamps to UTC",
+		Up:          normalizeStoredTimestamps,
+	},
+}
+
+// Migrate brings the database up to date by applying the pending migrations
+// that every database needs, each in its own transaction together with its
+// record in schema_migrations. Legacy migrations are applied by
+// InitializeWithLegacySchema
+// A database that has migrations this tool does not know about was written by
+// a newer version, and is refused rather than risk writing an older layout
+func Migrate(db DB) error {
+	return migrate(db, false)
+}
+
+// migrate applies the pending migrations, including legacy ones if legacy is set
+func migrate(db DB, legacy bool) error {
+	createSQL := fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at DATETIME NOT NULL
+	)`, migrationsTable)
+	if _, err := db.Exec(createSQL); err != nil {
+		return fmt.Errorf("failed to create %s table: %w", migrationsTable, err)
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].Version
+	for version := range applied {
+		if version > latest {
+			return fmt.Errorf("database schema version %d is newer than this tool supports (%d); upgrade server-log-analyzer", version, latest)
+		}
+	}
+
+	for _, m := range migrations {
+		if applied[m.Version] || (m.Legacy && !legacy) {
+			continue
+		}
+
+		err := WithTransaction(db, func(tx Executor) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			insertSQL := fmt.Sprintf("INSERT INTO %s (version, description, applied_at) VALUES (?, ?, ?)", migrationsTable)
+			_, err := tx.Exec(insertSQL, m.Version, m.Description, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %d (%s): %w", m.Version, m.Description, err)
+		}
+	}
+
+	return nil
+}
+
+// appliedMigrations returns the versions recorded in schema_migrations
+func appliedMigrations(db Executor) (map[int]bool, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT version FROM %s", migrationsTable))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// SchemaVersion returns the highest migration version applied to the database,
+// or 0 if it has never been migrated
+func SchemaVersion(db Executor) (int, error) {
+	table, err := ReadTableSchema(db, migrationsTable)
+	if err != nil || table == nil {
+		return 0, err
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, nil
+}
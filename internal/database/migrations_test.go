@@ -0,0 +1,211 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMigrationsOrdered tests that migration versions start at 1 and increase by one
+func TestMigrationsOrdered(t *testing.T) {
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			t.Errorf("Migration %d has version %d, want %d", i, m.Version, i+1)
+		}
+		if m.Description == "" || m.Up == nil {
+			t.Errorf("Migration %d needs a description and an Up function", m.Version)
+		}
+	}
+}
+
+// TestMigrateLegacySchema tests migrating a new database used with the legacy schema
+func TestMigrateLegacySchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	// Opening the database twice must not apply migrations twice
+	for i := 0; i < 2; i++ {
+		db, err := InitializeWithLegacySchema(dbPath)
+		if err != nil {
+			t.Fatalf("InitializeWithLegacySchema() error = %v", err)
+		}
+		db.Close()
+	}
+
+	db, err := Initialize(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		t.Fatalf("SchemaVersion() error = %v", err)
+	}
+	if want := migrations[len(migrations)-1].Version; version != want {
+		t.Errorf("Expected schema version %d, got %d", want, version)
+	}
+
+	results, err := ExecuteQuery(db, "SELECT version FROM schema_migrations")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(results) != len(migrations) {
+		t.Errorf("Expected %d recorded migrations, got %d", len(migrations), len(results))
+	}
+
+	if _, err := db.Exec("INSERT INTO logs (timestamp, username, operation, size) VALUES ('2020-04-15 10:00:00', 'test', 'upload', 100)"); err != nil {
+		t.Errorf("Expected the legacy logs table to exist: %v", err)
+	}
+}
+
+// TestMigrateSkipsLegacyMigrations tests that Migrate leaves out the legacy logs table
+func TestMigrateSkipsLegacyMigrations(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	logs, err := ReadTableSchema(db, "logs")
+	if err != nil {
+		t.Fatalf("ReadTableSchema() error = %v", err)
+	}
+	if logs != nil {
+		t.Error("Expected Migrate not to create the legacy logs table")
+	}
+
+	// Legacy migrations are applied later if the database is used in legacy mode
+	if err := migrate(db, true); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+	if version, _ := SchemaVersion(db); version != migrations[len(migrations)-1].Version {
+		t.Errorf("Expected every migration to be applied, got version %d", version)
+	}
+}
+
+// TestMigrateUpgradesExistingDatabase tests upgrading a database created
+// before migrations were recorded
+func TestMigrateUpgradesExistingDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+
+	db, err := Initialize(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := createTables(db); err != nil {
+		t.Fatalf("Failed to create legacy tables: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO logs (timestamp, username, operation, size) VALUES ('2020-04-15 10:00:00', 'test', 'upload', 100)"); err != nil {
+		t.Fatalf("Failed to insert test data: %v", err)
+	}
+	if version, err := SchemaVersion(db); err != nil || version != 0 {
+		t.Errorf("Expected schema version 0 before migrating, got %d, %v", version, err)
+	}
+	db.Close()
+
+	db, err = InitializeWithLegacySchema(dbPath)
+	if err != nil {
+		t.Fatalf("InitializeWithLegacySchema() error = %v", err)
+	}
+	defer db.Close()
+
+	results, err := ExecuteQuery(db, "SELECT COUNT(*) AS count FROM logs")
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if results[0]["count"] != int64(1) {
+		t.Errorf("Expected existing data to be kept, got %v rows", results[0]["count"])
+	}
+	if version, _ := SchemaVersion(db); version != migrations[len(migrations)-1].Version {
+		t.Errorf("Expected the database to be upgraded, got version %d", version)
+	}
+}
+
+// TestMigrateNormalizesTimestamps tests that upgrading rewrites the timestamps
+// earlier versions stored with their zone offset in the UTC storage format
+func TestMigrateNormalizesTimestamps(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// Earlier versions passed times to the driver, which writes their offset
+	if err := createTables(db); err != nil {
+		t.Fatalf("Failed to create legacy tables: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE events (id INTEGER PRIMARY KEY, at DATETIME, note TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	berlin := time.FixedZone("CEST", 2*3600)
+	inserts := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"INSERT INTO logs (timestamp, username, operation, size) VALUES (?, 'a', 'upload', 1)", []interface{}{time.Date(2020, 4, 16, 0, 30, 0, 0, berlin)}},
+		{"INSERT INTO logs (timestamp, username, operation, size) VALUES (?, 'b', 'upload', 1)", []interface{}{"2020-04-15 10:00:00"}},
+		{"INSERT INTO events (at, note) VALUES (?, '2020-04-15 10:00:00+02:00')", []interface{}{time.Date(2020, 4, 15, 10, 0, 0, 500000000, time.UTC)}},
+		{"INSERT INTO events (at, note) VALUES ('not a time', NULL)", nil},
+	}
+	for _, insert := range inserts {
+		if _, err := db.Exec(insert.query, insert.args...); err != nil {
+			t.Fatalf("Failed to insert test data: %v", err)
+		}
+	}
+
+	if err := migrate(db, true); err != nil {
+		t.Fatalf("migrate() error = %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT CAST(timestamp AS TEXT) AS value FROM logs ORDER BY id", "2020-04-15 22:30:00,2020-04-15 10:00:00"},
+		{"SELECT CAST(at AS TEXT) AS value FROM events ORDER BY id", "2020-04-15 10:00:00.5,not a time"},
+		{"SELECT COALESCE(note, '') AS value FROM events ORDER BY id", "2020-04-15 10:00:00+02:00,"},
+		{"SELECT COUNT(*) AS value FROM logs WHERE date(timestamp) = '2020-04-15'", "2"},
+	}
+	for _, tt := range tests {
+		results, err := ExecuteQuery(db, tt.query)
+		if err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+		values := make([]string, len(results))
+		for i, row := range results {
+			values[i] = fmt.Sprint(row["value"])
+		}
+		if got := strings.Join(values, ","); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
+
+// TestMigrateRefusesNewerDatabase tests that a database migrated by a newer
+// version of the tool is not written to
+func TestMigrateRefusesNewerDatabase(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	future := migrations[len(migrations)-1].Version + 1
+	if _, err := db.Exec("INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, 'future', '2030-01-01')", future); err != nil {
+		t.Fatalf("Failed to record future migration: %v", err)
+	}
+
+	err = Migrate(db)
+	if err == nil || !strings.Contains(err.Error(), "newer than this tool supports") {
+		t.Errorf("Expected newer schema error, got %v", err)
+	}
+}
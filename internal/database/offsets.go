@@ -0,0 +1,74 @@
+// Package database provides SQLite database operations for the server log analyzer
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// createLoadOffsetsTable creates the table recording how far 'load --follow'
+// has read each followed file
+func createLoadOffsetsTable(db Executor) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS load_offsets (
+		table_name TEXT NOT NULL,
+		path TEXT NOT NULL,
+		byte_offset INTEGER NOT NULL,
+		line_count INTEGER NOT NULL,
+		fingerprint TEXT NOT NULL,
+		updated_at DATETIME NOT NULL,
+		PRIMARY KEY (table_name, path)
+	);
+	`
+
+	if _, err := db.Exec(createSQL); err != nil {
+		return fmt.Errorf("failed to create load offsets table: %w", err)
+	}
+	return nil
+}
+
+// LoadOffset records how much of a followed file has been loaded into a table
+type LoadOffset struct {
+	Table       string
+	Path        string // Absolute path of the followed file
+	Offset      int64  // Bytes loaded; always the end of a line
+	Lines       int    // Lines loaded, for the line numbers of rejected records
+	Fingerprint string // Identifies the file content up to Offset, see the follow command
+	UpdatedAt   time.Time
+}
+
+// GetLoadOffset returns the offset saved for a file followed into a table, or nil if there is none
+func GetLoadOffset(db Executor, table, path string) (*LoadOffset, error) {
+	rows, err := db.Query("SELECT byte_offset, line_count, fingerprint, updated_at FROM load_offsets WHERE table_name = ? AND path = ?", table, path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read load offset: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	offset := &LoadOffset{Table: table, Path: path}
+	if err := rows.Scan(&offset.Offset, &offset.Lines, &offset.Fingerprint, &offset.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to read load offset: %w", err)
+	}
+	return offset, nil
+}
+
+// SaveLoadOffset records the offset of a followed file
+// Save it in the transaction that inserts the rows read up to the offset, so
+// that a restart neither loads them twice nor misses any
+func SaveLoadOffset(db Executor, offset LoadOffset) error {
+	upsertSQL := `INSERT INTO load_offsets (table_name, path, byte_offset, line_count, fingerprint, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (table_name, path) DO UPDATE SET
+			byte_offset = excluded.byte_offset,
+			line_count = excluded.line_count,
+			fingerprint = excluded.fingerprint,
+			updated_at = excluded.updated_at`
+
+	if _, err := db.Exec(upsertSQL, offset.Table, offset.Path, offset.Offset, offset.Lines, offset.Fingerprint, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save load offset: %w", err)
+	}
+	return nil
+}
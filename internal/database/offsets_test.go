@@ -0,0 +1,47 @@
+package database
+
+import (
+	"testing"
+)
+
+// TestLoadOffsets tests saving, updating and clearing the offset of a followed file
+func TestLoadOffsets(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	if offset, err := GetLoadOffset(db, "logs", "/var/log/server.csv"); err != nil || offset != nil {
+		t.Errorf("Expected no offset, got %v, %v", offset, err)
+	}
+
+	for _, saved := range []LoadOffset{
+		{Table: "logs", Path: "/var/log/server.csv", Offset: 100, Lines: 3, Fingerprint: "abc"},
+		{Table: "logs", Path: "/var/log/server.csv", Offset: 250, Lines: 7, Fingerprint: "def"},
+	} {
+		if err := SaveLoadOffset(db, saved); err != nil {
+			t.Fatalf("SaveLoadOffset() error = %v", err)
+		}
+	}
+
+	offset, err := GetLoadOffset(db, "logs", "/var/log/server.csv")
+	if err != nil || offset == nil {
+		t.Fatalf("GetLoadOffset() = %v, %v", offset, err)
+	}
+	if offset.Offset != 250 || offset.Lines != 7 || offset.Fingerprint != "def" || offset.UpdatedAt.IsZero() {
+		t.Errorf("Expected the latest offset, got %+v", offset)
+	}
+
+	// Replacing the table forgets where its followed files were read up to
+	if _, err := BeginLoadBatch(db, "logs", "replace", ""); err != nil {
+		t.Fatalf("BeginLoadBatch() error = %v", err)
+	}
+	if offset, _ := GetLoadOffset(db, "logs", "/var/log/server.csv"); offset != nil {
+		t.Errorf("Expected the offset to be cleared, got %+v", offset)
+	}
+}
@@ -0,0 +1,110 @@
+// Package database provides SQLite database operations for the server log analyzer
+package database
+
+import (
+	"fmt"
+	"time"
+)
+
+// createSavedQueriesTable creates the table of queries saved with 'query --save'
+func createSavedQueriesTable(db Executor) error {
+	createSQL := `
+	CREATE TABLE IF NOT EXISTS saved_queries (
+		name TEXT PRIMARY KEY,
+		sql TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		updated_at DATETIME NOT NULL
+	);
+	`
+
+	if _, err := db.Exec(createSQL); err != nil {
+		return fmt.Errorf("failed to create saved queries table: %w", err)
+	}
+	return nil
+}
+
+// SavedQuery is a query stored by name, run with 'query --saved NAME'
+type SavedQuery struct {
+	Name        string
+	SQL         string // May hold {table} and :name parameters, bound when it runs
+	Description string
+	UpdatedAt   time.Time
+}
+
+// SaveQuery stores a query under its name, replacing any query saved with that name
+func SaveQuery(db Executor, query SavedQuery) error {
+	upsertSQL := `INSERT INTO saved_queries (name, sql, description, updated_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET
+			sql = excluded.sql,
+			description = excluded.description,
+			updated_at = excluded.updated_at`
+
+	if _, err := db.Exec(upsertSQL, query.Name, query.SQL, query.Description, time.Now().UTC()); err != nil {
+		return fmt.Errorf("failed to save query '%s': %w", query.Name, err)
+	}
+	return nil
+}
+
+// GetSavedQuery returns the query saved under the name, or nil if there is none
+func GetSavedQuery(db Executor, name string) (*SavedQuery, error) {
+	queries, err := readSavedQueries(db, "WHERE name = ?", name)
+	if err != nil || len(queries) == 0 {
+		return nil, err
+	}
+	return &queries[0], nil
+}
+
+// ListSavedQueries returns every saved query, by name
+func ListSavedQueries(db Executor) ([]SavedQuery, error) {
+	return readSavedQueries(db, "ORDER BY name")
+}
+
+// DeleteSavedQuery removes the query saved under the name, and reports whether there was one
+func DeleteSavedQuery(db Executor, name string) (bool, error) {
+	exists, err := savedQueriesExist(db)
+	if err != nil || !exists {
+		return false, err
+	}
+
+	result, err := db.Exec("DELETE FROM saved_queries WHERE name = ?", name)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete saved query '%s': %w", name, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to delete saved query '%s': %w", name, err)
+	}
+	return deleted > 0, nil
+}
+
+// readSavedQueries reads the saved queries selected by the clause. Databases
+// no query was saved in, which may predate the table, have none
+func readSavedQueries(db Executor, clause string, args ...interface{}) ([]SavedQuery, error) {
+	exists, err := savedQueriesExist(db)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT name, sql, description, updated_at FROM saved_queries "+clause, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read saved queries: %w", err)
+	}
+	defer rows.Close()
+
+	var queries []SavedQuery
+	for rows.Next() {
+		var query SavedQuery
+		if err := rows.Scan(&query.Name, &query.SQL, &query.Description, &query.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to read saved queries: %w", err)
+		}
+		queries = append(queries, query)
+	}
+	return queries, rows.Err()
+}
+
+// savedQueriesExist reports whether the saved queries table has been created
+func savedQueriesExist(db Executor) (bool, error) {
+	table, err := ReadTableSchema(db, "saved_queries")
+	return table != nil, err
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"testing"
+)
+
+// TestSavedQueries tests saving, replacing, listing and deleting queries
+func TestSavedQueries(t *testing.T) {
+	db, err := Initialize(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// A database that was never migrated has no saved queries
+	if queries, err := ListSavedQueries(db); err != nil || len(queries) != 0 {
+		t.Errorf("Expected no saved queries, got %v, %v", queries, err)
+	}
+	if deleted, err := DeleteSavedQuery(db, "missing"); err != nil || deleted {
+		t.Errorf("Expected nothing to delete, got %t, %v", deleted, err)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	for _, query := range []SavedQuery{
+		{Name: "uploads_over", SQL: "SELECT COUNT(*) FROM {table} WHERE size > :min"},
+		{Name: "users", SQL: "SELECT COUNT(DISTINCT username) FROM {table}"},
+		{Name: "uploads_over", SQL: "SELECT COUNT(*) FROM {table} WHERE size >= :min", Description: "At least a size"},
+	} {
+		if err := SaveQuery(db, query); err != nil {
+			t.Fatalf("SaveQuery() error = %v", err)
+		}
+	}
+
+	query, err := GetSavedQuery(db, "uploads_over")
+	if err != nil || query == nil {
+		t.Fatalf("GetSavedQuery() = %v, %v", query, err)
+	}
+	if query.SQL != "SELECT COUNT(*) FROM {table} WHERE size >= :min" || query.Description != "At least a size" || query.UpdatedAt.IsZero() {
+		t.Errorf("Expected the replaced query, got %+v", query)
+	}
+	if query, err := GetSavedQuery(db, "missing"); err != nil || query != nil {
+		t.Errorf("Expected no query, got %v, %v", query, err)
+	}
+
+	queries, err := ListSavedQueries(db)
+	if err != nil || len(queries) != 2 || queries[0].Name != "uploads_over" || queries[1].Name != "users" {
+		t.Fatalf("Expected two queries by name, got %+v, %v", queries, err)
+	}
+
+	if deleted, err := DeleteSavedQuery(db, "users"); err != nil || !deleted {
+		t.Errorf("Expected the query to be deleted, got %t, %v", deleted, err)
+	}
+	if query, _ := GetSavedQuery(db, "users"); query != nil {
+		t.Errorf("Expected the deleted query to be gone, got %+v", query)
+	}
+}
@@ -0,0 +1,229 @@
+// Package database provides SQLite database operations for the server log analyzer
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// tableConstraintKeywords start the table constraints of a CREATE TABLE body
+var tableConstraintKeywords = []string{"CONSTRAINT", "PRIMARY", "UNIQUE", "CHECK", "FOREIGN"}
+
+// columnConstraintKeywords end the declared type of a column definition
+var columnConstraintKeywords = []string{"CONSTRAINT", "PRIMARY", "NOT", "NULL", "UNIQUE", "CHECK",
+	"DEFAULT", "COLLATE", "REFERENCES", "GENERATED", "AS"}
+
+// sqlWord is a word of a definition outside parentheses and quotes
+type sqlWord struct {
+	start, end int
+	text       string
+}
+
+// tableDefinition returns the CREATE TABLE statement SQLite stored for a table
+func tableDefinition(db Executor, table string) (string, error) {
+	rows, err := db.Query("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = ?", table)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the definition of table '%s': %w", table, err)
+	}
+	defer rows.Close()
+
+	var statement sql.NullString
+	if rows.Next() {
+		if err := rows.Scan(&statement); err != nil {
+			return "", fmt.Errorf("failed to read the definition of table '%s': %w", table, err)
+		}
+	}
+	return statement.String, rows.Err()
+}
+
+// evolvedTableSQL rewrites the stored CREATE TABLE statement of a table to
+// create the evolved table under another name. Only the declared types of
+// widened columns and the NOT NULL of columns that now allow NULL change;
+// defaults, CHECK constraints, generated columns and table constraints are
+// kept as written. Columns the evolved schema adds are appended
+// It fails rather than drop a constraint when the statement cannot be read
+func evolvedTableSQL(statement, name string, existing, evolved *parser.TableSchema) (string, error) {
+	open := strings.Index(statement, "(")
+	closing := strings.LastIndex(statement, ")")
+	if open < 0 || closing < open {
+		return "", fmt.Errorf("cannot read the definition of table '%s'", existing.Name)
+	}
+
+	definitions := splitTopLevel(statement[open+1 : closing])
+	changed := make(map[string]parser.ColumnSchema)
+	for i, col := range existing.Columns {
+		if evolved.Columns[i].Type != col.Type || evolved.Columns[i].Nullable != col.Nullable {
+			changed[strings.ToLower(col.Name)] = evolved.Columns[i]
+		}
+	}
+
+	var columns []string
+	for i, definition := range definitions {
+		words := topLevelWords(definition)
+		if len(words) == 0 || isKeyword(words[0].text, tableConstraintKeywords) {
+			continue
+		}
+		col, ok := changed[strings.ToLower(unquoteIdentifier(words[0].text))]
+		if !ok {
+			continue
+		}
+		rewritten, err := rewriteColumnDefinition(definition, words, col)
+		if err != nil {
+			return "", fmt.Errorf("cannot rebuild table '%s': %w", existing.Name, err)
+		}
+		definitions[i] = rewritten
+		columns = append(columns, col.Name)
+		delete(changed, strings.ToLower(col.Name))
+	}
+	for _, col := range changed {
+		return "", fmt.Errorf("cannot rebuild table '%s': column '%s' is not in its stored definition", existing.Name, col.Name)
+	}
+
+	// New columns go before the table constraints, which must come last
+	split := len(definitions)
+	for i, definition := range definitions {
+		if words := topLevelWords(definition); len(words) > 0 && isKeyword(words[0].text, tableConstraintKeywords) {
+			split = i
+			break
+		}
+	}
+	var added []string
+	for _, col := range evolved.Columns[len(existing.Columns):] {
+		added = append(added, col.SQLDefinition())
+	}
+	definitions = append(definitions[:split], append(added, definitions[split:]...)...)
+
+	for i := range definitions {
+		definitions[i] = strings.TrimSpace(definitions[i])
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n  %s\n)%s", name, strings.Join(definitions, ",\n  "), statement[closing+1:]), nil
+}
+
+// rewriteColumnDefinition sets the declared type of a column definition to
+// the column's type and drops its NOT NULL if the column allows NULL
+func rewriteColumnDefinition(definition string, words []sqlWord, col parser.ColumnSchema) (string, error) {
+	// The type runs from the name to the first constraint
+	typeEnd := len(definition)
+	for _, word := range words[1:] {
+		if isKeyword(word.text, columnConstraintKeywords) {
+			typeEnd = word.start
+			break
+		}
+	}
+	rest := definition[typeEnd:]
+
+	if col.Nullable {
+		restWords := topLevelWords(rest)
+		for i := 0; i+1 < len(restWords); i++ {
+			if !strings.EqualFold(restWords[i].text, "NOT") || !strings.EqualFold(restWords[i+1].text, "NULL") {
+				continue
+			}
+			if i+2 < len(restWords) && strings.EqualFold(restWords[i+2].text, "ON") {
+				return "", fmt.Errorf("column '%s' has a NOT NULL conflict clause", col.Name)
+			}
+			rest = rest[:restWords[i].start] + rest[restWords[i+1].end:]
+			break
+		}
+	}
+
+	return definition[:words[0].end] + " " + col.Type.SQLType() + " " + strings.TrimLeft(rest, " \t\r\n"), nil
+}
+
+// splitTopLevel splits the body of a CREATE TABLE statement at the commas
+// outside parentheses and quotes
+func splitTopLevel(body string) []string {
+	var parts []string
+	start, depth := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; c {
+		case '\'', '"', '`':
+			i = skipQuoted(body, i, c)
+		case '[':
+			i = skipQuoted(body, i, ']')
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, body[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, body[start:])
+}
+
+// topLevelWords returns the words and quoted identifiers of a definition that
+// are outside parentheses
+func topLevelWords(definition string) []sqlWord {
+	var words []sqlWord
+	depth := 0
+	for i := 0; i < len(definition); i++ {
+		c := definition[i]
+		switch {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == '\'' || c == '"' || c == '`' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := skipQuoted(definition, i, closing)
+			if depth == 0 {
+				words = append(words, sqlWord{i, min(end+1, len(definition)), definition[i:min(end+1, len(definition))]})
+			}
+			i = end
+		case depth == 0 && isWordByte(c):
+			start := i
+			for i+1 < len(definition) && isWordByte(definition[i+1]) {
+				i++
+			}
+			words = append(words, sqlWord{start, i + 1, definition[start : i+1]})
+		}
+	}
+	return words
+}
+
+// skipQuoted returns the index of the quote closing the one at start
+func skipQuoted(s string, start int, closing byte) int {
+	for i := start + 1; i < len(s); i++ {
+		if s[i] == closing {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// isWordByte reports whether the byte can be part of an unquoted SQL word
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// isKeyword reports whether the word is one of the keywords, in any case
+func isKeyword(word string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if strings.EqualFold(word, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// unquoteIdentifier removes the quotes around an identifier
+func unquoteIdentifier(name string) string {
+	if len(name) >= 2 {
+		switch name[0] {
+		case '"', '`':
+			return strings.ReplaceAll(name[1:len(name)-1], name[:1]+name[:1], name[:1])
+		case '[':
+			return name[1 : len(name)-1]
+		}
+	}
+	return name
+}
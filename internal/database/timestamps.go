@@ -0,0 +1,106 @@
+// Package database provides SQLite database operations for the server log analyzer
+package database
+
+import (
+	"fmt"
+	"slices"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// toolTables are the tables the tool keeps its own state in, as opposed to
+// the tables logs are loaded into
+var toolTables = []string{migrationsTable, "load_batches", "load_batch_files", "load_offsets", "saved_queries"}
+
+// normalizeStoredTimestamps rewrites the DATETIME values of the log tables in
+// the storage format (see parser.TimestampFormat). Earlier versions stored
+// them as the driver writes times, with the offset of the parsed time, such as
+// 2020-04-15 22:10:38+02:00, which compares, sorts and groups by date
+// differently from the UTC values stored now
+// Values that cannot be parsed, or whose rewrite would break a constraint such
+// as a dedupe key, are left as they are
+func normalizeStoredTimestamps(tx Executor) error {
+	tables, err := logTables(tx)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		schema, err := ReadTableSchema(tx, table)
+		if err != nil {
+			return err
+		}
+		for _, col := range schema.Columns {
+			if col.Type == parser.TypeTimestamp {
+				if err := normalizeColumnTimestamps(tx, table, col.Name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// logTables returns the tables that are not the tool's own
+func logTables(db Executor) ([]string, error) {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to list tables: %w", err)
+		}
+		if !slices.Contains(toolTables, name) {
+			tables = append(tables, name)
+		}
+	}
+	return tables, rows.Err()
+}
+
+// normalizeColumnTimestamps rewrites the text values of a timestamp column
+// that are not in the storage format
+func normalizeColumnTimestamps(tx Executor, table, column string) error {
+	// CAST reads the stored text rather than the driver's time.Time
+	rows, err := tx.Query(fmt.Sprintf("SELECT rowid, CAST(%s AS TEXT) FROM %s WHERE typeof(%s) = 'text'", column, table, column))
+	if err != nil {
+		return fmt.Errorf("failed to read %s.%s: %w", table, column, err)
+	}
+
+	type update struct {
+		rowid int64
+		value string
+	}
+	var updates []update
+	for rows.Next() {
+		var rowid int64
+		var stored string
+		if err := rows.Scan(&rowid, &stored); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read %s.%s: %w", table, column, err)
+		}
+		t, err := parser.ParseTimestamp(stored, nil)
+		if err != nil {
+			continue
+		}
+		if value := parser.FormatTimestamp(t); value != stored {
+			updates = append(updates, update{rowid, value})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read %s.%s: %w", table, column, err)
+	}
+
+	updateSQL := fmt.Sprintf("UPDATE OR IGNORE %s SET %s = ? WHERE rowid = ?", table, column)
+	for _, u := range updates {
+		if _, err := tx.Exec(updateSQL, u.value, u.rowid); err != nil {
+			return fmt.Errorf("failed to normalize %s.%s: %w", table, column, err)
+		}
+	}
+	return nil
+}
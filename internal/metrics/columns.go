@@ -0,0 +1,184 @@
+// Package metrics compiles the standard questions about server logs into
+// parameterized SQL, over the legacy logs schema or any detected schema
+package metrics
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// Role is what a column means to the metrics, whatever it is called
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleOperation Role = "operation"
+	RoleSize      Role = "size"
+	RoleTime      Role = "time"
+)
+
+// Roles lists every role, in the order they are reported
+var Roles = []Role{RoleUser, RoleOperation, RoleSize, RoleTime}
+
+// roleColumn tells how to find the column playing a role: by name in order of
+// preference, then the first column whose name contains one of the fragments,
+// among the columns of the given types
+type roleColumn struct {
+	names     []string
+	fragments []string
+	types     []parser.ColumnType
+}
+
+var roleColumns = map[Role]roleColumn{
+	RoleUser: {
+		names:     []string{"username", "user", "user_name", "user_id", "login", "account"},
+		fragments: []string{"user"},
+		types:     []parser.ColumnType{parser.TypeText},
+	},
+	// Not method: an HTTP method (GET, POST) is not an upload or a download
+	RoleOperation: {
+		names:     []string{"operation", "op", "action", "event"},
+		fragments: []string{"operation", "action"},
+		types:     []parser.ColumnType{parser.TypeText},
+	},
+	RoleSize: {
+		names:     []string{"size", "size_kb", "kb", "bytes", "size_bytes"},
+		fragments: []string{"size", "byte"},
+		types:     []parser.ColumnType{parser.TypeInteger, parser.TypeReal},
+	},
+	RoleTime: {
+		names:     []string{"timestamp", "time", "datetime", "date", "created_at"},
+		fragments: []string{"time"},
+		types:     []parser.ColumnType{parser.TypeTimestamp},
+	},
+}
+
+// FindColumn returns the column playing the role, or nil if none does
+func FindColumn(columns []parser.ColumnSchema, role Role) *parser.ColumnSchema {
+	rc := roleColumns[role]
+	for _, name := range rc.names {
+		for i, col := range columns {
+			if strings.EqualFold(col.Name, name) && slices.Contains(rc.types, col.Type) {
+				return &columns[i]
+			}
+		}
+	}
+	for _, fragment := range rc.fragments {
+		for i, col := range columns {
+			if strings.Contains(strings.ToLower(col.Name), fragment) && slices.Contains(rc.types, col.Type) {
+				return &columns[i]
+			}
+		}
+	}
+	return nil
+}
+
+// Columns holds the column playing each role in a table, nil for roles no
+// column plays
+type Columns struct {
+	Table                       string
+	User, Operation, Size, Time *parser.ColumnSchema
+}
+
+// MapColumns finds the columns playing each role in a table. The mapping names
+// the column of a role explicitly, for tables whose columns are not found by name
+func MapColumns(schema *parser.TableSchema, mapping map[string]string) (Columns, error) {
+	found := make(map[Role]*parser.ColumnSchema)
+	for _, role := range Roles {
+		found[role] = FindColumn(schema.Columns, role)
+	}
+
+	for name, column := range mapping {
+		role := Role(strings.ToLower(strings.TrimSpace(name)))
+		if _, ok := roleColumns[role]; !ok {
+			return Columns{}, fmt.Errorf("unknown column role '%s': must be one of user, operation, size, time", name)
+		}
+		col := findByName(schema.Columns, strings.TrimSpace(column))
+		if col == nil {
+			return Columns{}, fmt.Errorf("table '%s' has no column '%s' to use as the %s column", schema.Name, column, role)
+		}
+		if !slices.Contains(roleColumns[role].types, col.Type) {
+			return Columns{}, fmt.Errorf("column '%s' is %s and cannot be the %s column", col.Name, col.Type, role)
+		}
+		found[role] = col
+	}
+
+	return Columns{
+		Table:     schema.Name,
+		User:      found[RoleUser],
+		Operation: found[RoleOperation],
+		Size:      found[RoleSize],
+		Time:      found[RoleTime],
+	}, nil
+}
+
+// findByName returns the column with the name, in any case
+func findByName(columns []parser.ColumnSchema, name string) *parser.ColumnSchema {
+	for i, col := range columns {
+		if strings.EqualFold(col.Name, name) {
+			return &columns[i]
+		}
+	}
+	return nil
+}
+
+// MissingColumnError reports that a metric or filter needs a role no column
+// of the table plays
+type MissingColumnError struct {
+	Table string
+	Role  Role
+}
+
+func (e *MissingColumnError) Error() string {
+	return fmt.Sprintf("table '%s' has no %s column", e.Table, e.Role)
+}
+
+// column returns the name of the column playing the role, or a
+// *MissingColumnError if none does
+func (c Columns) column(role Role) (string, error) {
+	cols := map[Role]*parser.ColumnSchema{RoleUser: c.User, RoleOperation: c.Operation, RoleSize: c.Size, RoleTime: c.Time}
+	if cols[role] == nil {
+		return "", &MissingColumnError{Table: c.Table, Role: role}
+	}
+	return cols[role].Name, nil
+}
+
+// sizePattern matches a size and its optional unit
+var sizePattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?)\s*(b|bytes?|kb|kib|kilobytes?|mb|mib|megabytes?|gb|gib|gigabytes?)?$`)
+
+// ParseSize converts a size such as 50kB, 2 MB or 4096 bytes to the unit of
+// the size column: bytes when its name says so, otherwise kB as in the legacy
+// schema. Units are powers of 1024, and a size without a unit is already in
+// the unit of the column
+func ParseSize(value string, column string) (float64, error) {
+	m := sizePattern.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size '%s': expected a number with an optional unit (bytes, kB, MB, GB)", value)
+	}
+	size, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s': %w", value, err)
+	}
+
+	inBytes := strings.Contains(strings.ToLower(column), "byte")
+	unit := strings.ToLower(m[2])
+	switch {
+	case unit == "":
+		return size, nil
+	case unit == "b" || strings.HasPrefix(unit, "byte"):
+		size /= 1024
+	case strings.HasPrefix(unit, "m"):
+		size *= 1024
+	case strings.HasPrefix(unit, "g"):
+		size *= 1024 * 1024
+	}
+	if inBytes {
+		size *= 1024
+	}
+	return size, nil
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// legacySchema is the fixed schema of the legacy log format
+var legacySchema = &parser.TableSchema{
+	Name: "logs",
+	Columns: []parser.ColumnSchema{
+		{Name: "timestamp", Type: parser.TypeTimestamp},
+		{Name: "username", Type: parser.TypeText},
+		{Name: "operation", Type: parser.TypeText},
+		{Name: "size", Type: parser.TypeInteger},
+	},
+}
+
+// TestMapColumns tests finding the columns of each role by name and by mapping
+func TestMapColumns(t *testing.T) {
+	access := &parser.TableSchema{
+		Name: "access",
+		Columns: []parser.ColumnSchema{
+			{Name: "ip", Type: parser.TypeText},
+			{Name: "user", Type: parser.TypeText},
+			{Name: "timestamp", Type: parser.TypeTimestamp},
+			{Name: "method", Type: parser.TypeText},
+			{Name: "status", Type: parser.TypeInteger},
+			{Name: "bytes", Type: parser.TypeInteger},
+		},
+	}
+	events := &parser.TableSchema{
+		Name: "events",
+		Columns: []parser.ColumnSchema{
+			{Name: "who", Type: parser.TypeText},
+			{Name: "created", Type: parser.TypeTimestamp},
+			{Name: "payload_size", Type: parser.TypeReal},
+			{Name: "count", Type: parser.TypeInteger},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		schema  *parser.TableSchema
+		mapping map[string]string
+		want    string // user,operation,size,time with - for none
+		wantErr string
+	}{
+		{"legacy", legacySchema, nil, "username,operation,size,timestamp", ""},
+		{"access log", access, nil, "user,-,bytes,timestamp", ""},
+		{"by fragment", events, nil, "-,-,payload_size,-", ""},
+		{"mapped", events, map[string]string{"user": "who", "Time": "CREATED"}, "who,-,payload_size,created", ""},
+		{"mapping overrides", access, map[string]string{"user": "ip", "operation": "method"}, "ip,method,bytes,timestamp", ""},
+		{"unknown role", events, map[string]string{"host": "who"}, "", "unknown column role 'host'"},
+		{"unknown column", events, map[string]string{"user": "login"}, "", "no column 'login'"},
+		{"wrong type", events, map[string]string{"size": "who"}, "", "cannot be the size column"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := MapColumns(tt.schema, tt.mapping)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MapColumns() error = %v", err)
+			}
+
+			var names []string
+			for _, col := range []*parser.ColumnSchema{columns.User, columns.Operation, columns.Size, columns.Time} {
+				if col == nil {
+					names = append(names, "-")
+				} else {
+					names = append(names, col.Name)
+				}
+			}
+			if got := strings.Join(names, ","); got != tt.want {
+				t.Errorf("MapColumns() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseSize tests converting sizes to the unit of the size column
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		column  string
+		want    float64
+		wantErr bool
+	}{
+		{"50", "size", 50, false},
+		{"50kB", "size", 50, false},
+		{"2 MB", "size", 2048, false},
+		{"1gb", "size", 1024 * 1024, false},
+		{"512 bytes", "size", 0.5, false},
+		{"50kB", "bytes", 51200, false},
+		{"4096", "size_bytes", 4096, false},
+		{"1.5KiB", "bytes", 1536, false},
+		{"100b", "bytes", 100, false},
+		{"large", "size", 0, true},
+		{"50 TB", "size", 0, true},
+		{"-5", "size", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.column, func(t *testing.T) {
+			got, err := ParseSize(tt.value, tt.column)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize() error = %v, wantErr %t", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+// Package metrics compiles the standard questions about server logs into
+// parameterized SQL, over the legacy logs schema or any detected schema
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// Metric is a value computed over the records that pass a filter
+type Metric struct {
+	Name   string // Name of the result column
+	Select string // Aggregate, with %s for the column of the role
+	Role   Role   // Role of the column aggregated, empty for COUNT(*)
+}
+
+// The standard metrics
+var (
+	Users   = Metric{Name: "users", Select: "COUNT(DISTINCT %s)", Role: RoleUser}
+	Records = Metric{Name: "count", Select: "COUNT(*)"}
+)
+
+// Filter selects records; empty fields select everything
+type Filter struct {
+	User        string
+	Operation   string
+	LargerThan  string // Strictly larger than this size, such as 50kB
+	SmallerThan string // Strictly smaller than this size
+	MinSize     string // At least this size
+	MaxSize     string // At most this size
+	Date        string // On this day (YYYY-MM-DD)
+	Since       string // At or after this time
+	Before      string // Strictly before this time
+}
+
+// Query is parameterized SQL and the values of its parameters
+type Query struct {
+	SQL  string
+	Args []interface{}
+}
+
+// Compile returns the query computing the metric over the records of the
+// table that pass the filter. Only column names, all read from the table's
+// schema, are part of the SQL; the values of the filter are parameters
+func Compile(metric Metric, columns Columns, filter Filter) (Query, error) {
+	selectExpr := metric.Select
+	if metric.Role != "" {
+		name, err := columns.column(metric.Role)
+		if err != nil {
+			return Query{}, err
+		}
+		selectExpr = fmt.Sprintf(metric.Select, name)
+	}
+
+	var conditions []string
+	var args []interface{}
+	add := func(role Role, format string, value interface{}) error {
+		name, err := columns.column(role)
+		if err != nil {
+			return err
+		}
+		conditions = append(conditions, fmt.Sprintf(format, name))
+		args = append(args, value)
+		return nil
+	}
+
+	if filter.User != "" {
+		if err := add(RoleUser, "%s = ?", filter.User); err != nil {
+			return Query{}, err
+		}
+	}
+	if filter.Operation != "" {
+		if err := add(RoleOperation, "%s = ?", filter.Operation); err != nil {
+			return Query{}, err
+		}
+	}
+	sizeBounds := []struct{ value, format string }{
+		{filter.LargerThan, "%s > ?"},
+		{filter.SmallerThan, "%s < ?"},
+		{filter.MinSize, "%s >= ?"},
+		{filter.MaxSize, "%s <= ?"},
+	}
+	for _, bound := range sizeBounds {
+		if bound.value == "" {
+			continue
+		}
+		name, err := columns.column(RoleSize)
+		if err != nil {
+			return Query{}, err
+		}
+		size, err := ParseSize(bound.value, name)
+		if err != nil {
+			return Query{}, err
+		}
+		if err := add(RoleSize, bound.format, sizeArg(size)); err != nil {
+			return Query{}, err
+		}
+	}
+	if filter.Date != "" {
+		if _, err := time.Parse("2006-01-02", filter.Date); err != nil {
+			return Query{}, fmt.Errorf("invalid date '%s': expected YYYY-MM-DD", filter.Date)
+		}
+		if err := add(RoleTime, "date(%s) = ?", filter.Date); err != nil {
+			return Query{}, err
+		}
+	}
+	for _, bound := range []struct{ value, format string }{{filter.Since, "%s >= ?"}, {filter.Before, "%s < ?"}} {
+		if bound.value == "" {
+			continue
+		}
+		t, err := parser.ParseTimestamp(bound.value, time.UTC)
+		if err != nil {
+			return Query{}, fmt.Errorf("invalid time '%s': %w", bound.value, err)
+		}
+		if err := add(RoleTime, bound.format, parser.FormatTimestamp(t)); err != nil {
+			return Query{}, err
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT %s AS %s FROM %s", selectExpr, metric.Name, columns.Table)
+	if len(conditions) > 0 {
+		fmt.Fprintf(&b, " WHERE %s", strings.Join(conditions, " AND "))
+	}
+	return Query{SQL: b.String(), Args: args}, nil
+}
+
+// sizeArg returns a whole size as an integer, so that it reads as one
+func sizeArg(size float64) interface{} {
+	if size == math.Trunc(size) && math.Abs(size) < math.MaxInt64 {
+		return int64(size)
+	}
+	return size
+}
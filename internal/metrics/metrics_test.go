@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestCompile tests compiling metrics and filters into parameterized SQL
+func TestCompile(t *testing.T) {
+	legacy, err := MapColumns(legacySchema, nil)
+	if err != nil {
+		t.Fatalf("MapColumns() error = %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		metric   Metric
+		filter   Filter
+		wantSQL  string
+		wantArgs string
+	}{
+		{
+			"users", Users, Filter{},
+			"SELECT COUNT(DISTINCT username) AS users FROM logs", "[]",
+		},
+		{
+			"large uploads", Records, Filter{Operation: "upload", LargerThan: "50kB"},
+			"SELECT COUNT(*) AS count FROM logs WHERE operation = ? AND size > ?", "[upload 50]",
+		},
+		{
+			"uploads of at least a size", Records, Filter{Operation: "upload", MinSize: "50kB"},
+			"SELECT COUNT(*) AS count FROM logs WHERE operation = ? AND size >= ?", "[upload 50]",
+		},
+		{
+			"small downloads", Records, Filter{Operation: "download", SmallerThan: "1MB"},
+			"SELECT COUNT(*) AS count FROM logs WHERE operation = ? AND size < ?", "[download 1024]",
+		},
+		{
+			"user on a day", Records, Filter{User: "jeff22", Operation: "upload", Date: "2020-04-15"},
+			"SELECT COUNT(*) AS count FROM logs WHERE username = ? AND operation = ? AND date(timestamp) = ?", "[jeff22 upload 2020-04-15]",
+		},
+		{
+			"size and time ranges", Users, Filter{MinSize: "512 bytes", MaxSize: "2MB", Since: "2020-04-15", Before: "2020-04-16T12:00:00+02:00"},
+			"SELECT COUNT(DISTINCT username) AS users FROM logs WHERE size >= ? AND size <= ? AND timestamp >= ? AND timestamp < ?",
+			"[0.5 2048 2020-04-15 00:00:00 2020-04-16 10:00:00]",
+		},
+		{
+			"values are never part of the SQL", Records, Filter{User: "x' OR '1'='1"},
+			"SELECT COUNT(*) AS count FROM logs WHERE username = ?", "[x' OR '1'='1]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := Compile(tt.metric, legacy, tt.filter)
+			if err != nil {
+				t.Fatalf("Compile() error = %v", err)
+			}
+			if query.SQL != tt.wantSQL {
+				t.Errorf("SQL =\n%s\nwant\n%s", query.SQL, tt.wantSQL)
+			}
+			if got := fmt.Sprint(query.Args); got != tt.wantArgs {
+				t.Errorf("Args = %s, want %s", got, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// TestCompileErrors tests filters that cannot be compiled
+func TestCompileErrors(t *testing.T) {
+	legacy, err := MapColumns(legacySchema, nil)
+	if err != nil {
+		t.Fatalf("MapColumns() error = %v", err)
+	}
+	noSize := legacy
+	noSize.Size = nil
+
+	tests := []struct {
+		name    string
+		columns Columns
+		filter  Filter
+		wantErr string
+	}{
+		{"invalid size", legacy, Filter{MinSize: "big"}, "invalid size 'big'"},
+		{"invalid date", legacy, Filter{Date: "April 15"}, "invalid date 'April 15'"},
+		{"invalid time", legacy, Filter{Since: "yesterday"}, "invalid time 'yesterday'"},
+		{"missing column", noSize, Filter{MaxSize: "2MB"}, "table 'logs' has no size column"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(Records, tt.columns, tt.filter)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	var missing *MissingColumnError
+	if _, err := Compile(Users, Columns{Table: "events"}, Filter{}); !errors.As(err, &missing) || missing.Role != RoleUser {
+		t.Errorf("Expected a missing user column error, got %v", err)
+	}
+}
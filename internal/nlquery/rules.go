@@ -0,0 +1,556 @@
+// Package nlquery translates natural language questions about a table into SQL
+package nlquery
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"server-log-analyzer/internal/metrics"
+	"server-log-analyzer/internal/parser"
+)
+
+// RuleTranslator translates questions with fixed phrase rules. It recognises
+// what to compute (how many, how many users, total, average, largest,
+// smallest, which users, list), filters on users, on the values of columns
+// with few distinct values (uploads, downloaded), on sizes (over 50kB) and on
+// dates (on April 15th, before 2020-04-15, in April), and grouping (per user,
+// by day, top 5 users). A word it does not understand, such as a relative
+// date (yesterday) or a noun that is neither a column nor a value, is an error
+// rather than left out of the query. Values are bound as named parameters,
+// never spliced into the SQL. The same question about the same table always
+// gives the same query
+type RuleTranslator struct{}
+
+// monthPattern matches month names and their abbreviations
+const monthPattern = `jan(?:uary)?|feb(?:ruary)?|mar(?:ch)?|apr(?:il)?|may|june?|july?|aug(?:ust)?|sep(?:t(?:ember)?)?|oct(?:ober)?|nov(?:ember)?|dec(?:ember)?`
+
+// datePrepositionPattern matches the words before a date and dateOperators
+// gives the comparison each stands for
+const datePrepositionPattern = `(?:(on|before|after|since|until)\s+)?`
+
+var dateOperators = map[string]string{"": "=", "on": "=", "before": "<", "after": ">", "since": ">=", "until": "<="}
+
+var (
+	// What to compute, checked in order against the whole question
+	countUsersPattern    = regexp.MustCompile(`(?i)\b(?:how many|number of|count(?: of)?)\s+(?:(?:distinct|unique|different)\s+)?users\b`)
+	countPattern         = regexp.MustCompile(`(?i)\b(?:how many|number of|count)\b`)
+	averagePattern       = regexp.MustCompile(`(?i)\b(?:average|avg|mean)\b`)
+	maxPattern           = regexp.MustCompile(`(?i)\b(?:largest|biggest|maximum|max)\b`)
+	minPattern           = regexp.MustCompile(`(?i)\b(?:smallest|minimum|min)\b`)
+	sumPattern           = regexp.MustCompile(`(?i)\b(?:total|sum of|how much)\b`)
+	distinctUsersPattern = regexp.MustCompile(`(?i)\b(?:which|what|list(?: the)?|show(?: the)?)\s+users\b|\bwho\b`)
+	listPattern          = regexp.MustCompile(`(?i)\b(?:list|show)\b`)
+
+	// Grouping
+	topPattern      = regexp.MustCompile(`(?i)\btop\s+(\d+)\s+(\w+)`)
+	groupPattern    = regexp.MustCompile(`(?i)\b(?:per|by|for each|each)\s+(\w+)`)
+	periodicPattern = regexp.MustCompile(`(?i)\b(hourly|daily|monthly|yearly)\b`)
+
+	// Dates
+	isoDatePattern   = regexp.MustCompile(`(?i)\b` + datePrepositionPattern + `(\d{4})-(\d{2})-(\d{2})\b`)
+	monthDayPattern  = regexp.MustCompile(`(?i)\b` + datePrepositionPattern + `(` + monthPattern + `)\.?\s+(\d{1,2})(?:st|nd|rd|th)?\b(?:,?\s+(\d{4})\b)?`)
+	dayMonthPattern  = regexp.MustCompile(`(?i)\b` + datePrepositionPattern + `(?:the\s+)?(\d{1,2})(?:st|nd|rd|th)?\s+(?:of\s+)?(` + monthPattern + `)\b(?:,?\s+(\d{4})\b)?`)
+	monthOnlyPattern = regexp.MustCompile(`(?i)\bin\s+(` + monthPattern + `)\b(?:\s+(\d{4})\b)?`)
+	yearOnlyPattern  = regexp.MustCompile(`(?i)\bin\s+(\d{4})\b`)
+	monthNamePattern = regexp.MustCompile(`(?i)^(?:` + monthPattern + `)$`)
+
+	// Sizes
+	sizePattern = regexp.MustCompile(`(?i)\b(over|above|exceeding|more than|greater than|larger than|bigger than|under|below|less than|smaller than|at least|at most)\s+(\d+(?:\.\d+)?)\s*(kb|kib|kilobytes?|mb|mib|megabytes?|gb|gib|gigabytes?|bytes?)?\b`)
+
+	// Relative dates, which need a current time the query does not have
+	relativeDatePattern = regexp.MustCompile(`(?i)\b(?:yesterday|today|tonight|tomorrow|now|recent(?:ly)?|(?:last|past|previous|this|next|current)\s+(?:\d+\s+)?(?:hours?|days?|weeks?|weekend|months?|years?)|\d+\s+(?:hours?|days?|weeks?|months?|years?)\s+ago)\b`)
+
+	// Words left over once every rule took its phrases
+	wordPattern = regexp.MustCompile(`[\w@][\w.@'-]*`)
+
+	// Users, after the other rules took their words
+	userPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\b(?:user|username)\s+([\w.@-]+)`),
+		regexp.MustCompile(`(?i)\bdid\s+([\w.@-]+)\s+(?:do|make|perform|have|upload|download|\x00)`), // \x00: a verb another rule took
+		regexp.MustCompile(`(?i)\b([\w.@-]+)'s\b`),
+		regexp.MustCompile(`(?i)\b(?:by|for|from)\s+([\w.@-]+)`),
+	}
+)
+
+// periodicGroups gives the period of each adverb
+var periodicGroups = map[string]string{"hourly": "hour", "daily": "day", "monthly": "month", "yearly": "year"}
+
+// sizeOperators gives the comparison of each size phrase
+var sizeOperators = map[string]string{
+	"over": ">", "above": ">", "exceeding": ">", "more than": ">", "greater than": ">", "larger than": ">", "bigger than": ">",
+	"under": "<", "below": "<", "less than": "<", "smaller than": "<",
+	"at least": ">=", "at most": "<=",
+}
+
+// stopWords are never taken as user names
+var stopWords = []string{"a", "an", "the", "all", "any", "each", "every", "me", "us", "them", "it", "this", "that", "files", "file", "data", "size"}
+
+// fillerWords may be left over from a question without changing its meaning:
+// question words, articles, prepositions, common verbs, words for records and
+// for the server the logs come from
+var fillerWords = []string{
+	"a", "an", "the", "and", "of", "in", "on", "at", "by", "for", "from", "to", "into", "onto", "with", "per", "each", "every", "all", "any",
+	"how", "what", "which", "is", "are", "was", "were", "be", "been", "there", "do", "does", "did", "done", "have", "has", "had",
+	"happen", "happened", "occur", "occurred", "made", "make", "performed", "perform", "me", "please", "give", "tell", "show", "list",
+	"access", "accessed", "accesses", "accessing", "use", "used", "using", "visit", "visited", "connect", "connected", "logged",
+	"many", "much", "number", "count", "total", "distinct", "unique", "different", "users", "user", "time", "times",
+	"records", "record", "rows", "row", "entries", "entry", "events", "event", "requests", "request",
+	"lines", "line", "logs", "log", "files", "file", "data",
+	"server", "servers", "system", "site", "website", "service", "host", "machine",
+}
+
+// translation holds what was found in a question so far
+type translation struct {
+	table Table
+	rest  string // The question, with the phrases already understood blanked out
+
+	user, time, size *parser.ColumnSchema
+
+	selectExpr, selectName string
+	distinct, list         bool
+	conditions             []string
+	args                   []interface{} // Values of the conditions, as sql.Named
+	groupExpr, groupName   string
+	limit                  int
+}
+
+// Translate returns the query answering the question and the values of its
+// parameters
+func (RuleTranslator) Translate(question string, table Table) (string, []interface{}, error) {
+	t := &translation{
+		table: table,
+		rest:  question,
+		user:  metrics.FindColumn(table.Columns, metrics.RoleUser),
+		time:  metrics.FindColumn(table.Columns, metrics.RoleTime),
+		size:  metrics.FindColumn(table.Columns, metrics.RoleSize),
+	}
+
+	steps := []func() error{t.findAggregate, t.findGroup, t.findDates, t.findSizes, t.findValues, t.findUsers, t.checkRest}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return "", nil, err
+		}
+	}
+	return t.sql(), t.args, nil
+}
+
+// take returns the submatches of every match of the pattern in what is left
+// of the question, and blanks the matches out so no other rule reads them
+func (t *translation) take(re *regexp.Regexp) [][]string {
+	matches := re.FindAllStringSubmatch(t.rest, -1)
+	t.rest = re.ReplaceAllStringFunc(t.rest, blank)
+	return matches
+}
+
+// blank replaces a phrase that was understood with NUL characters, which no
+// pattern matches, not even as white space between two words, except the user
+// pattern telling a verb was there
+func blank(phrase string) string {
+	return strings.Repeat("\x00", len(phrase))
+}
+
+// addCondition adds a WHERE condition unless the query already has it
+func (t *translation) addCondition(condition string) {
+	if !slices.Contains(t.conditions, condition) {
+		t.conditions = append(t.conditions, condition)
+	}
+}
+
+// bind adds a parameter with the value and returns its placeholder. The name
+// is made unique with a number, :operation_2, and a value already bound keeps
+// its parameter, so that a condition repeated in a question is added once
+func (t *translation) bind(name string, value interface{}) string {
+	for _, arg := range t.args {
+		if named := arg.(sql.NamedArg); named.Value == value {
+			return ":" + named.Name
+		}
+	}
+
+	unique := name
+	for i := 2; t.hasParam(unique); i++ {
+		unique = fmt.Sprintf("%s_%d", name, i)
+	}
+	t.args = append(t.args, sql.Named(unique, value))
+	return ":" + unique
+}
+
+// hasParam reports whether a parameter with the name was bound
+func (t *translation) hasParam(name string) bool {
+	for _, arg := range t.args {
+		if arg.(sql.NamedArg).Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// findAggregate decides what the query computes
+func (t *translation) findAggregate() error {
+	q := t.rest
+	sizeAggregate := func(function, prefix string) error {
+		if t.size == nil {
+			return fmt.Errorf("table '%s' has no size column to compute the %s of", t.table.Name, strings.ToLower(prefix))
+		}
+		t.selectExpr = fmt.Sprintf("%s(%s)", function, t.size.Name)
+		t.selectName = prefix + "_" + t.size.Name
+		return nil
+	}
+
+	// The words of the aggregate are taken; grouping words are left to findGroup
+	switch {
+	case countUsersPattern.MatchString(q):
+		t.take(countUsersPattern)
+		if t.user == nil {
+			return fmt.Errorf("table '%s' has no user column", t.table.Name)
+		}
+		t.selectExpr, t.selectName = fmt.Sprintf("COUNT(DISTINCT %s)", t.user.Name), "users"
+	case countPattern.MatchString(q):
+		t.take(countPattern)
+		t.selectExpr, t.selectName = "COUNT(*)", "count"
+	case averagePattern.MatchString(q):
+		t.take(averagePattern)
+		return sizeAggregate("AVG", "average")
+	case maxPattern.MatchString(q):
+		t.take(maxPattern)
+		return sizeAggregate("MAX", "max")
+	case minPattern.MatchString(q):
+		t.take(minPattern)
+		return sizeAggregate("MIN", "min")
+	case sumPattern.MatchString(q):
+		t.take(sumPattern)
+		return sizeAggregate("SUM", "total")
+	case distinctUsersPattern.MatchString(q):
+		if t.user == nil {
+			return fmt.Errorf("table '%s' has no user column", t.table.Name)
+		}
+		t.take(distinctUsersPattern)
+		t.distinct = true
+	case listPattern.MatchString(q):
+		t.take(listPattern)
+		t.list = true
+	case topPattern.MatchString(q), periodicPattern.MatchString(q):
+		t.selectExpr, t.selectName = "COUNT(*)", "count" // top 5 users, hourly uploads
+	default:
+		return fmt.Errorf("could not tell what to compute: ask 'how many', 'total', 'average', 'largest', 'smallest', 'which users' or 'list'")
+	}
+	return nil
+}
+
+// findGroup finds the column or period results are grouped by
+func (t *translation) findGroup() error {
+	for _, m := range t.take(topPattern) {
+		limit, err := strconv.Atoi(m[1])
+		if err != nil || limit <= 0 {
+			return fmt.Errorf("invalid number of results '%s'", m[1])
+		}
+		t.limit = limit
+		t.setGroup(m[2])
+	}
+
+	for _, m := range groupPattern.FindAllStringSubmatch(t.rest, -1) {
+		if t.setGroup(m[1]) {
+			t.rest = strings.Replace(t.rest, m[0], blank(m[0]), 1)
+		}
+	}
+
+	for _, m := range t.take(periodicPattern) {
+		t.setGroup(periodicGroups[strings.ToLower(m[1])])
+	}
+	return nil
+}
+
+// setGroup groups by a period (hour, day, month, year), the user column or a
+// column named by the word, singular or plural, and reports whether it did
+func (t *translation) setGroup(word string) bool {
+	word = strings.ToLower(word)
+	singular := strings.TrimSuffix(word, "s")
+
+	periods := map[string]string{
+		"hour":  "%Y-%m-%d %H:00",
+		"day":   "%Y-%m-%d",
+		"date":  "%Y-%m-%d",
+		"month": "%Y-%m",
+		"year":  "%Y",
+	}
+	if format, ok := periods[singular]; ok && t.time != nil {
+		if singular == "date" {
+			singular = "day"
+		}
+		t.groupExpr, t.groupName = fmt.Sprintf("strftime('%s', %s)", format, t.time.Name), singular
+		return true
+	}
+
+	if singular == "user" && t.user != nil {
+		t.groupExpr, t.groupName = t.user.Name, t.user.Name
+		return true
+	}
+	for _, name := range []string{word, singular} {
+		if col := t.table.Column(name); col != nil {
+			t.groupExpr, t.groupName = col.Name, col.Name
+			return true
+		}
+	}
+	return false
+}
+
+// findDates adds the conditions on the time column
+func (t *translation) findDates() error {
+	var found [][]string
+	add := func(operator, expr, value string) {
+		found = append(found, []string{operator, expr, value})
+	}
+
+	for _, m := range t.take(isoDatePattern) {
+		if _, err := time.Parse("2006-01-02", m[2]+"-"+m[3]+"-"+m[4]); err != nil {
+			return fmt.Errorf("invalid date '%s-%s-%s'", m[2], m[3], m[4])
+		}
+		add(m[1], "date(%s)", m[2]+"-"+m[3]+"-"+m[4])
+	}
+	for _, re := range []*regexp.Regexp{monthDayPattern, dayMonthPattern} {
+		for _, m := range t.take(re) {
+			month, day := m[2], m[3]
+			if re == dayMonthPattern {
+				month, day = m[3], m[2]
+			}
+			expr, value, err := monthDay(month, day, m[4])
+			if err != nil {
+				return err
+			}
+			add(m[1], expr, value)
+		}
+	}
+	for _, m := range t.take(monthOnlyPattern) {
+		value := fmt.Sprintf("%02d", monthNumber(m[1]))
+		if m[2] != "" {
+			add("", "strftime('%%Y-%%m', %s)", m[2]+"-"+value)
+		} else {
+			add("", "strftime('%%m', %s)", value)
+		}
+	}
+	for _, m := range t.take(yearOnlyPattern) {
+		add("", "strftime('%%Y', %s)", m[1])
+	}
+
+	if len(found) == 0 {
+		return nil
+	}
+	if t.time == nil {
+		return fmt.Errorf("table '%s' has no timestamp column to filter dates on", t.table.Name)
+	}
+	for _, f := range found {
+		expr := fmt.Sprintf(f[1], t.time.Name)
+		t.addCondition(fmt.Sprintf("%s %s %s", expr, dateOperators[strings.ToLower(f[0])], t.bind("date", f[2])))
+	}
+	return nil
+}
+
+// monthDay returns the expression format and value comparing timestamps to a
+// day of a month, of any year unless one is given
+func monthDay(month, day, year string) (string, string, error) {
+	d, _ := strconv.Atoi(day)
+	m := monthNumber(month)
+	y := 2000 // A leap year, so that February 29th is valid without a year
+	if year != "" {
+		y, _ = strconv.Atoi(year)
+	}
+	date := time.Date(y, time.Month(m), d, 0, 0, 0, 0, time.UTC)
+	if date.Day() != d {
+		return "", "", fmt.Errorf("invalid date '%s %s'", month, day)
+	}
+
+	if year == "" {
+		return "strftime('%%m-%%d', %s)", date.Format("01-02"), nil
+	}
+	return "date(%s)", date.Format("2006-01-02"), nil
+}
+
+// monthNumber returns the number of a month from its name or abbreviation
+func monthNumber(name string) int {
+	months := []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	return slices.Index(months, strings.ToLower(name)[:3]) + 1
+}
+
+// findSizes adds the conditions on the size column
+// A size without a unit is in the unit of the column: bytes for columns whose
+// name mentions bytes, kB otherwise. Units are powers of 1024
+func (t *translation) findSizes() error {
+	matches := t.take(sizePattern)
+	if len(matches) == 0 {
+		return nil
+	}
+	if t.size == nil {
+		return fmt.Errorf("table '%s' has no size column to compare '%s' with", t.table.Name, strings.TrimSpace(matches[0][0]))
+	}
+
+	for _, m := range matches {
+		value, err := metrics.ParseSize(m[2]+m[3], t.size.Name)
+		if err != nil {
+			return err
+		}
+
+		operator := sizeOperators[strings.Join(strings.Fields(strings.ToLower(m[1])), " ")]
+		t.addCondition(fmt.Sprintf("%s %s %s", t.size.Name, operator, t.bind(t.size.Name, sizeValue(value))))
+	}
+	return nil
+}
+
+// findValues adds conditions for the known values of columns named in the
+// question, in any inflection: uploads and uploaded select 'upload'
+func (t *translation) findValues() error {
+	for _, col := range t.table.Columns {
+		var matched []string
+		for _, value := range t.table.Values[col.Name] {
+			if value == "" {
+				continue
+			}
+			re := regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(value) + `(?:s|es|d|ed|ing)?\b`)
+			if len(t.take(re)) > 0 {
+				matched = append(matched, value)
+			}
+		}
+
+		switch len(matched) {
+		case 0:
+		case 1:
+			t.addCondition(fmt.Sprintf("%s = %s", col.Name, t.bind(col.Name, matched[0])))
+		default:
+			placeholders := make([]string, len(matched))
+			for i, value := range matched {
+				placeholders[i] = t.bind(col.Name, value)
+			}
+			t.addCondition(fmt.Sprintf("%s IN (%s)", col.Name, strings.Join(placeholders, ", ")))
+		}
+	}
+	return nil
+}
+
+// findUsers adds a condition for the user named in the question
+func (t *translation) findUsers() error {
+	if t.user == nil {
+		return nil
+	}
+	for _, re := range userPatterns {
+		for _, m := range t.take(re) {
+			if t.isStopWord(m[1]) {
+				continue
+			}
+			t.addCondition(fmt.Sprintf("%s = %s", t.user.Name, t.bind(t.user.Name, m[1])))
+		}
+	}
+	return nil
+}
+
+// checkRest fails on the words no rule understood, unless they are filler
+// words, names of columns or of the table, or values of a column: leaving
+// them out would answer another question than the one asked
+func (t *translation) checkRest() error {
+	if m := relativeDatePattern.FindString(t.rest); m != "" {
+		return fmt.Errorf("could not understand '%s': relative dates are not supported, give a date such as 2020-04-15 or April 15th", m)
+	}
+
+	for _, word := range wordPattern.FindAllString(t.rest, -1) {
+		word = strings.TrimRight(word, ".'-")
+		lower := strings.ToLower(word)
+		singular := strings.TrimSuffix(lower, "s")
+		if word == "" || slices.Contains(fillerWords, lower) || strings.EqualFold(t.table.Name, lower) ||
+			t.table.Column(lower) != nil || t.table.Column(singular) != nil || t.isValue(lower) {
+			continue
+		}
+		return fmt.Errorf("could not understand '%s': it is neither a column of table '%s' nor one of its values", word, t.table.Name)
+	}
+	return nil
+}
+
+// isValue reports whether a word is a known value of a column, in any
+// inflection, as findValues matches them
+func (t *translation) isValue(word string) bool {
+	for _, values := range t.table.Values {
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			value = strings.ToLower(value)
+			for _, suffix := range []string{"", "s", "es", "d", "ed", "ing"} {
+				if word == value+suffix {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isStopWord reports whether a word cannot be a user name: a common word, a
+// month, a column name or a word for a period
+func (t *translation) isStopWord(word string) bool {
+	lower := strings.ToLower(word)
+	singular := strings.TrimSuffix(lower, "s")
+	if slices.Contains(stopWords, lower) || t.table.Column(lower) != nil || t.table.Column(singular) != nil {
+		return true
+	}
+	if monthNamePattern.MatchString(lower) {
+		return true
+	}
+	return slices.Contains([]string{"user", "hour", "day", "date", "week", "month", "year"}, singular)
+}
+
+// sql assembles the query
+func (t *translation) sql() string {
+	var b strings.Builder
+
+	// Grouped lists become counts per group
+	if t.groupExpr != "" && (t.distinct || t.list) {
+		if t.distinct {
+			t.selectExpr, t.selectName = fmt.Sprintf("COUNT(DISTINCT %s)", t.user.Name), "users"
+		} else {
+			t.selectExpr, t.selectName = "COUNT(*)", "count"
+		}
+		t.distinct, t.list = false, false
+	}
+
+	switch {
+	case t.distinct:
+		fmt.Fprintf(&b, "SELECT DISTINCT %s FROM %s", t.user.Name, t.table.Name)
+	case t.list:
+		fmt.Fprintf(&b, "SELECT * FROM %s", t.table.Name)
+	case t.groupExpr != "" && t.groupExpr == t.groupName:
+		fmt.Fprintf(&b, "SELECT %s, %s AS %s FROM %s", t.groupExpr, t.selectExpr, t.selectName, t.table.Name)
+	case t.groupExpr != "":
+		fmt.Fprintf(&b, "SELECT %s AS %s, %s AS %s FROM %s", t.groupExpr, t.groupName, t.selectExpr, t.selectName, t.table.Name)
+	default:
+		fmt.Fprintf(&b, "SELECT %s AS %s FROM %s", t.selectExpr, t.selectName, t.table.Name)
+	}
+
+	if len(t.conditions) > 0 {
+		fmt.Fprintf(&b, " WHERE %s", strings.Join(t.conditions, " AND "))
+	}
+
+	switch {
+	case t.groupExpr != "" && t.limit > 0:
+		fmt.Fprintf(&b, " GROUP BY %s ORDER BY %s DESC, %s LIMIT %d", t.groupName, t.selectName, t.groupName, t.limit)
+	case t.groupExpr != "":
+		fmt.Fprintf(&b, " GROUP BY %s ORDER BY %s", t.groupName, t.groupName)
+	case t.distinct:
+		fmt.Fprintf(&b, " ORDER BY %s", t.user.Name)
+	case t.list && t.limit > 0 && t.size != nil:
+		fmt.Fprintf(&b, " ORDER BY %s DESC LIMIT %d", t.size.Name, t.limit)
+	case t.list && t.time != nil:
+		fmt.Fprintf(&b, " ORDER BY %s", t.time.Name)
+	}
+	return b.String()
+}
+
+// sizeValue returns a size as an integer when it is whole, so that it is
+// bound and printed as 51200 rather than 51200.0
+func sizeValue(size float64) interface{} {
+	if size == math.Trunc(size) {
+		return int64(size)
+	}
+	return size
+}
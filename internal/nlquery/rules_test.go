@@ -0,0 +1,207 @@
+package nlquery
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// logsTable is the legacy log table, with the values of its operation column
+var logsTable = Table{
+	Name: "logs",
+	Columns: []parser.ColumnSchema{
+		{Name: "timestamp", Type: parser.TypeTimestamp},
+		{Name: "username", Type: parser.TypeText},
+		{Name: "operation", Type: parser.TypeText},
+		{Name: "size", Type: parser.TypeInteger},
+	},
+	Values: map[string][]string{"operation": {"download", "upload"}},
+}
+
+// TestRuleTranslatorTranslate tests translating questions about the log table
+func TestRuleTranslatorTranslate(t *testing.T) {
+	tests := []struct {
+		question string
+		want     string
+		wantArgs string
+	}{
+		{
+			"how many uploads over 50kB did jeff22 do on April 15th?",
+			"SELECT COUNT(*) AS count FROM logs WHERE strftime('%m-%d', timestamp) = :date AND size > :size AND operation = :operation AND username = :username",
+			":date = '04-15', :size = 50, :operation = 'upload', :username = 'jeff22'",
+		},
+		{
+			"How many unique users are there?",
+			"SELECT COUNT(DISTINCT username) AS users FROM logs",
+			"",
+		},
+		{
+			"how many users uploaded files in April 2020",
+			"SELECT COUNT(DISTINCT username) AS users FROM logs WHERE strftime('%Y-%m', timestamp) = :date AND operation = :operation",
+			":date = '2020-04', :operation = 'upload'",
+		},
+		{
+			"total size of downloads per day",
+			"SELECT strftime('%Y-%m-%d', timestamp) AS day, SUM(size) AS total_size FROM logs WHERE operation = :operation GROUP BY day ORDER BY day",
+			":operation = 'download'",
+		},
+		{
+			"top 3 users by uploads",
+			"SELECT username, COUNT(*) AS count FROM logs WHERE operation = :operation GROUP BY username ORDER BY count DESC, username LIMIT 3",
+			":operation = 'upload'",
+		},
+		{
+			"which users downloaded at least 2MB before 2020-04-15?",
+			"SELECT DISTINCT username FROM logs WHERE date(timestamp) < :date AND size >= :size AND operation = :operation ORDER BY username",
+			":date = '2020-04-15', :size = 2048, :operation = 'download'",
+		},
+		{
+			"average size of alice's uploads since 1st of April, 2020",
+			"SELECT AVG(size) AS average_size FROM logs WHERE date(timestamp) >= :date AND operation = :operation AND username = :username",
+			":date = '2020-04-01', :operation = 'upload', :username = 'alice'",
+		},
+		{
+			"list downloads from bob42 under 4096 bytes",
+			"SELECT * FROM logs WHERE size < :size AND operation = :operation AND username = :username ORDER BY timestamp",
+			":size = 4, :operation = 'download', :username = 'bob42'",
+		},
+		{
+			"hourly uploads and downloads",
+			"SELECT strftime('%Y-%m-%d %H:00', timestamp) AS hour, COUNT(*) AS count FROM logs WHERE operation IN (:operation, :operation_2) GROUP BY hour ORDER BY hour",
+			":operation = 'download', :operation_2 = 'upload'",
+		},
+		{
+			"largest upload for bob.smith",
+			"SELECT MAX(size) AS max_size FROM logs WHERE operation = :operation AND username = :username",
+			":operation = 'upload', :username = 'bob.smith'",
+		},
+		{
+			"How many records are there in the logs?",
+			"SELECT COUNT(*) AS count FROM logs",
+			"",
+		},
+		{
+			"how many uploads over 1.5kB and at most 3kB?",
+			"SELECT COUNT(*) AS count FROM logs WHERE size > :size AND size <= :size_2 AND operation = :operation",
+			":size = 1.5, :size_2 = 3, :operation = 'upload'",
+		},
+		{
+			"how many uploads by jeff22 from user jeff22",
+			"SELECT COUNT(*) AS count FROM logs WHERE operation = :operation AND username = :username",
+			":operation = 'upload', :username = 'jeff22'",
+		},
+		// The challenge questions
+		{
+			"How many users accessed the server?",
+			"SELECT COUNT(DISTINCT username) AS users FROM logs",
+			"",
+		},
+		{
+			"How many uploads were larger than 50kB?",
+			"SELECT COUNT(*) AS count FROM logs WHERE size > :size AND operation = :operation",
+			":size = 50, :operation = 'upload'",
+		},
+		{
+			"How many times did jeff22 upload to the server on April 15th, 2020?",
+			"SELECT COUNT(*) AS count FROM logs WHERE date(timestamp) = :date AND operation = :operation AND username = :username",
+			":date = '2020-04-15', :operation = 'upload', :username = 'jeff22'",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.question, func(t *testing.T) {
+			got, args, err := RuleTranslator{}.Translate(tt.question, logsTable)
+			if err != nil {
+				t.Fatalf("Translate() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Translate() =\n%s\nwant\n%s", got, tt.want)
+			}
+			if got := formatArgs(args); got != tt.wantArgs {
+				t.Errorf("Translate() args = %s, want %s", got, tt.wantArgs)
+			}
+		})
+	}
+}
+
+// formatArgs prints named parameters as :name = value, quoting strings
+func formatArgs(args []interface{}) string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		named := arg.(sql.NamedArg)
+		if s, ok := named.Value.(string); ok {
+			values[i] = fmt.Sprintf(":%s = '%s'", named.Name, s)
+		} else {
+			values[i] = fmt.Sprintf(":%s = %v", named.Name, named.Value)
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// TestRuleTranslatorErrors tests questions that cannot be translated
+func TestRuleTranslatorErrors(t *testing.T) {
+	noSize := Table{
+		Name:    "events",
+		Columns: []parser.ColumnSchema{{Name: "username", Type: parser.TypeText}},
+	}
+
+	tests := []struct {
+		name     string
+		question string
+		table    Table
+		wantErr  string
+	}{
+		{"no intent", "uploads by jeff22", logsTable, "could not tell what to compute"},
+		{"no size column", "average size per user", noSize, "no size column"},
+		{"no timestamp column", "how many events on April 15th", noSize, "no timestamp column"},
+		{"invalid date", "how many uploads on February 30th", logsTable, "invalid date"},
+		{"relative date", "how many errors happened yesterday?", logsTable, "could not understand 'yesterday': relative dates are not supported"},
+		{"relative period", "how many uploads last week", logsTable, "could not understand 'last week'"},
+		{"days ago", "which users downloaded 3 days ago", logsTable, "could not understand '3 days ago'"},
+		{"unknown noun", "how many errors happened?", logsTable, "could not understand 'errors': it is neither a column of table 'logs' nor one of its values"},
+		{"unknown noun after filters", "average size of uploads over 2MB per region", logsTable, "could not understand 'region'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := RuleTranslator{}.Translate(tt.question, tt.table)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// fixedTranslator answers every question with the same query
+type fixedTranslator string
+
+func (f fixedTranslator) Translate(string, Table) (string, []interface{}, error) {
+	return string(f), nil, nil
+}
+
+// TestTranslatorRegistry tests registering and choosing translators by name
+func TestTranslatorRegistry(t *testing.T) {
+	if _, err := New(DefaultTranslator); err != nil {
+		t.Fatalf("New(%q) error = %v", DefaultTranslator, err)
+	}
+	if _, err := New("oracle"); err == nil || !strings.Contains(err.Error(), "unknown translator 'oracle'") {
+		t.Errorf("Expected unknown translator error, got %v", err)
+	}
+
+	Register("fixed", func() Translator { return fixedTranslator("SELECT 1") })
+	defer delete(translators, "fixed")
+
+	translator, err := New("fixed")
+	if err != nil {
+		t.Fatalf("New(\"fixed\") error = %v", err)
+	}
+	if got, _, _ := translator.Translate("anything", logsTable); got != "SELECT 1" {
+		t.Errorf("Translate() = %q, want SELECT 1", got)
+	}
+	if names := Names(); strings.Join(names, ",") != "fixed,rules" {
+		t.Errorf("Names() = %v, want [fixed rules]", names)
+	}
+}
@@ -0,0 +1,67 @@
+// Package nlquery translates natural language questions about a table into SQL
+package nlquery
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"server-log-analyzer/internal/parser"
+)
+
+// Table describes the table a question is asked about
+type Table struct {
+	Name    string
+	Columns []parser.ColumnSchema // As read with PRAGMA table_info
+	Values  map[string][]string   // Distinct values of the TEXT columns that have few, by column
+}
+
+// Column returns the column with the given name, or nil if the table has none
+func (t Table) Column(name string) *parser.ColumnSchema {
+	for i := range t.Columns {
+		if strings.EqualFold(t.Columns[i].Name, name) {
+			return &t.Columns[i]
+		}
+	}
+	return nil
+}
+
+// Translator turns a question into a single SQL query over the table and the
+// values of its parameters, as sql.Named for :name placeholders
+// The query is not trusted: callers check it with ValidateReadOnlyQuery
+type Translator interface {
+	Translate(question string, table Table) (string, []interface{}, error)
+}
+
+// DefaultTranslator is the name of the translator used when none is chosen
+const DefaultTranslator = "rules"
+
+// translators holds the constructors of the registered translators by name
+var translators = map[string]func() Translator{
+	DefaultTranslator: func() Translator { return RuleTranslator{} },
+}
+
+// Register makes a translator available under a name, replacing any
+// translator registered with that name before
+func Register(name string, factory func() Translator) {
+	translators[name] = factory
+}
+
+// New returns the translator registered under the name
+func New(name string) (Translator, error) {
+	factory, ok := translators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown translator '%s': must be one of %s", name, strings.Join(Names(), ", "))
+	}
+	return factory(), nil
+}
+
+// Names returns the names of the registered translators, sorted
+func Names() []string {
+	names := make([]string, 0, len(translators))
+	for name := range translators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,344 @@
+// Package output writes query results in the formats the query command offers
+package output
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"server-log-analyzer/internal/database"
+)
+
+// The output formats
+const (
+	FormatTable    = "table"
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatJSON     = "json"
+	FormatNDJSON   = "ndjson"
+	FormatMarkdown = "markdown"
+	FormatHTML     = "html"
+)
+
+// Formats lists every output format, the default first
+var Formats = []string{FormatTable, FormatCSV, FormatTSV, FormatJSON, FormatNDJSON, FormatMarkdown, FormatHTML}
+
+// writers holds the writer of each format
+var writers = map[string]func(io.Writer, *database.QueryResult) error{
+	FormatTable:    writeTable,
+	FormatCSV:      writeCSV,
+	FormatTSV:      writeTSV,
+	FormatJSON:     writeJSON,
+	FormatNDJSON:   writeNDJSON,
+	FormatMarkdown: writeMarkdown,
+	FormatHTML:     writeHTML,
+}
+
+// fileFormats gives the format of output files by extension
+var fileFormats = map[string]string{
+	".txt":      FormatTable,
+	".csv":      FormatCSV,
+	".tsv":      FormatTSV,
+	".tab":      FormatTSV,
+	".json":     FormatJSON,
+	".ndjson":   FormatNDJSON,
+	".jsonl":    FormatNDJSON,
+	".md":       FormatMarkdown,
+	".markdown": FormatMarkdown,
+	".html":     FormatHTML,
+	".htm":      FormatHTML,
+}
+
+// IsFormat reports whether the format is one of Formats
+func IsFormat(format string) bool {
+	_, ok := writers[format]
+	return ok
+}
+
+// FormatForFile returns the format of an output file from its extension, or
+// false if the extension is not one of a format
+func FormatForFile(path string) (string, bool) {
+	format, ok := fileFormats[strings.ToLower(filepath.Ext(path))]
+	return format, ok
+}
+
+// Write writes the result in the format, columns in the order of the SELECT list
+// NULL is null in JSON, an empty field in CSV and TSV, and NULL in the formats
+// meant to be read (table, markdown and html). BLOBs are base64 strings in
+// JSON and hex literals such as x'00ff' elsewhere
+func Write(w io.Writer, format string, result *database.QueryResult) error {
+	write, ok := writers[format]
+	if !ok {
+		return fmt.Errorf("unknown output format '%s': must be one of %s", format, strings.Join(Formats, ", "))
+	}
+	return write(w, result)
+}
+
+// text returns a value as text, or null for NULL
+// Reals are written in full rather than in exponent form, as spreadsheets read
+// them, and BLOBs as hex literals, as their bytes need not be text
+func text(value interface{}, null string) string {
+	switch v := value.(type) {
+	case nil:
+		return null
+	case string:
+		return v
+	case []byte:
+		return "x'" + hex.EncodeToString(v) + "'"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// tableEscaper keeps values on one line of the table
+var tableEscaper = strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// writeTable writes an aligned table for the terminal, as query always has
+func writeTable(w io.Writer, result *database.QueryResult) error {
+	if len(result.Rows) == 0 {
+		_, err := fmt.Fprintln(w, "No results found.")
+		return err
+	}
+
+	widths := make([]int, len(result.Columns))
+	cells := make([][]string, len(result.Rows))
+	for i, column := range result.Columns {
+		widths[i] = utf8.RuneCountInString(column)
+	}
+	for r, row := range result.Rows {
+		cells[r] = make([]string, len(row))
+		for i, value := range row {
+			cells[r][i] = tableEscaper.Replace(text(value, "NULL"))
+			widths[i] = max(widths[i], utf8.RuneCountInString(cells[r][i]))
+		}
+	}
+
+	var b strings.Builder
+	line := func(values []string) {
+		for i, value := range values {
+			if i > 0 {
+				b.WriteString(" | ")
+			}
+			b.WriteString(value)
+			if i < len(values)-1 {
+				b.WriteString(strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value)))
+			}
+		}
+		b.WriteString("\n")
+	}
+
+	line(result.Columns)
+	separators := make([]string, len(widths))
+	for i, width := range widths {
+		separators[i] = strings.Repeat("-", width)
+	}
+	line(separators)
+	for _, row := range cells {
+		line(row)
+	}
+	fmt.Fprintf(&b, "\n(%d rows)\n", len(result.Rows))
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeCSV writes RFC 4180 CSV with a header row
+func writeCSV(w io.Writer, result *database.QueryResult) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(result.Columns); err != nil {
+		return err
+	}
+	record := make([]string, len(result.Columns))
+	for _, row := range result.Rows {
+		for i, value := range row {
+			record[i] = text(value, "")
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// tsvEscaper escapes the characters that cannot appear in a TSV field
+var tsvEscaper = strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+
+// writeTSV writes tab-separated values with a header row; tabs, line breaks
+// and backslashes in values are escaped as \t, \n, \r and \\
+func writeTSV(w io.Writer, result *database.QueryResult) error {
+	var b strings.Builder
+	fields := make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		fields[i] = tsvEscaper.Replace(column)
+	}
+	b.WriteString(strings.Join(fields, "\t") + "\n")
+	for _, row := range result.Rows {
+		for i, value := range row {
+			fields[i] = tsvEscaper.Replace(text(value, ""))
+		}
+		b.WriteString(strings.Join(fields, "\t") + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// jsonKeys returns the keys of the columns in JSON objects. A repeated column
+// name, as in SELECT 1 AS a, 2 AS a, gets a numbered suffix (a_2) that no other
+// column has, so that no value is lost to a duplicate key
+func jsonKeys(columns []string) []string {
+	names := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		names[column] = true
+	}
+
+	keys := make([]string, len(columns))
+	used := make(map[string]bool, len(columns))
+	for i, column := range columns {
+		key := column
+		for n := 2; used[key]; n++ {
+			if candidate := fmt.Sprintf("%s_%d", column, n); !names[candidate] && !used[candidate] {
+				key = candidate
+			}
+		}
+		keys[i] = key
+		used[key] = true
+	}
+	return keys
+}
+
+// jsonObject encodes a row as a JSON object, keys in column order
+// []byte values are encoded as base64 strings by encoding/json
+func jsonObject(columns []string, row []interface{}) (string, error) {
+	var b strings.Builder
+	b.WriteString("{")
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return "", err
+		}
+		value := row[i]
+		// JSON has no infinities; write them as text rather than fail
+		if f, ok := value.(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			value = text(f, "")
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode column '%s' as JSON: %w", column, err)
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(encoded)
+	}
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+// writeJSON writes an array with one object per row
+func writeJSON(w io.Writer, result *database.QueryResult) error {
+	var b strings.Builder
+	b.WriteString("[")
+	keys := jsonKeys(result.Columns)
+	for r, row := range result.Rows {
+		object, err := jsonObject(keys, row)
+		if err != nil {
+			return err
+		}
+		if r > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  " + object)
+	}
+	if len(result.Rows) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("]\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeNDJSON writes one object per line
+func writeNDJSON(w io.Writer, result *database.QueryResult) error {
+	var b strings.Builder
+	keys := jsonKeys(result.Columns)
+	for _, row := range result.Rows {
+		object, err := jsonObject(keys, row)
+		if err != nil {
+			return err
+		}
+		b.WriteString(object + "\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// markdownEscaper keeps values within their table cell
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "|", `\|`, "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+// writeMarkdown writes a GitHub Flavored Markdown table
+func writeMarkdown(w io.Writer, result *database.QueryResult) error {
+	var b strings.Builder
+	line := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" " + cell + " |")
+		}
+		b.WriteString("\n")
+	}
+
+	cells := make([]string, len(result.Columns))
+	for i, column := range result.Columns {
+		cells[i] = markdownEscaper.Replace(column)
+	}
+	line(cells)
+	for i := range cells {
+		cells[i] = "---"
+	}
+	line(cells)
+	for _, row := range result.Rows {
+		for i, value := range row {
+			cells[i] = markdownEscaper.Replace(text(value, "NULL"))
+		}
+		line(cells)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeHTML writes an HTML table, to embed in a page
+func writeHTML(w io.Writer, result *database.QueryResult) error {
+	var b strings.Builder
+	b.WriteString("<table>\n<thead>\n<tr>")
+	for _, column := range result.Columns {
+		b.WriteString("<th>" + html.EscapeString(column) + "</th>")
+	}
+	b.WriteString("</tr>\n</thead>\n<tbody>\n")
+	for _, row := range result.Rows {
+		b.WriteString("<tr>")
+		for _, value := range row {
+			if value == nil {
+				b.WriteString(`<td class="null">NULL</td>`)
+			} else {
+				b.WriteString("<td>" + html.EscapeString(text(value, "")) + "</td>")
+			}
+		}
+		b.WriteString("</tr>\n")
+	}
+	b.WriteString("</tbody>\n</table>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,157 @@
+package output
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+
+	"server-log-analyzer/internal/database"
+)
+
+// testResult has columns out of alphabetical order, a NULL, a real and
+// values with the characters each format must escape
+var testResult = &database.QueryResult{
+	Columns: []string{"username", "count", "note", "ratio"},
+	Rows: [][]interface{}{
+		{"jeff22", int64(3), nil, 0.5},
+		{"a|b", int64(10), "tab\there, \"quoted\"\nline <b>", 1e6},
+	},
+}
+
+// TestWrite tests writing a result in every format
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatTable, "" +
+			"username | count | note                          | ratio\n" +
+			"-------- | ----- | ----------------------------- | -------\n" +
+			"jeff22   | 3     | NULL                          | 0.5\n" +
+			"a|b      | 10    | tab\\there, \"quoted\"\\nline <b> | 1000000\n" +
+			"\n(2 rows)\n"},
+		{FormatCSV, "" +
+			"username,count,note,ratio\n" +
+			"jeff22,3,,0.5\n" +
+			"a|b,10,\"tab\there, \"\"quoted\"\"\nline <b>\",1000000\n"},
+		{FormatTSV, "" +
+			"username\tcount\tnote\tratio\n" +
+			"jeff22\t3\t\t0.5\n" +
+			"a|b\t10\ttab\\there, \"quoted\"\\nline <b>\t1000000\n"},
+		{FormatJSON, "[\n" +
+			"  {\"username\":\"jeff22\",\"count\":3,\"note\":null,\"ratio\":0.5},\n" +
+			"  {\"username\":\"a|b\",\"count\":10,\"note\":\"tab\\there, \\\"quoted\\\"\\nline \\u003cb\\u003e\",\"ratio\":1000000}\n" +
+			"]\n"},
+		{FormatNDJSON, "" +
+			"{\"username\":\"jeff22\",\"count\":3,\"note\":null,\"ratio\":0.5}\n" +
+			"{\"username\":\"a|b\",\"count\":10,\"note\":\"tab\\there, \\\"quoted\\\"\\nline \\u003cb\\u003e\",\"ratio\":1000000}\n"},
+		{FormatMarkdown, "" +
+			"| username | count | note | ratio |\n" +
+			"| --- | --- | --- | --- |\n" +
+			"| jeff22 | 3 | NULL | 0.5 |\n" +
+			"| a\\|b | 10 | tab\there, \"quoted\"<br>line <b> | 1000000 |\n"},
+		{FormatHTML, "<table>\n<thead>\n" +
+			"<tr><th>username</th><th>count</th><th>note</th><th>ratio</th></tr>\n" +
+			"</thead>\n<tbody>\n" +
+			"<tr><td>jeff22</td><td>3</td><td class=\"null\">NULL</td><td>0.5</td></tr>\n" +
+			"<tr><td>a|b</td><td>10</td><td>tab\there, &#34;quoted&#34;\nline &lt;b&gt;</td><td>1000000</td></tr>\n" +
+			"</tbody>\n</table>\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := Write(&out, tt.format, testResult); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("Write() =\n%s\nwant\n%s", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// TestWriteEmpty tests writing a result without rows
+func TestWriteEmpty(t *testing.T) {
+	empty := &database.QueryResult{Columns: []string{"a", "b"}}
+	tests := map[string]string{
+		FormatTable:    "No results found.\n",
+		FormatCSV:      "a,b\n",
+		FormatTSV:      "a\tb\n",
+		FormatJSON:     "[]\n",
+		FormatNDJSON:   "",
+		FormatMarkdown: "| a | b |\n| --- | --- |\n",
+		FormatHTML:     "<table>\n<thead>\n<tr><th>a</th><th>b</th></tr>\n</thead>\n<tbody>\n</tbody>\n</table>\n",
+	}
+
+	for format, want := range tests {
+		var out bytes.Buffer
+		if err := Write(&out, format, empty); err != nil {
+			t.Fatalf("Write(%s) error = %v", format, err)
+		}
+		if out.String() != want {
+			t.Errorf("Write(%s) = %q, want %q", format, out.String(), want)
+		}
+	}
+}
+
+// TestWriteRepeatedColumnsAndBlobs tests that repeated column names get
+// unique JSON keys and that BLOBs are written as base64 or hex rather than raw bytes
+func TestWriteRepeatedColumnsAndBlobs(t *testing.T) {
+	result := &database.QueryResult{
+		Columns: []string{"a", "a", "a_2", "a", "data"},
+		Rows:    [][]interface{}{{int64(1), int64(2), int64(3), int64(4), []byte{0x00, 0xff}}},
+	}
+	tests := map[string]string{
+		FormatJSON:   "[\n  {\"a\":1,\"a_3\":2,\"a_2\":3,\"a_4\":4,\"data\":\"AP8=\"}\n]\n",
+		FormatNDJSON: "{\"a\":1,\"a_3\":2,\"a_2\":3,\"a_4\":4,\"data\":\"AP8=\"}\n",
+		FormatCSV:    "a,a,a_2,a,data\n1,2,3,4,x'00ff'\n",
+	}
+
+	for format, want := range tests {
+		var out bytes.Buffer
+		if err := Write(&out, format, result); err != nil {
+			t.Fatalf("Write(%s) error = %v", format, err)
+		}
+		if out.String() != want {
+			t.Errorf("Write(%s) = %q, want %q", format, out.String(), want)
+		}
+	}
+}
+
+// TestWriteErrors tests unknown formats and values JSON cannot hold
+func TestWriteErrors(t *testing.T) {
+	var out bytes.Buffer
+	if err := Write(&out, "xml", testResult); err == nil || !strings.Contains(err.Error(), "unknown output format 'xml'") {
+		t.Errorf("Expected an unknown format error, got %v", err)
+	}
+
+	infinite := &database.QueryResult{Columns: []string{"x"}, Rows: [][]interface{}{{math.Inf(1)}}}
+	out.Reset()
+	if err := Write(&out, FormatJSON, infinite); err != nil || out.String() != "[\n  {\"x\":\"+Inf\"}\n]\n" {
+		t.Errorf("Expected infinity as text, got %q, %v", out.String(), err)
+	}
+}
+
+// TestFormatForFile tests choosing the format from the output file extension
+func TestFormatForFile(t *testing.T) {
+	tests := map[string]string{
+		"results.csv":     FormatCSV,
+		"out/RESULTS.TSV": FormatTSV,
+		"report.json":     FormatJSON,
+		"events.jsonl":    FormatNDJSON,
+		"README.md":       FormatMarkdown,
+		"dashboard.htm":   FormatHTML,
+		"results.txt":     FormatTable,
+		"results.parquet": "",
+		"results":         "",
+	}
+
+	for path, want := range tests {
+		got, ok := FormatForFile(path)
+		if got != want || ok != (want != "") {
+			t.Errorf("FormatForFile(%q) = %q, %t, want %q", path, got, ok, want)
+		}
+	}
+}
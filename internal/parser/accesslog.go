@@ -0,0 +1,235 @@
+// Package parser provides CSV parsing functionality for server log files
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Access log formats understood by AccessLogReader
+const (
+	FormatCommon   InputFormat = "common"   // Apache/Nginx Common Log Format
+	FormatCombined InputFormat = "combined" // Common Log Format plus referrer and user agent
+)
+
+// accessLogTimeFormat is the layout of the [10/Oct/2000:13:55:36 -0700] timestamp
+const accessLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// accessLogPattern matches a Common Log Format line with an optional
+// "referrer" "user agent" tail (Combined Log Format)
+// Quoted fields may contain \" escapes as written by Apache
+var accessLogPattern = regexp.MustCompile(
+	`^(\S+) \S+ (\S+) \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) (\d+|-)` +
+		`(?: "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)")?`)
+
+// accessLogColumns describes the columns produced for each access log format
+var accessLogColumns = map[InputFormat][]ColumnSchema{
+	FormatCommon: {
+		{Name: "ip", Type: TypeText},
+		{Name: "user", Type: TypeText, Nullable: true},
+		{Name: "timestamp", Type: TypeTimestamp},
+		{Name: "method", Type: TypeText, Nullable: true},
+		{Name: "path", Type: TypeText, Nullable: true},
+		{Name: "status", Type: TypeInteger},
+		{Name: "bytes", Type: TypeInteger, Nullable: true},
+	},
+	FormatCombined: {
+		{Name: "ip", Type: TypeText},
+		{Name: "user", Type: TypeText, Nullable: true},
+		{Name: "timestamp", Type: TypeTimestamp},
+		{Name: "method", Type: TypeText, Nullable: true},
+		{Name: "path", Type: TypeText, Nullable: true},
+		{Name: "status", Type: TypeInteger},
+		{Name: "bytes", Type: TypeInteger, Nullable: true},
+		{Name: "referrer", Type: TypeText, Nullable: true},
+		{Name: "user_agent", Type: TypeText, Nullable: true},
+	},
+}
+
+// AccessLogSchema returns the table schema for an access log format
+// Columns are indexed using the same rules as detected schemas (shouldIndex)
+func AccessLogSchema(format InputFormat, tableName string) (*TableSchema, error) {
+	columns, ok := accessLogColumns[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown access log format '%s'", format)
+	}
+
+	schema := &TableSchema{
+		Name:    tableName,
+		Columns: make([]ColumnSchema, len(columns)),
+	}
+	for i, col := range columns {
+		col.Index = shouldIndex(col.Name)
+		schema.Columns[i] = col
+	}
+
+	return schema, nil
+}
+
+// AccessLogReader streams records from an Apache/Nginx access log
+// Timestamps are converted to RFC 3339 and "-" placeholders become empty values
+type AccessLogReader struct {
+	input   io.ReadCloser
+	reader  *bufio.Reader
+	format  InputFormat
+	headers []string
+	line    int
+}
+
+// OpenAccessLog opens an access log file in the common or combined format for streaming
+// Compressed files (gzip, bzip2, zstd) are decompressed on the fly
+func OpenAccessLog(filePath string, format InputFormat) (*AccessLogReader, error) {
+	file, err := OpenInput(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open access log: %w", err)
+	}
+
+	r, err := newAccessLogReader(file, format)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// newAccessLogReader creates a reader for the given access log format
+func newAccessLogReader(input io.ReadCloser, format InputFormat) (*AccessLogReader, error) {
+	schema, err := AccessLogSchema(format, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return &AccessLogReader{
+		input:   input,
+		reader:  bufio.NewReader(input),
+		format:  format,
+		headers: schema.ColumnNames(),
+	}, nil
+}
+
+// Headers returns the column names of the access log format
+func (r *AccessLogReader) Headers() []string {
+	return r.headers
+}
+
+// Schema returns the fixed table schema of the access log format
+func (r *AccessLogReader) Schema(tableName string) (*TableSchema, error) {
+	return AccessLogSchema(r.format, tableName)
+}
+
+// Read returns the next log line as a record, or io.EOF when the input is exhausted
+// Lines that do not match the format are returned as a *ParseError
+func (r *AccessLogReader) Read() ([]string, error) {
+	for {
+		data, err := r.reader.ReadString('\n')
+		if len(data) == 0 && err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading access log at line %d: %w", r.line+1, err)
+		}
+		r.line++
+
+		data = strings.TrimRight(data, "\r\n")
+		if strings.TrimSpace(data) == "" {
+			continue
+		}
+
+		record, parseErr := parseAccessLogLine(data, r.format)
+		if parseErr != nil {
+			return nil, &ParseError{Line: r.line, Err: parseErr}
+		}
+		return record, nil
+	}
+}
+
+// Line returns the line number of the most recently read record
+func (r *AccessLogReader) Line() int {
+	return r.line
+}
+
+// Close releases the underlying file
+func (r *AccessLogReader) Close() error {
+	return r.input.Close()
+}
+
+// parseAccessLogLine splits one access log line into the columns of the format
+func parseAccessLogLine(line string, format InputFormat) ([]string, error) {
+	m := accessLogPattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("line does not match the %s log format", format)
+	}
+
+	timestamp, err := time.Parse(accessLogTimeFormat, m[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp '%s': %w", m[3], err)
+	}
+
+	// The request line is normally "METHOD /path PROTOCOL", but malformed
+	// requests (or "-") are logged as they were received
+	var method, path string
+	request := strings.Fields(unescapeAccessLogField(m[4]))
+	if len(request) >= 2 {
+		method, path = request[0], request[1]
+	} else if len(request) == 1 && request[0] != "-" {
+		path = request[0]
+	}
+
+	record := []string{
+		m[1],
+		dashToEmpty(m[2]),
+		timestamp.Format(time.RFC3339),
+		method,
+		path,
+		m[5],
+		dashToEmpty(m[6]),
+	}
+
+	if format == FormatCombined {
+		record = append(record,
+			dashToEmpty(unescapeAccessLogField(m[7])),
+			dashToEmpty(unescapeAccessLogField(m[8])))
+	}
+
+	return record, nil
+}
+
+// unescapeAccessLogField undoes the \" and \\ escaping of quoted fields
+// Nginx writes quotes as \x22, which is decoded as well
+func unescapeAccessLogField(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`, `\x22`, `"`).Replace(s)
+}
+
+// dashToEmpty converts the "-" placeholder for a missing value into an empty string
+func dashToEmpty(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// looksLikeAccessLog reports whether a line is in the common or combined log
+// format and which one
+func looksLikeAccessLog(line string) (InputFormat, bool) {
+	m := accessLogPattern.FindStringSubmatchIndex(line)
+	if m == nil {
+		return "", false
+	}
+	if _, err := time.Parse(accessLogTimeFormat, line[m[6]:m[7]]); err != nil {
+		return "", false
+	}
+
+	// Group 7 (the referrer) only takes part in the match for combined lines
+	if m[14] >= 0 {
+		return FormatCombined, true
+	}
+	return FormatCommon, true
+}
@@ -0,0 +1,139 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// TestParseAccessLogLine tests splitting access log lines into columns
+func TestParseAccessLogLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		format  InputFormat
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "combined",
+			line:   `203.0.113.7 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			format: FormatCombined,
+			want:   []string{"203.0.113.7", "frank", "2000-10-10T13:55:36-07:00", "GET", "/apache_pb.gif", "200", "2326", "http://www.example.com/start.html", "Mozilla/4.08 [en] (Win98; I ;Nav)"},
+		},
+		{
+			name:   "common with missing user and bytes",
+			line:   `::1 - - [12/Apr/2020:22:10:38 +0000] "HEAD / HTTP/1.1" 304 -`,
+			format: FormatCommon,
+			want:   []string{"::1", "", "2020-04-12T22:10:38Z", "HEAD", "/", "304", ""},
+		},
+		{
+			name:   "escaped quotes and empty referrer",
+			line:   `10.0.0.1 - - [12/Apr/2020:22:10:38 +0000] "GET /search?q=\"x\" HTTP/1.1" 200 12 "-" "curl/7.68.0 \"test\""`,
+			format: FormatCombined,
+			want:   []string{"10.0.0.1", "", "2020-04-12T22:10:38Z", "GET", `/search?q="x"`, "200", "12", "", `curl/7.68.0 "test"`},
+		},
+		{
+			name:   "malformed request line",
+			line:   `10.0.0.1 - - [12/Apr/2020:22:10:38 +0000] "-" 400 0 "-" "-"`,
+			format: FormatCombined,
+			want:   []string{"10.0.0.1", "", "2020-04-12T22:10:38Z", "", "", "400", "0", "", ""},
+		},
+		{
+			name:   "combined line read as common",
+			line:   `10.0.0.1 - - [12/Apr/2020:22:10:38 +0000] "GET / HTTP/1.1" 200 5 "-" "curl"`,
+			format: FormatCommon,
+			want:   []string{"10.0.0.1", "", "2020-04-12T22:10:38Z", "GET", "/", "200", "5"},
+		},
+		{
+			name:    "not an access log",
+			line:    "1587772800,jeff22,upload,45",
+			format:  FormatCombined,
+			wantErr: true,
+		},
+		{
+			name:    "invalid timestamp",
+			line:    `10.0.0.1 - - [yesterday] "GET / HTTP/1.1" 200 5`,
+			format:  FormatCommon,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAccessLogLine(tt.line, tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseAccessLogLine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && fmt.Sprintf("%q", got) != fmt.Sprintf("%q", tt.want) {
+				t.Errorf("parseAccessLogLine() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAccessLogSchema tests the fixed schema of the access log formats
+func TestAccessLogSchema(t *testing.T) {
+	schema, err := AccessLogSchema(FormatCombined, "access")
+	if err != nil {
+		t.Fatalf("AccessLogSchema() unexpected error: %v", err)
+	}
+
+	if got := strings.Join(schema.ColumnNames(), ","); got != "ip,user,timestamp,method,path,status,bytes,referrer,user_agent" {
+		t.Errorf("AccessLogSchema() columns = %s", got)
+	}
+
+	wantIndex := map[string]bool{"ip": true, "user": true, "timestamp": true, "method": true, "status": true}
+	for _, col := range schema.Columns {
+		if col.Index != wantIndex[col.Name] {
+			t.Errorf("Column %s index = %t, want %t", col.Name, col.Index, wantIndex[col.Name])
+		}
+	}
+	if schema.Column("status").Type != TypeInteger || schema.Column("timestamp").Type != TypeTimestamp {
+		t.Error("Expected INTEGER status and TIMESTAMP timestamp columns")
+	}
+
+	if _, err := AccessLogSchema(FormatCSV, "access"); err == nil {
+		t.Error("AccessLogSchema() expected error for CSV format")
+	}
+}
+
+// TestAccessLogReader tests streaming an access log and sniffing its format
+func TestAccessLogReader(t *testing.T) {
+	content := `203.0.113.7 - - [10/Oct/2000:13:55:36 -0700] "GET / HTTP/1.0" 200 2326 "-" "curl"
+
+garbage
+203.0.113.8 - - [10/Oct/2000:13:55:37 -0700] "POST /login HTTP/1.0" 302 - "-" "curl"
+`
+	reader, err := NewRecordReader(strings.NewReader(content), ReadOptions{Format: FormatAuto})
+	if err != nil {
+		t.Fatalf("NewRecordReader() unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	if _, ok := reader.(*AccessLogReader); !ok {
+		t.Fatalf("Expected combined log format to be detected, got %T", reader)
+	}
+	if len(reader.Headers()) != 9 {
+		t.Errorf("Expected 9 combined columns, got %v", reader.Headers())
+	}
+
+	if record, err := reader.Read(); err != nil || record[0] != "203.0.113.7" || reader.Line() != 1 {
+		t.Errorf("Read() = %v, %v at line %d", record, err, reader.Line())
+	}
+
+	var parseErr *ParseError
+	if _, err := reader.Read(); !errors.As(err, &parseErr) || parseErr.Line != 3 {
+		t.Errorf("Read() error = %v, want ParseError at line 3", err)
+	}
+
+	if record, err := reader.Read(); err != nil || record[3] != "POST" || record[6] != "" || reader.Line() != 4 {
+		t.Errorf("Read() = %v, %v at line %d", record, err, reader.Line())
+	}
+
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+}
@@ -0,0 +1,169 @@
+// Package parser provides CSV parsing functionality for server log files
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression identifies how an input file is compressed
+type Compression int
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionBzip2
+	CompressionZstd
+)
+
+// String returns the string representation of Compression
+func (c Compression) String() string {
+	switch c {
+	case CompressionGzip:
+		return "gzip"
+	case CompressionBzip2:
+		return "bzip2"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// Magic bytes at the start of each compressed format
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// CompressedExtensions lists the file extensions of the supported compression formats
+var CompressedExtensions = map[string]Compression{
+	".gz":   CompressionGzip,
+	".gzip": CompressionGzip,
+	".bz2":  CompressionBzip2,
+	".zst":  CompressionZstd,
+	".zstd": CompressionZstd,
+}
+
+// CompressionFromExtension returns the compression implied by a file name
+func CompressionFromExtension(path string) Compression {
+	return CompressedExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// TrimCompressionExtension removes a compression extension from a file name,
+// so "server_log.csv.gz" becomes "server_log.csv"
+func TrimCompressionExtension(path string) string {
+	if CompressionFromExtension(path) == CompressionNone {
+		return path
+	}
+	return strings.TrimSuffix(path, filepath.Ext(path))
+}
+
+// detectCompression inspects the first bytes of the input
+// The magic bytes win over the extension; the extension is only used when the
+// content is not recognised, so a truncated .gz file still reports a gzip error
+func detectCompression(r *bufio.Reader, path string) Compression {
+	header, _ := r.Peek(len(zstdMagic))
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return CompressionGzip
+	case bytes.HasPrefix(header, bzip2Magic):
+		return CompressionBzip2
+	case bytes.HasPrefix(header, zstdMagic):
+		return CompressionZstd
+	}
+
+	return CompressionFromExtension(path)
+}
+
+// decompressedFile reads the decompressed content of a file and closes both
+// the decompressor and the file when done
+type decompressedFile struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close releases the decompressor and the underlying file
+func (d *decompressedFile) Close() error {
+	var firstErr error
+	for _, c := range d.closers {
+		if err := c.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// OpenInput opens a file for reading, transparently decompressing gzip,
+// bzip2 and zstd content
+func OpenInput(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := decompress(file, path)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Closing the input also closes the file
+	input.closers = append(input.closers, file)
+	return input, nil
+}
+
+// Decompress wraps r so that gzip, bzip2 and zstd content is decompressed on the fly
+// The format is detected from the first bytes, falling back to the extension of name
+// Closing the result releases the decompressor but leaves r open
+func Decompress(r io.Reader, name string) (io.ReadCloser, error) {
+	return decompress(r, name)
+}
+
+// decompress implements Decompress, returning the concrete type so OpenInput can add the file to close
+func decompress(r io.Reader, name string) (*decompressedFile, error) {
+	buffered := bufio.NewReader(r)
+
+	switch detectCompression(buffered, name) {
+	case CompressionGzip:
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip data: %w", err)
+		}
+		return &decompressedFile{Reader: gz, closers: []io.Closer{gz}}, nil
+
+	case CompressionBzip2:
+		return &decompressedFile{Reader: bzip2.NewReader(buffered)}, nil
+
+	case CompressionZstd:
+		zr, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read zstd data: %w", err)
+		}
+		return &decompressedFile{Reader: zr, closers: []io.Closer{zstdCloser{zr}}}, nil
+	}
+
+	return &decompressedFile{Reader: buffered}, nil
+}
+
+// zstdCloser adapts zstd.Decoder, whose Close returns nothing, to io.Closer
+type zstdCloser struct {
+	decoder *zstd.Decoder
+}
+
+// Close releases the decoder's resources
+func (z zstdCloser) Close() error {
+	z.decoder.Close()
+	return nil
+}
@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressGzip returns data compressed with gzip
+func compressGzip(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// compressZstd returns data compressed with zstd
+func compressZstd(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// bzip2Data is the TestOpenInput content compressed with bzip2
+// (the standard library can only decompress bzip2)
+var bzip2Data = []byte{
+	0x42, 0x5a, 0x68, 0x39, 0x31, 0x41, 0x59, 0x26, 0x53, 0x59, 0x65, 0x3b,
+	0xe6, 0x77, 0x00, 0x00, 0x1c, 0xd9, 0x80, 0x00, 0x10, 0x00, 0x04, 0x76,
+	0xc0, 0x27, 0x37, 0xde, 0x10, 0x20, 0x00, 0x48, 0xa8, 0x79, 0x34, 0x27,
+	0x9a, 0xa1, 0xe8, 0x9b, 0x48, 0x22, 0x0d, 0x1a, 0x34, 0x0d, 0x00, 0x16,
+	0x8b, 0x32, 0x7a, 0xe0, 0xda, 0xa7, 0xd0, 0x50, 0x0a, 0x54, 0x41, 0x86,
+	0x8c, 0xbf, 0xd1, 0x9b, 0xe8, 0x9f, 0xdb, 0x48, 0xee, 0x96, 0x8d, 0xc3,
+	0x68, 0xd1, 0x67, 0xe9, 0x02, 0xc5, 0x87, 0xc3, 0x10, 0x87, 0xc5, 0xdc,
+	0x91, 0x4e, 0x14, 0x24, 0x19, 0x4e, 0xf9, 0x9d, 0xc0,
+}
+
+// TestOpenInput tests transparent decompression of input files
+func TestOpenInput(t *testing.T) {
+	const content = "timestamp,username,operation,size\n1587772800,jeff22,upload,45\n"
+
+	tests := []struct {
+		name     string
+		fileName string
+		data     []byte
+		wantErr  string
+	}{
+		{
+			name:     "plain file",
+			fileName: "log.csv",
+			data:     []byte(content),
+		},
+		{
+			name:     "gzip by extension and magic",
+			fileName: "log.csv.gz",
+			data:     compressGzip(t, content),
+		},
+		{
+			name:     "gzip detected from content without extension",
+			fileName: "log.csv",
+			data:     compressGzip(t, content),
+		},
+		{
+			name:     "bzip2",
+			fileName: "log.csv.bz2",
+			data:     bzip2Data,
+		},
+		{
+			name:     "zstd",
+			fileName: "log.csv.zst",
+			data:     compressZstd(t, content),
+		},
+		{
+			name:     "corrupt gzip",
+			fileName: "log.csv.gz",
+			data:     []byte("not really gzip"),
+			wantErr:  "gzip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(path, tt.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := OpenInput(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("OpenInput() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenInput() unexpected error: %v", err)
+			}
+			defer reader.Close()
+
+			got, err := io.ReadAll(reader)
+			if err != nil {
+				t.Fatalf("Failed to read: %v", err)
+			}
+			if string(got) != content {
+				t.Errorf("OpenInput() content = %q, want %q", got, content)
+			}
+		})
+	}
+}
+
+// TestTrimCompressionExtension tests stripping compression extensions from file names
+func TestTrimCompressionExtension(t *testing.T) {
+	tests := map[string]string{
+		"server_log.csv.gz":  "server_log.csv",
+		"server_log.csv.BZ2": "server_log.csv",
+		"server_log.csv.zst": "server_log.csv",
+		"server_log.csv":     "server_log.csv",
+		"archive.tar":        "archive.tar",
+	}
+
+	for input, want := range tests {
+		if got := TrimCompressionExtension(input); got != want {
+			t.Errorf("TrimCompressionExtension(%q) = %q, want %q", input, got, want)
+		}
+	}
+}
@@ -2,71 +2,297 @@
 package parser
 
 import (
+	"bytes"
 	"encoding/csv"
 	"fmt"
 	"io"
-	"os"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"server-log-analyzer/internal/models"
 )
 
-// ParseCSVRaw reads and parses a CSV file returning headers and raw string records
-// This function is used for dynamic schema detection
-func ParseCSVRaw(filePath string) ([]string, [][]string, error) {
-	// Open the CSV file
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to open CSV file: %w", err)
+// CSVReader streams records from a CSV file one at a time
+// This keeps memory usage bounded regardless of the file size
+type CSVReader struct {
+	file    io.ReadCloser
+	reader  *csv.Reader
+	headers []string
+	pending []string // First data row when the file has no header row
+	line    int      // Line number of the most recently returned record
+}
+
+// HeaderMode controls whether the first row of a CSV file is a header row
+type HeaderMode string
+
+const (
+	HeaderAuto HeaderMode = "auto" // Guess from the content of the first row
+	HeaderYes  HeaderMode = "yes"  // The first row is always a header row
+	HeaderNo   HeaderMode = "no"   // There is no header row
+)
+
+// ParseHeaderMode converts a --header value into a HeaderMode
+func ParseHeaderMode(value string) (HeaderMode, error) {
+	switch mode := HeaderMode(strings.ToLower(value)); mode {
+	case HeaderAuto, HeaderYes, HeaderNo:
+		return mode, nil
 	}
-	defer file.Close()
+	return "", fmt.Errorf("invalid header mode '%s': must be 'yes', 'no' or 'auto'", value)
+}
 
-	// Create CSV reader
-	reader := csv.NewReader(file)
-	reader.FieldsPerRecord = -1 // Allow variable number of fields for flexibility
+// CSVOptions describes the CSV dialect of an input file
+// The zero value reads standard comma-separated files and guesses the header row
+type CSVOptions struct {
+	Delimiter        rune       // Field delimiter (default ',')
+	Comment          rune       // Lines starting with this character are ignored (0 = none)
+	LazyQuotes       bool       // Allow quotes in unquoted fields and unescaped quotes in quoted fields
+	TrimLeadingSpace bool       // Ignore leading white space in fields
+	Header           HeaderMode // Whether the first row is a header row (default auto)
+	Columns          []string   // Column names to use instead of (or in the absence of) a header row
+}
 
-	var headers []string
-	var records [][]string
-	lineNumber := 0
+// newReader creates a csv.Reader configured for the dialect
+func (o CSVOptions) newReader(input io.Reader) *csv.Reader {
+	reader := csv.NewReader(input)
+	reader.FieldsPerRecord = -1 // Allow variable number of fields for flexibility
+	if o.Delimiter != 0 {
+		reader.Comma = o.Delimiter
+	}
+	reader.Comment = o.Comment
+	reader.LazyQuotes = o.LazyQuotes
+	reader.TrimLeadingSpace = o.TrimLeadingSpace
+	return reader
+}
 
+// CompleteRecords returns the length of the complete records at the start of
+// data, such as the content of a file that is still being written
+// A quoted field can hold line breaks, so records end where encoding/csv ends
+// them rather than at the last line break
+func (o CSVOptions) CompleteRecords(data []byte) int {
+	// NUL cannot be the delimiter or comment character, so appending it ends no
+	// record: a record is complete only if the reader ends it before the NUL
+	reader := o.newReader(io.MultiReader(bytes.NewReader(data), strings.NewReader("\x00")))
+	end := 0
 	for {
-		// Read the next record
-		record, err := reader.Read()
+		_, err := reader.Read()
+		offset := reader.InputOffset()
+		if err == io.EOF || offset > int64(len(data)) {
+			return end
+		}
+		end = int(offset)
+	}
+}
+
+// Validate checks that the dialect can be used to read CSV data
+func (o CSVOptions) Validate() error {
+	delimiter := o.Delimiter
+	if delimiter == 0 {
+		delimiter = ','
+	}
+	if !validDialectRune(delimiter) {
+		return fmt.Errorf("invalid delimiter %q", delimiter)
+	}
+	if o.Comment != 0 && !validDialectRune(o.Comment) {
+		return fmt.Errorf("invalid comment character %q", o.Comment)
+	}
+	if o.Comment == delimiter {
+		return fmt.Errorf("comment character and delimiter must differ")
+	}
+	if _, err := ParseHeaderMode(string(o.headerMode())); err != nil {
+		return err
+	}
+	return nil
+}
+
+// headerMode returns the header mode, defaulting to auto
+// Explicit column names without --header=yes mean there is no header row
+func (o CSVOptions) headerMode() HeaderMode {
+	if o.Header == "" {
+		if len(o.Columns) > 0 {
+			return HeaderNo
+		}
+		return HeaderAuto
+	}
+	return o.Header
+}
+
+// validDialectRune reports whether r can be used as a delimiter or comment character
+func validDialectRune(r rune) bool {
+	return r != '"' && r != '\r' && r != '\n' && r != utf8.RuneError && utf8.ValidRune(r)
+}
+
+// OpenCSV opens a CSV file for streaming and consumes its header row
+// Compressed files (gzip, bzip2, zstd) are decompressed on the fly
+// If the first row does not look like a header, column_N names are generated
+// and that row is returned by the first call to Read
+func OpenCSV(filePath string) (*CSVReader, error) {
+	return OpenCSVWithOptions(filePath, CSVOptions{})
+}
+
+// OpenCSVWithOptions opens a CSV file for streaming using the given dialect
+func OpenCSVWithOptions(filePath string, opts CSVOptions) (*CSVReader, error) {
+	file, err := OpenInput(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+
+	r, err := newCSVReader(file, opts)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// NewCSVReader streams CSV records from r, such as standard input, in the same way as OpenCSVWithOptions
+// Compressed input is detected from its first bytes; closing the reader leaves r open
+func NewCSVReader(r io.Reader, opts CSVOptions) (*CSVReader, error) {
+	input, err := Decompress(r, "")
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := newCSVReader(input, opts)
+	if err != nil {
+		input.Close()
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// newCSVReader reads the header row from input
+func newCSVReader(input io.ReadCloser, opts CSVOptions) (*CSVReader, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	reader := opts.newReader(input)
+	r := &CSVReader{file: input, reader: reader}
+
+	// First line determines headers
+	first, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("no headers found in CSV file")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV at line 1: %w", err)
+	}
+	r.line, _ = reader.FieldPos(0)
+
+	mode := opts.headerMode()
+	hasHeader := mode == HeaderYes || (mode == HeaderAuto && isHeaderRow(first))
+
+	switch {
+	case len(opts.Columns) > 0:
+		// Explicit column names must match the width of the file
+		if len(opts.Columns) != len(first) {
+			return nil, fmt.Errorf("expected %d columns (%s), got %d", len(opts.Columns), strings.Join(opts.Columns, ","), len(first))
+		}
+		r.headers = opts.Columns
+	case hasHeader:
+		r.headers = first
+	default:
+		// Generate headers if no header row detected
+		r.headers = make([]string, len(first))
+		for i := range r.headers {
+			r.headers[i] = fmt.Sprintf("column_%d", i+1)
+		}
+	}
+
+	if !hasHeader {
+		// Keep this record so it is returned as data
+		r.pending = first
+	}
+
+	return r, nil
+}
+
+// Headers returns the column names read from (or generated for) the CSV file
+func (r *CSVReader) Headers() []string {
+	return r.headers
+}
+
+// Read returns the next data record, or io.EOF when the file is exhausted
+func (r *CSVReader) Read() ([]string, error) {
+	if r.pending != nil {
+		record := r.pending
+		r.pending = nil
+		return record, nil
+	}
+
+	record, err := r.reader.Read()
+	if err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV at line %d: %w", r.line+1, err)
+	}
+
+	// FieldPos reports the physical line, which differs from the record
+	// count when quoted fields span several lines
+	r.line, _ = r.reader.FieldPos(0)
+
+	return record, nil
+}
+
+// ReadBatch reads up to size records
+// It returns a short batch at the end of the file and io.EOF once no records remain
+func (r *CSVReader) ReadBatch(size int) ([][]string, error) {
+	batch := make([][]string, 0, size)
+	for len(batch) < size {
+		record, err := r.Read()
 		if err == io.EOF {
 			break
 		}
 		if err != nil {
-			return nil, nil, fmt.Errorf("error reading CSV at line %d: %w", lineNumber+1, err)
+			return nil, err
 		}
+		batch = append(batch, record)
+	}
 
-		lineNumber++
+	if len(batch) == 0 {
+		return nil, io.EOF
+	}
 
-		// First line determines headers
-		if lineNumber == 1 {
-			if isHeaderRow(record) {
-				headers = record
-				continue
-			} else {
-				// Generate headers if no header row detected
-				headers = make([]string, len(record))
-				for i := range headers {
-					headers[i] = fmt.Sprintf("column_%d", i+1)
-				}
-				// Include this record as data
-				records = append(records, record)
-			}
-		} else {
-			records = append(records, record)
-		}
+	return batch, nil
+}
+
+// Line returns the line number of the most recently read record
+func (r *CSVReader) Line() int {
+	return r.line
+}
+
+// Close releases the underlying file (or decompressor)
+func (r *CSVReader) Close() error {
+	return r.file.Close()
+}
+
+// ParseCSVRaw reads and parses a CSV file returning headers and raw string records
+// This loads the whole file into memory; use OpenCSV to stream large files
+func ParseCSVRaw(filePath string) ([]string, [][]string, error) {
+	reader, err := OpenCSV(filePath)
+	if err != nil {
+		return nil, nil, err
 	}
+	defer reader.Close()
 
-	if len(headers) == 0 {
-		return nil, nil, fmt.Errorf("no headers found in CSV file")
+	var records [][]string
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		records = append(records, record)
 	}
 
-	return headers, records, nil
+	return reader.Headers(), records, nil
 }
 
 // ParseCSV reads and parses a CSV file containing server log entries
@@ -76,8 +302,8 @@ func ParseCSVRaw(filePath string) ([]string, [][]string, error) {
 // - operation: "upload" or "download"
 // - size: integer (file size in kB)
 func ParseCSV(filePath string) ([]models.LogEntry, error) {
-	// Open the CSV file
-	file, err := os.Open(filePath)
+	// Open the CSV file, decompressing it if needed
+	file, err := OpenInput(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open CSV file: %w", err)
 	}
@@ -108,7 +334,7 @@ func ParseCSV(filePath string) ([]models.LogEntry, error) {
 		}
 
 		// Parse the record into a LogEntry
-		entry, err := parseLogEntry(record, lineNumber)
+		entry, err := ParseLogEntry(record, time.UTC)
 		if err != nil {
 			return nil, fmt.Errorf("error parsing line %d: %w", lineNumber, err)
 		}
@@ -123,16 +349,17 @@ func ParseCSV(filePath string) ([]models.LogEntry, error) {
 	return entries, nil
 }
 
-// parseLogEntry converts a CSV record into a LogEntry struct
-// Performs validation and type conversion for each field
-func parseLogEntry(record []string, lineNumber int) (models.LogEntry, error) {
+// ParseLogEntry converts a CSV record into a LogEntry struct
+// Performs validation and type conversion for each field; timestamps without
+// a time zone are read in loc (UTC when nil)
+func ParseLogEntry(record []string, loc *time.Location) (models.LogEntry, error) {
 	if len(record) != 4 {
 		return models.LogEntry{}, fmt.Errorf("expected 4 fields, got %d", len(record))
 	}
 
-	// Parse timestamp (UNIX timestamp)
+	// Parse timestamp (UNIX timestamp or any format ParseTimestamp reads)
 	timestampStr := record[0]
-	timestamp, err := parseTimestamp(timestampStr)
+	timestamp, err := ParseTimestamp(timestampStr, loc)
 	if err != nil {
 		return models.LogEntry{}, fmt.Errorf("invalid timestamp '%s': %w", timestampStr, err)
 	}
@@ -164,38 +391,6 @@ func parseLogEntry(record []string, lineNumber int) (models.LogEntry, error) {
 	}, nil
 }
 
-// parseTimestamp converts a timestamp string to time.Time
-// Supports both UNIX timestamps and human-readable formats
-func parseTimestamp(timestampStr string) (time.Time, error) {
-	// First try to parse as UNIX timestamp
-	if timestamp, err := strconv.ParseInt(timestampStr, 10, 64); err == nil {
-		// Handle both second and millisecond precision
-		// If timestamp > year 2100 in seconds, assume it's milliseconds
-		if timestamp > 4102444800 { // January 1, 2100 in seconds
-			return time.Unix(timestamp/1000, (timestamp%1000)*1000000), nil
-		}
-		return time.Unix(timestamp, 0), nil
-	}
-
-	// Try to parse as human-readable timestamp
-	// Format: "Sun Apr 12 22:10:38 UTC 2020"
-	if t, err := time.Parse("Mon Jan 2 15:04:05 MST 2006", timestampStr); err == nil {
-		return t, nil
-	}
-
-	// Try alternative format without timezone
-	if t, err := time.Parse("Mon Jan 2 15:04:05 2006", timestampStr); err == nil {
-		return t, nil
-	}
-
-	// Try RFC3339 format
-	if t, err := time.Parse(time.RFC3339, timestampStr); err == nil {
-		return t, nil
-	}
-
-	return time.Time{}, fmt.Errorf("timestamp format not recognized, expected UNIX timestamp or 'Mon Jan 2 15:04:05 MST 2006' format")
-}
-
 // isValidOperation checks if the operation is either "upload" or "download"
 // This validation ensures data consistency and could be extended for new operations
 func isValidOperation(operation string) bool {
@@ -366,7 +561,4 @@ func isPurelyNumeric(s string) bool {
 
 // Future extensions could include:
 // - Support for different CSV formats (custom delimiters, headers)
-// - Streaming parser for very large files
 // - Data validation rules (e.g., reasonable timestamp ranges)
-// - Support for compressed CSV files
-// - Parallel processing for multiple CSV files
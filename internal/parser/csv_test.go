@@ -1,8 +1,11 @@
 package parser
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -69,40 +72,256 @@ Sun Apr 12 22:15:00 UTC 2020,alice42,download,120`,
 	}
 }
 
-// TestParseTimestamp tests timestamp parsing functionality
-func TestParseTimestamp(t *testing.T) {
+// TestOpenCSV tests streaming records from a CSV file
+func TestOpenCSV(t *testing.T) {
 	tests := []struct {
-		name      string
-		timestamp string
-		wantErr   bool
+		name        string
+		csvContent  string
+		wantHeaders []string
+		wantRecords int
+		wantErr     bool
 	}{
 		{
-			name:      "valid UNIX timestamp (seconds)",
-			timestamp: "1587504638",
-			wantErr:   false,
+			name: "file with header row",
+			csvContent: `timestamp,username,operation,size
+1587772800,jeff22,upload,45
+1587772900,alice42,download,120`,
+			wantHeaders: []string{"timestamp", "username", "operation", "size"},
+			wantRecords: 2,
 		},
 		{
-			name:      "valid human-readable timestamp",
-			timestamp: "Sun Apr 12 22:10:38 UTC 2020",
-			wantErr:   false,
+			name: "file without header row",
+			csvContent: `1587772800,jeff22,upload,45
+1587772900,alice42,download,120`,
+			wantHeaders: []string{"column_1", "column_2", "column_3", "column_4"},
+			wantRecords: 2,
 		},
 		{
-			name:      "invalid timestamp format",
-			timestamp: "2020-04-12 22:10:38",
-			wantErr:   true,
+			name:       "empty file",
+			csvContent: ``,
+			wantErr:    true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := parseTimestamp(tt.timestamp)
+			tmpFile := createTempCSVFile(t, tt.csvContent)
+			defer os.Remove(tmpFile)
+
+			reader, err := OpenCSV(tmpFile)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("parseTimestamp() error = %v, wantErr %v", err, tt.wantErr)
+				t.Fatalf("OpenCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			defer reader.Close()
+
+			if fmt.Sprint(reader.Headers()) != fmt.Sprint(tt.wantHeaders) {
+				t.Errorf("Headers() = %v, want %v", reader.Headers(), tt.wantHeaders)
+			}
+
+			count := 0
+			for {
+				_, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read() unexpected error: %v", err)
+				}
+				count++
+			}
+			if count != tt.wantRecords {
+				t.Errorf("Read() returned %d records, want %d", count, tt.wantRecords)
+			}
+		})
+	}
+}
+
+// TestOpenCSVWithOptions tests reading files in other CSV dialects
+func TestOpenCSVWithOptions(t *testing.T) {
+	tests := []struct {
+		name        string
+		csvContent  string
+		opts        CSVOptions
+		wantHeaders []string
+		wantRecords [][]string
+		wantErr     string
+	}{
+		{
+			name:        "tab-separated with header the heuristics miss",
+			csvContent:  "ts\tuser\top\tkb\n1587772800\tjeff22\tupload\t45\n",
+			opts:        CSVOptions{Delimiter: '\t', Header: HeaderYes},
+			wantHeaders: []string{"ts", "user", "op", "kb"},
+			wantRecords: [][]string{{"1587772800", "jeff22", "upload", "45"}},
+		},
+		{
+			name:        "comments and padded fields",
+			csvContent:  "# exported nightly\ntimestamp|username|operation|size\n1587772800| jeff22| upload| 45\n# trailer\n",
+			opts:        CSVOptions{Delimiter: '|', Comment: '#', TrimLeadingSpace: true},
+			wantHeaders: []string{"timestamp", "username", "operation", "size"},
+			wantRecords: [][]string{{"1587772800", "jeff22", "upload", "45"}},
+		},
+		{
+			name:        "no header row",
+			csvContent:  "timestamp,username,operation,size\n",
+			opts:        CSVOptions{Header: HeaderNo},
+			wantHeaders: []string{"column_1", "column_2", "column_3", "column_4"},
+			wantRecords: [][]string{{"timestamp", "username", "operation", "size"}},
+		},
+		{
+			name:        "explicit columns without header row",
+			csvContent:  "1587772800;jeff22\n",
+			opts:        CSVOptions{Delimiter: ';', Columns: []string{"ts", "user"}},
+			wantHeaders: []string{"ts", "user"},
+			wantRecords: [][]string{{"1587772800", "jeff22"}},
+		},
+		{
+			name:        "explicit columns replace header row",
+			csvContent:  "a,b\n1587772800,jeff22\n",
+			opts:        CSVOptions{Header: HeaderYes, Columns: []string{"ts", "user"}},
+			wantHeaders: []string{"ts", "user"},
+			wantRecords: [][]string{{"1587772800", "jeff22"}},
+		},
+		{
+			name:        "lazy quotes",
+			csvContent:  "name,comment\njeff22,said \"hi\" twice\n",
+			opts:        CSVOptions{LazyQuotes: true},
+			wantHeaders: []string{"name", "comment"},
+			wantRecords: [][]string{{"jeff22", `said "hi" twice`}},
+		},
+		{
+			name:       "explicit columns of the wrong width",
+			csvContent: "1587772800,jeff22,upload\n",
+			opts:       CSVOptions{Columns: []string{"ts", "user"}},
+			wantErr:    "expected 2 columns",
+		},
+		{
+			name:       "invalid delimiter",
+			csvContent: "a,b\n",
+			opts:       CSVOptions{Delimiter: '"'},
+			wantErr:    "invalid delimiter",
+		},
+		{
+			name:       "invalid header mode",
+			csvContent: "a,b\n",
+			opts:       CSVOptions{Header: "maybe"},
+			wantErr:    "invalid header mode",
+		},
+		{
+			name:       "comment equal to delimiter",
+			csvContent: "a,b\n",
+			opts:       CSVOptions{Delimiter: '#', Comment: '#'},
+			wantErr:    "must differ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpFile := createTempCSVFile(t, tt.csvContent)
+			defer os.Remove(tmpFile)
+
+			reader, err := OpenCSVWithOptions(tmpFile, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("OpenCSVWithOptions() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenCSVWithOptions() unexpected error: %v", err)
+			}
+			defer reader.Close()
+
+			if fmt.Sprint(reader.Headers()) != fmt.Sprint(tt.wantHeaders) {
+				t.Errorf("Headers() = %v, want %v", reader.Headers(), tt.wantHeaders)
+			}
+
+			var records [][]string
+			for {
+				record, err := reader.Read()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("Read() unexpected error: %v", err)
+				}
+				records = append(records, record)
+			}
+			if fmt.Sprintf("%q", records) != fmt.Sprintf("%q", tt.wantRecords) {
+				t.Errorf("Records = %q, want %q", records, tt.wantRecords)
+			}
+		})
+	}
+}
+
+// TestNewCSVReader tests streaming CSV from a reader such as standard input
+func TestNewCSVReader(t *testing.T) {
+	const content = "timestamp,username,operation,size\n1587772800,jeff22,upload,45\n"
+
+	for name, input := range map[string][]byte{
+		"plain": []byte(content),
+		"gzip":  compressGzip(t, content),
+	} {
+		t.Run(name, func(t *testing.T) {
+			reader, err := NewCSVReader(bytes.NewReader(input), CSVOptions{})
+			if err != nil {
+				t.Fatalf("NewCSVReader() unexpected error: %v", err)
+			}
+			defer reader.Close()
+
+			if got := strings.Join(reader.Headers(), ","); got != "timestamp,username,operation,size" {
+				t.Errorf("Headers() = %s", got)
+			}
+			record, err := reader.Read()
+			if err != nil || record[1] != "jeff22" {
+				t.Errorf("Read() = %v, %v, want jeff22 record", record, err)
+			}
+			if _, err := reader.Read(); err != io.EOF {
+				t.Errorf("Read() error = %v, want io.EOF", err)
 			}
 		})
 	}
 }
 
+// TestCSVReaderReadBatch tests that batches are bounded and the final batch is short
+func TestCSVReaderReadBatch(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("timestamp,username,operation,size\n")
+	for i := 0; i < 25; i++ {
+		fmt.Fprintf(&sb, "%d,user%d,upload,%d\n", 1587772800+i, i, i)
+	}
+
+	tmpFile := createTempCSVFile(t, sb.String())
+	defer os.Remove(tmpFile)
+
+	reader, err := OpenCSV(tmpFile)
+	if err != nil {
+		t.Fatalf("OpenCSV() error = %v", err)
+	}
+	defer reader.Close()
+
+	var sizes []int
+	for {
+		batch, err := reader.ReadBatch(10)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ReadBatch() unexpected error: %v", err)
+		}
+		sizes = append(sizes, len(batch))
+	}
+
+	if fmt.Sprint(sizes) != "[10 10 5]" {
+		t.Errorf("ReadBatch() sizes = %v, want [10 10 5]", sizes)
+	}
+	if reader.Line() != 26 {
+		t.Errorf("Line() = %d, want 26", reader.Line())
+	}
+}
+
 // TestIsValidOperation tests operation validation
 func TestIsValidOperation(t *testing.T) {
 	tests := []struct {
@@ -209,3 +428,30 @@ func ExampleParseCSV() {
 	// Operation: upload
 	// Size: 45
 }
+
+// TestCompleteRecords tests finding the end of the complete records of data
+// that may end in the middle of a record
+func TestCompleteRecords(t *testing.T) {
+	tests := []struct {
+		name string
+		opts CSVOptions
+		data string
+		want string
+	}{
+		{"complete lines", CSVOptions{}, "a,b\n1,2\n", "a,b\n1,2\n"},
+		{"partial line", CSVOptions{}, "a,b\n1,", "a,b\n"},
+		{"newline in quoted field", CSVOptions{}, "a,b\n1,\"x\ny\"\n2,\"z\n", "a,b\n1,\"x\ny\"\n"},
+		{"lazy quotes", CSVOptions{LazyQuotes: true}, "a,b\n1,\"x\n", "a,b\n"},
+		{"crlf", CSVOptions{}, "a,b\r\n1,2\r\n3", "a,b\r\n1,2\r\n"},
+		{"delimiter", CSVOptions{Delimiter: ';'}, "a;\"b\nc\"\n1;", "a;\"b\nc\"\n"},
+		{"nothing complete", CSVOptions{}, "\"a\n", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.data[:tt.opts.CompleteRecords([]byte(tt.data))]; got != tt.want {
+				t.Errorf("CompleteRecords() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+// Package parser provides CSV parsing functionality for server log files
+package parser
+
+import "fmt"
+
+// SchemaChangeKind identifies how a detected schema differs from an existing table
+type SchemaChangeKind int
+
+const (
+	ColumnAdded    SchemaChangeKind = iota // New input column, added to the table
+	ColumnWidened                          // Column type widened to hold the input values
+	ColumnNullable                         // NOT NULL dropped because the input has empty values
+	ColumnMissing                          // Table column absent from the input, stored as NULL or its default
+	ColumnTypeKept                         // Input type cannot be stored safely by widening; the table type is kept
+)
+
+// SchemaChange describes one difference between an existing table and a detected schema
+type SchemaChange struct {
+	Kind   SchemaChangeKind
+	Column string
+	From   ColumnType // Table type, for widened and kept columns
+	To     ColumnType // Detected or new type
+}
+
+// String returns a one-line description of the change
+func (c SchemaChange) String() string {
+	switch c.Kind {
+	case ColumnAdded:
+		return fmt.Sprintf("+ %s %s: new column added", c.Column, c.To.SQLType())
+	case ColumnWidened:
+		return fmt.Sprintf("~ %s: widened from %s to %s", c.Column, c.From.SQLType(), c.To.SQLType())
+	case ColumnNullable:
+		return fmt.Sprintf("~ %s: now allows NULL", c.Column)
+	case ColumnMissing:
+		return fmt.Sprintf("- %s: not in the input, stored as NULL or its default", c.Column)
+	default:
+		return fmt.Sprintf("! %s: detected as %s, kept as %s; values that do not convert are rejected",
+			c.Column, c.To.SQLType(), c.From.SQLType())
+	}
+}
+
+// EvolveSchema compares a detected schema with the schema of an existing table
+// and returns the table schema needed to store the detected columns, together
+// with the differences found. Columns are matched by name, so their order does
+// not matter. New columns are appended and allow NULL, since the rows already
+// in the table have no value for them (unless they have a default). Types are
+// only widened where every stored value keeps its meaning, i.e. INTEGER to REAL;
+// a TEXT table column already holds anything. Other disagreements keep the
+// table type and are reported as ColumnTypeKept
+func EvolveSchema(existing, detected *TableSchema) (*TableSchema, []SchemaChange) {
+	evolved := &TableSchema{
+		Name:    existing.Name,
+		Columns: make([]ColumnSchema, len(existing.Columns)),
+	}
+	copy(evolved.Columns, existing.Columns)
+
+	var changes []SchemaChange
+	for _, col := range detected.Columns {
+		current := evolved.Column(col.Name)
+		if current == nil {
+			added := col
+			added.Source = ""
+			added.Nullable = col.Nullable || col.Default == ""
+			evolved.Columns = append(evolved.Columns, added)
+			changes = append(changes, SchemaChange{Kind: ColumnAdded, Column: col.Name, To: col.Type})
+			continue
+		}
+
+		if widened := WidenType(current.Type, col.Type); widened != current.Type {
+			if widened == TypeReal {
+				changes = append(changes, SchemaChange{Kind: ColumnWidened, Column: col.Name, From: current.Type, To: widened})
+				current.Type = widened
+			} else {
+				changes = append(changes, SchemaChange{Kind: ColumnTypeKept, Column: col.Name, From: current.Type, To: col.Type})
+			}
+		}
+
+		if col.Nullable && !current.Nullable {
+			current.Nullable = true
+			changes = append(changes, SchemaChange{Kind: ColumnNullable, Column: col.Name})
+		}
+	}
+
+	for i := range evolved.Columns {
+		col := &evolved.Columns[i]
+		if i >= len(existing.Columns) || detected.Column(col.Name) != nil {
+			continue
+		}
+		changes = append(changes, SchemaChange{Kind: ColumnMissing, Column: col.Name})
+		if !col.Nullable && col.Default == "" {
+			col.Nullable = true
+		}
+	}
+
+	return evolved, changes
+}
@@ -0,0 +1,112 @@
+package parser
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestEvolveSchema tests comparing a detected schema with an existing table
+func TestEvolveSchema(t *testing.T) {
+	existing := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "timestamp", Type: TypeTimestamp},
+			{Name: "size", Type: TypeInteger},
+			{Name: "user", Type: TypeText},
+			{Name: "status", Type: TypeInteger},
+			{Name: "host", Type: TypeText},
+			{Name: "retries", Type: TypeInteger, Default: "0"},
+		},
+	}
+	// Columns in a different order, one new, two missing
+	detected := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "user", Type: TypeInteger, Nullable: true},
+			{Name: "region", Type: TypeText, Index: true, Source: "Region"},
+			{Name: "size", Type: TypeReal},
+			{Name: "timestamp", Type: TypeTimestamp},
+			{Name: "status", Type: TypeText},
+		},
+	}
+
+	evolved, changes := EvolveSchema(existing, detected)
+
+	wantColumns := []ColumnSchema{
+		{Name: "timestamp", Type: TypeTimestamp},
+		{Name: "size", Type: TypeReal},
+		{Name: "user", Type: TypeText, Nullable: true},
+		{Name: "status", Type: TypeInteger},
+		{Name: "host", Type: TypeText, Nullable: true},
+		{Name: "retries", Type: TypeInteger, Default: "0"},
+		{Name: "region", Type: TypeText, Nullable: true, Index: true},
+	}
+	if !reflect.DeepEqual(evolved.Columns, wantColumns) {
+		t.Errorf("Columns = %+v, want %+v", evolved.Columns, wantColumns)
+	}
+
+	wantChanges := []SchemaChange{
+		{Kind: ColumnNullable, Column: "user"},
+		{Kind: ColumnAdded, Column: "region", To: TypeText},
+		{Kind: ColumnWidened, Column: "size", From: TypeInteger, To: TypeReal},
+		{Kind: ColumnTypeKept, Column: "status", From: TypeInteger, To: TypeText},
+		{Kind: ColumnMissing, Column: "host"},
+		{Kind: ColumnMissing, Column: "retries"},
+	}
+	if !reflect.DeepEqual(changes, wantChanges) {
+		t.Errorf("Changes = %+v, want %+v", changes, wantChanges)
+	}
+
+	// The existing schema itself is left unchanged
+	if existing.Columns[1].Type != TypeInteger || len(existing.Columns) != 6 {
+		t.Errorf("EvolveSchema() modified the existing schema: %+v", existing.Columns)
+	}
+}
+
+// TestEvolveSchemaUnchanged tests that matching schemas report no changes
+func TestEvolveSchemaUnchanged(t *testing.T) {
+	existing := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "size", Type: TypeReal, Nullable: true},
+			{Name: "user", Type: TypeText},
+		},
+	}
+	// Narrower types and stricter nullability fit the existing columns
+	detected := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "user", Type: TypeBoolean},
+			{Name: "size", Type: TypeInteger},
+		},
+	}
+
+	evolved, changes := EvolveSchema(existing, detected)
+	if len(changes) != 0 {
+		t.Errorf("Expected no changes, got %+v", changes)
+	}
+	if !reflect.DeepEqual(evolved.Columns, existing.Columns) {
+		t.Errorf("Columns = %+v, want %+v", evolved.Columns, existing.Columns)
+	}
+}
+
+// TestSchemaChangeString tests the descriptions printed for schema changes
+func TestSchemaChangeString(t *testing.T) {
+	tests := []struct {
+		change SchemaChange
+		want   string
+	}{
+		{SchemaChange{Kind: ColumnAdded, Column: "region", To: TypeText}, "+ region TEXT"},
+		{SchemaChange{Kind: ColumnWidened, Column: "size", From: TypeInteger, To: TypeReal}, "widened from INTEGER to REAL"},
+		{SchemaChange{Kind: ColumnNullable, Column: "user"}, "user: now allows NULL"},
+		{SchemaChange{Kind: ColumnMissing, Column: "host"}, "- host: not in the input"},
+		{SchemaChange{Kind: ColumnTypeKept, Column: "status", From: TypeInteger, To: TypeText}, "detected as TEXT, kept as INTEGER"},
+	}
+
+	for _, tt := range tests {
+		if got := tt.change.String(); !strings.Contains(got, tt.want) {
+			t.Errorf("String() = %q, want it to contain %q", got, tt.want)
+		}
+	}
+}
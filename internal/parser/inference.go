@@ -0,0 +1,212 @@
+// Package parser provides CSV parsing and schema detection functionality
+package parser
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"server-log-analyzer/internal/config"
+)
+
+// inferenceTypes are the types a column can be inferred as besides TEXT, in
+// order of preference: a column takes the first type enough of its values fit
+var inferenceTypes = []ColumnType{TypeBoolean, TypeTimestamp, TypeInteger, TypeReal}
+
+// ColumnInference records how the sampled values of a column fit each type
+// It explains the inferred type of a column: how many values convert to it,
+// how many are empty, and examples of those that do not convert
+type ColumnInference struct {
+	Sampled int // Values sampled, empty ones included
+	Empty   int // Empty, blank or missing values, stored as NULL
+
+	fits    map[ColumnType]int      // Non-empty values that fit each type
+	misfits map[ColumnType][]string // Distinct examples of non-empty values that do not
+}
+
+// inferColumn examines the sampled values of one column
+func inferColumn(records [][]string, columnIndex int, sampleSize int) *ColumnInference {
+	ci := &ColumnInference{
+		fits:    make(map[ColumnType]int),
+		misfits: make(map[ColumnType][]string),
+	}
+
+	for i := 0; i < sampleSize && i < len(records); i++ {
+		ci.Sampled++
+		if columnIndex >= len(records[i]) {
+			ci.Empty++
+			continue
+		}
+
+		value := strings.TrimSpace(records[i][columnIndex])
+		if value == "" {
+			ci.Empty++
+			continue
+		}
+
+		for _, columnType := range inferenceTypes {
+			if fitsType(value, columnType) {
+				ci.fits[columnType]++
+			} else {
+				ci.addMisfit(columnType, value)
+			}
+		}
+	}
+
+	return ci
+}
+
+// addMisfit keeps a value as an example of those that do not fit a type
+func (ci *ColumnInference) addMisfit(columnType ColumnType, value string) {
+	examples := ci.misfits[columnType]
+	if len(examples) < config.InferenceExamples && !slices.Contains(examples, value) {
+		ci.misfits[columnType] = append(examples, value)
+	}
+}
+
+// fitsType reports whether a trimmed, non-empty value can be inferred as the
+// type. Every value that fits converts with ParseValue; the reverse does not
+// hold, as inference is stricter (1 converts to a boolean but counts as a number)
+func fitsType(value string, columnType ColumnType) bool {
+	switch columnType {
+	case TypeBoolean:
+		return isBoolean(value)
+	case TypeTimestamp:
+		return isTimestamp(value)
+	case TypeInteger, TypeReal:
+		_, err := ParseValue(value, columnType, time.UTC)
+		return err == nil
+	default:
+		return true
+	}
+}
+
+// NonEmpty returns the number of sampled values that are not empty
+func (ci *ColumnInference) NonEmpty() int {
+	return ci.Sampled - ci.Empty
+}
+
+// Fits returns the number of non-empty values that fit the type
+func (ci *ColumnInference) Fits(columnType ColumnType) int {
+	if columnType == TypeText {
+		return ci.NonEmpty()
+	}
+	return ci.fits[columnType]
+}
+
+// Confidence returns the share of non-empty values that fit the type, 1 when
+// every value is empty
+func (ci *ColumnInference) Confidence(columnType ColumnType) float64 {
+	if ci.NonEmpty() == 0 {
+		return 1
+	}
+	return float64(ci.Fits(columnType)) / float64(ci.NonEmpty())
+}
+
+// NullRatio returns the share of sampled values that are empty
+func (ci *ColumnInference) NullRatio() float64 {
+	if ci.Sampled == 0 {
+		return 0
+	}
+	return float64(ci.Empty) / float64(ci.Sampled)
+}
+
+// Examples returns up to config.InferenceExamples sampled values that do not fit the type
+func (ci *ColumnInference) Examples(columnType ColumnType) []string {
+	if columnType == TypeText {
+		return nil
+	}
+	return ci.misfits[columnType]
+}
+
+// Type returns the inferred type: the first of the inference types that at
+// least config.TypeInferenceThreshold of the non-empty values fit, or TEXT
+// An INTEGER column is widened to REAL when more values fit REAL, since
+// integers are stored in a REAL column without loss
+func (ci *ColumnInference) Type() ColumnType {
+	if ci.NonEmpty() == 0 {
+		return TypeText
+	}
+
+	for _, columnType := range inferenceTypes {
+		if ci.Confidence(columnType) < config.TypeInferenceThreshold {
+			continue
+		}
+		if columnType == TypeInteger && ci.Fits(TypeReal) > ci.Fits(TypeInteger) {
+			return TypeReal
+		}
+		return columnType
+	}
+	return TypeText
+}
+
+// Candidate returns the type other than TEXT that most non-empty values fit,
+// and false if none fits any. For a column inferred as TEXT it tells how close
+// the column came to another type
+func (ci *ColumnInference) Candidate() (ColumnType, bool) {
+	best, bestFits := TypeText, 0
+	for _, columnType := range inferenceTypes {
+		if fits := ci.Fits(columnType); fits > bestFits {
+			best, bestFits = columnType, fits
+		}
+	}
+	return best, bestFits > 0
+}
+
+// merge returns the combined inference of the same column sampled from two files
+func (ci *ColumnInference) merge(other *ColumnInference) *ColumnInference {
+	merged := &ColumnInference{
+		Sampled: ci.Sampled + other.Sampled,
+		Empty:   ci.Empty + other.Empty,
+		fits:    make(map[ColumnType]int),
+		misfits: make(map[ColumnType][]string),
+	}
+	for _, columnType := range inferenceTypes {
+		merged.fits[columnType] = ci.fits[columnType] + other.fits[columnType]
+		for _, value := range slices.Concat(ci.misfits[columnType], other.misfits[columnType]) {
+			merged.addMisfit(columnType, value)
+		}
+	}
+	return merged
+}
+
+// ParseValue converts a non-empty value to the Go value stored for the type:
+// int64, float64, bool, time.Time (in UTC) or, for TEXT, the value itself
+// Surrounding white space is ignored except in TEXT values. Timestamps without
+// a zone are read in loc (UTC when nil)
+func ParseValue(value string, columnType ColumnType, loc *time.Location) (interface{}, error) {
+	if columnType != TypeText {
+		value = strings.TrimSpace(value)
+	}
+
+	switch columnType {
+	case TypeTimestamp:
+		return ParseTimestamp(value, loc)
+	case TypeInteger:
+		return strconv.ParseInt(value, 10, 64)
+	case TypeReal:
+		return strconv.ParseFloat(value, 64)
+	case TypeBoolean:
+		return ParseBoolean(value)
+	default:
+		return value, nil
+	}
+}
+
+// ParseBoolean parses the boolean spellings schema detection recognises
+// (true/false, yes/no, y/n in any case) and those of strconv.ParseBool
+func ParseBoolean(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "yes", "y":
+		return true, nil
+	case "no", "n":
+		return false, nil
+	}
+	b, err := strconv.ParseBool(strings.ToLower(value))
+	if err != nil {
+		return false, fmt.Errorf("not a boolean, expected true/false, yes/no, y/n or 1/0")
+	}
+	return b, nil
+}
@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestInferColumn tests the inferred type, confidence, empty count and examples of a column
+func TestInferColumn(t *testing.T) {
+	tests := []struct {
+		name           string
+		values         []string
+		wantType       ColumnType
+		wantConfidence float64
+		wantEmpty      int
+		wantExamples   []string
+	}{
+		{"integers", []string{"1", "2", "3"}, TypeInteger, 1, 0, nil},
+		{"padded integers", []string{" 1", "2 ", " 3 "}, TypeInteger, 1, 0, nil},
+		{"integers and reals", []string{"1", "2.5", "3", "4"}, TypeReal, 1, 0, nil},
+		{"mostly integers", []string{"1", "2", "3", "4", "N/A"}, TypeInteger, 0.8, 0, []string{"N/A"}},
+		{"too few integers", []string{"1", "2", "3", "N/A", "-"}, TypeText, 1, 0, nil},
+		{"yes and no", []string{"y", "N", "yes", "no"}, TypeBoolean, 1, 0, nil},
+		{"zero and one", []string{"0", "1", "1", "0"}, TypeInteger, 1, 0, nil},
+		{"blanks are empty", []string{"", "  ", "5", "6"}, TypeInteger, 1, 2, nil},
+		{"all empty", []string{"", ""}, TypeText, 1, 2, nil},
+		{"timestamps", []string{"1587504638", "2020-04-15 10:00:00", "tomorrow", "2020-04-16", "2020-04-17"}, TypeTimestamp, 0.8, 0, []string{"tomorrow"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := make([][]string, len(tt.values))
+			for i, value := range tt.values {
+				records[i] = []string{value}
+			}
+
+			ci := inferColumn(records, 0, len(records))
+			if got := ci.Type(); got != tt.wantType {
+				t.Errorf("Type() = %s, want %s", got, tt.wantType)
+			}
+			if got := ci.Confidence(tt.wantType); got != tt.wantConfidence {
+				t.Errorf("Confidence() = %v, want %v", got, tt.wantConfidence)
+			}
+			if ci.Empty != tt.wantEmpty || ci.Sampled != len(tt.values) {
+				t.Errorf("Empty, Sampled = %d, %d, want %d, %d", ci.Empty, ci.Sampled, tt.wantEmpty, len(tt.values))
+			}
+			if got := ci.Examples(tt.wantType); !slices.Equal(got, tt.wantExamples) {
+				t.Errorf("Examples() = %v, want %v", got, tt.wantExamples)
+			}
+		})
+	}
+}
+
+// TestInferColumnCandidate tests reporting the type a TEXT column came close to
+func TestInferColumnCandidate(t *testing.T) {
+	records := [][]string{{"1"}, {"2"}, {"3"}, {"N/A"}, {"-"}, {"-"}}
+	ci := inferColumn(records, 0, len(records))
+
+	candidate, ok := ci.Candidate()
+	if !ok || candidate != TypeInteger {
+		t.Fatalf("Candidate() = %s, %t, want INTEGER", candidate, ok)
+	}
+	if got := ci.Confidence(candidate); got != 0.5 {
+		t.Errorf("Confidence(INTEGER) = %v, want 0.5", got)
+	}
+	if got := ci.Examples(candidate); !slices.Equal(got, []string{"N/A", "-"}) {
+		t.Errorf("Examples(INTEGER) = %v, want distinct values", got)
+	}
+
+	text := inferColumn([][]string{{"alice"}, {"bob"}}, 0, 2)
+	if _, ok := text.Candidate(); ok {
+		t.Error("Expected no candidate for a column of names")
+	}
+}
+
+// TestInferredTypesConvert tests that every value that fits a type converts to it
+func TestInferredTypesConvert(t *testing.T) {
+	values := []string{
+		"0", "1", "-42", "007", "3.14", "1e5", "-0.5", "true", "FALSE", "yes", "No", "Y", "n",
+		"1587504638", "1587504638000", "2020-04-15", "2020-04-15 10:00:00", "2020-04-15T10:00:00Z",
+		"04/15/2020 10:00:00", "Sun Apr 12 22:10:38 UTC 2020", "hello", "N/A", "t", "f",
+	}
+
+	for _, value := range values {
+		for _, columnType := range inferenceTypes {
+			if !fitsType(value, columnType) {
+				continue
+			}
+			if _, err := ParseValue(" "+value+" ", columnType, time.UTC); err != nil {
+				t.Errorf("%q fits %s but does not convert: %v", value, columnType, err)
+			}
+		}
+	}
+}
+
+// TestParseBoolean tests the accepted boolean spellings
+func TestParseBoolean(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    bool
+		wantErr bool
+	}{
+		{"true", true, false},
+		{"False", false, false},
+		{"YES", true, false},
+		{"no", false, false},
+		{"y", true, false},
+		{"N", false, false},
+		{"1", true, false},
+		{"0", false, false},
+		{"maybe", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseBoolean(tt.value)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("ParseBoolean(%q) = %v, %v, want %v (error %t)", tt.value, got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+// TestMergeSchemasInference tests inferring the type again from the samples of both files
+func TestMergeSchemasInference(t *testing.T) {
+	ints := make([][]string, 9)
+	for i := range ints {
+		ints[i] = []string{"10"}
+	}
+	base, err := DetectSchema([]string{"size"}, ints, "logs")
+	if err != nil {
+		t.Fatalf("DetectSchema() error = %v", err)
+	}
+	// On its own the second file is TEXT: half of its values are not numbers
+	other, err := DetectSchema([]string{"size"}, [][]string{{"20"}, {"N/A"}}, "logs")
+	if err != nil {
+		t.Fatalf("DetectSchema() error = %v", err)
+	}
+	if other.Columns[0].Type != TypeText {
+		t.Fatalf("Expected the second file to be TEXT, got %s", other.Columns[0].Type)
+	}
+
+	merged, err := MergeSchemas(base, other)
+	if err != nil {
+		t.Fatalf("MergeSchemas() error = %v", err)
+	}
+	col := merged.Columns[0]
+	if col.Type != TypeInteger {
+		t.Errorf("Expected 10 of 11 integers to make an INTEGER column, got %s", col.Type)
+	}
+	if col.Inference.Sampled != 11 || !slices.Equal(col.Inference.Examples(TypeInteger), []string{"N/A"}) {
+		t.Errorf("Expected the merged inference to cover both samples, got %+v", col.Inference)
+	}
+}
@@ -0,0 +1,244 @@
+// Package parser provides CSV parsing functionality for server log files
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"server-log-analyzer/internal/config"
+)
+
+// JSONLReader streams records from a JSON Lines (NDJSON) input
+// Nested objects are flattened into dotted keys ({"http": {"status": 200}} gives
+// http.status, stored in column http_status like any header); arrays are kept
+// as JSON text and null becomes an empty value. Keys that would be stored in
+// the same column, such as a_b and a.b, are an error
+// The columns are the keys found in the first SchemaDetectionSampleSize objects,
+// in the order they first appear; a later object with a new key is reported as a
+// ParseError and keys missing from an object are left empty
+type JSONLReader struct {
+	input   io.ReadCloser
+	reader  *bufio.Reader
+	headers []string
+	index   map[string]int // Column position of each key
+	pending []jsonlLine    // Lines read ahead to discover the columns
+	line    int            // Line number of the most recently returned record
+	read    int            // Line number of the last line read from the input
+}
+
+// jsonlLine is one parsed line of input
+type jsonlLine struct {
+	line   int
+	fields []jsonField
+	err    error
+}
+
+// jsonField is a flattened key and its value as text
+type jsonField struct {
+	key   string
+	value string
+}
+
+// OpenJSONL opens a JSON Lines file for streaming
+// Compressed files (gzip, bzip2, zstd) are decompressed on the fly
+func OpenJSONL(filePath string) (*JSONLReader, error) {
+	file, err := OpenInput(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open JSON Lines file: %w", err)
+	}
+
+	r, err := newJSONLReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// newJSONLReader reads ahead a sample of input to discover the columns
+func newJSONLReader(input io.ReadCloser) (*JSONLReader, error) {
+	r := &JSONLReader{
+		input:  input,
+		reader: bufio.NewReader(input),
+		index:  make(map[string]int),
+	}
+
+	for len(r.pending) < config.SchemaDetectionSampleSize {
+		parsed, err := r.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, field := range parsed.fields {
+			if _, ok := r.index[field.key]; !ok {
+				r.index[field.key] = len(r.headers)
+				r.headers = append(r.headers, field.key)
+			}
+		}
+		r.pending = append(r.pending, parsed)
+	}
+
+	if len(r.headers) == 0 {
+		return nil, fmt.Errorf("no JSON objects found in input")
+	}
+
+	columns := make(map[string]string, len(r.headers))
+	for _, key := range r.headers {
+		column := sanitizeColumnName(key)
+		if other, ok := columns[column]; ok {
+			return nil, fmt.Errorf("JSON keys '%s' and '%s' would both be stored in column '%s'", other, key, column)
+		}
+		columns[column] = key
+	}
+
+	return r, nil
+}
+
+// next reads and parses the next non-blank line
+// Malformed JSON is returned as a jsonlLine carrying the error
+func (r *JSONLReader) next() (jsonlLine, error) {
+	for {
+		data, err := r.reader.ReadBytes('\n')
+		if len(data) == 0 && err == io.EOF {
+			return jsonlLine{}, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return jsonlLine{}, fmt.Errorf("error reading JSON Lines at line %d: %w", r.read+1, err)
+		}
+		r.read++
+
+		data = bytes.TrimSpace(data)
+		if len(data) == 0 {
+			continue
+		}
+
+		fields, parseErr := flattenJSON(data)
+		return jsonlLine{line: r.read, fields: fields, err: parseErr}, nil
+	}
+}
+
+// Headers returns the flattened keys used as column names
+func (r *JSONLReader) Headers() []string {
+	return r.headers
+}
+
+// Read returns the next record, or io.EOF when the input is exhausted
+// Malformed lines and objects with unknown keys are returned as a *ParseError
+func (r *JSONLReader) Read() ([]string, error) {
+	var parsed jsonlLine
+	if len(r.pending) > 0 {
+		parsed = r.pending[0]
+		r.pending = r.pending[1:]
+	} else {
+		var err error
+		if parsed, err = r.next(); err != nil {
+			return nil, err
+		}
+	}
+	r.line = parsed.line
+
+	if parsed.err != nil {
+		return nil, &ParseError{Line: parsed.line, Err: parsed.err}
+	}
+
+	record := make([]string, len(r.headers))
+	for _, field := range parsed.fields {
+		i, ok := r.index[field.key]
+		if !ok {
+			return nil, &ParseError{Line: parsed.line, Err: fmt.Errorf("unexpected field '%s' not present in the first %d records", field.key, config.SchemaDetectionSampleSize)}
+		}
+		record[i] = field.value
+	}
+
+	return record, nil
+}
+
+// Line returns the line number of the most recently read record
+func (r *JSONLReader) Line() int {
+	return r.line
+}
+
+// Close releases the underlying file
+func (r *JSONLReader) Close() error {
+	return r.input.Close()
+}
+
+// flattenJSON parses one JSON object into flattened fields, keeping key order
+func flattenJSON(data []byte) ([]jsonField, error) {
+	if data[0] != '{' {
+		return nil, fmt.Errorf("expected a JSON object")
+	}
+
+	var fields []jsonField
+	if err := flattenObject(data, "", &fields); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	return fields, nil
+}
+
+// flattenObject appends the fields of a JSON object, prefixing nested keys with their parent's name
+func flattenObject(data []byte, prefix string, fields *[]jsonField) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	// Opening brace
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key := prefix + token.(string)
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+
+		switch raw[0] {
+		case '{':
+			if err := flattenObject(raw, key+".", fields); err != nil {
+				return err
+			}
+		case '[':
+			// Arrays are stored as compact JSON text
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, raw); err != nil {
+				return err
+			}
+			*fields = append(*fields, jsonField{key: key, value: compact.String()})
+		case '"':
+			var s string
+			if err := json.Unmarshal(raw, &s); err != nil {
+				return err
+			}
+			*fields = append(*fields, jsonField{key: key, value: s})
+		case 'n':
+			*fields = append(*fields, jsonField{key: key, value: ""})
+		default:
+			// Numbers and booleans keep their JSON spelling
+			*fields = append(*fields, jsonField{key: key, value: strings.TrimSpace(string(raw))})
+		}
+	}
+
+	// Closing brace, then nothing else may follow the object
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after JSON object")
+	}
+
+	return nil
+}
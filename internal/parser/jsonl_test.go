@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestFlattenJSON tests flattening JSON objects into ordered fields
+func TestFlattenJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{
+			name:  "flat object keeps key order",
+			input: `{"ts": 1587772800, "user": "jeff22", "ok": true}`,
+			want:  "ts=1587772800 user=jeff22 ok=true",
+		},
+		{
+			name:  "nested objects use dotted names",
+			input: `{"http": {"method": "GET", "status": 200}, "size": 1.5}`,
+			want:  "http.method=GET http.status=200 size=1.5",
+		},
+		{
+			name:  "arrays are JSON text and null is empty",
+			input: `{"tags": [ "a", 1 ], "error": null}`,
+			want:  `tags=["a",1] error=`,
+		},
+		{
+			name:  "large numbers keep their spelling",
+			input: `{"id": 12345678901234567890}`,
+			want:  "id=12345678901234567890",
+		},
+		{
+			name:    "not an object",
+			input:   `[1, 2]`,
+			wantErr: true,
+		},
+		{
+			name:    "truncated object",
+			input:   `{"ts": 1587772800, "user":`,
+			wantErr: true,
+		},
+		{
+			name:    "trailing data",
+			input:   `{"ts": 1} {"ts": 2}`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields, err := flattenJSON([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("flattenJSON() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var parts []string
+			for _, f := range fields {
+				parts = append(parts, f.key+"="+f.value)
+			}
+			if got := strings.Join(parts, " "); got != tt.want {
+				t.Errorf("flattenJSON() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestOpenJSONL tests streaming records from a JSON Lines file
+func TestOpenJSONL(t *testing.T) {
+	content := `{"timestamp": 1587772800, "user": {"name": "jeff22"}, "size": 45}
+
+{"timestamp": 1587772900, "size": 120, "user": {"name": "alice42", "id": 7}}
+not json
+{"timestamp": 1587773000, "user": {"name": "bob"}}
+`
+	tmpFile := createTempCSVFile(t, content)
+	defer os.Remove(tmpFile)
+
+	reader, err := OpenJSONL(tmpFile)
+	if err != nil {
+		t.Fatalf("OpenJSONL() unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	wantHeaders := []string{"timestamp", "user.name", "size", "user.id"}
+	if fmt.Sprint(reader.Headers()) != fmt.Sprint(wantHeaders) {
+		t.Errorf("Headers() = %v, want %v", reader.Headers(), wantHeaders)
+	}
+
+	want := []struct {
+		record string
+		line   int
+		bad    bool
+	}{
+		{record: "[1587772800 jeff22 45 ]", line: 1},
+		{record: "[1587772900 alice42 120 7]", line: 3},
+		{line: 4, bad: true},
+		{record: "[1587773000 bob  ]", line: 5},
+	}
+
+	for i, w := range want {
+		record, err := reader.Read()
+		var parseErr *ParseError
+		if w.bad {
+			if !errors.As(err, &parseErr) || parseErr.Line != w.line {
+				t.Errorf("Read() %d error = %v, want ParseError at line %d", i, err, w.line)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Read() %d unexpected error: %v", i, err)
+		}
+		if fmt.Sprint(record) != w.record || reader.Line() != w.line {
+			t.Errorf("Read() %d = %v at line %d, want %s at line %d", i, record, reader.Line(), w.record, w.line)
+		}
+	}
+
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+}
+
+// TestJSONLReaderUnknownField tests that keys first seen after the sample are rejected
+func TestJSONLReaderUnknownField(t *testing.T) {
+	var sb strings.Builder
+	for i := 0; i < 1001; i++ {
+		fmt.Fprintf(&sb, `{"n": %d}`+"\n", i)
+	}
+	sb.WriteString(`{"n": 1, "extra": "x"}` + "\n")
+
+	reader, err := newJSONLReader(io.NopCloser(strings.NewReader(sb.String())))
+	if err != nil {
+		t.Fatalf("newJSONLReader() unexpected error: %v", err)
+	}
+
+	for i := 0; i < 1001; i++ {
+		if _, err := reader.Read(); err != nil {
+			t.Fatalf("Read() %d unexpected error: %v", i, err)
+		}
+	}
+
+	_, err = reader.Read()
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || !strings.Contains(err.Error(), "unexpected field 'extra'") {
+		t.Errorf("Read() error = %v, want unexpected field error", err)
+	}
+}
+
+// TestJSONLReaderColumnCollision tests keys that would be stored in the same column
+func TestJSONLReaderColumnCollision(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"flattened and underscored", `{"a_b": 2, "a": {"b": 3}}`, "JSON keys 'a_b' and 'a.b' would both be stored in column 'a_b'"},
+		{"keys in another object", "{\"User\": \"x\"}\n{\"user\": \"y\"}", "JSON keys 'User' and 'user' would both be stored in column 'user'"},
+		{"quotes", `{"say \"hi\"": 1, "say (hi)": 2}`, "would both be stored in column 'say__hi_'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newJSONLReader(io.NopCloser(strings.NewReader(tt.input)))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("newJSONLReader() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Package parser provides CSV parsing functionality for server log files
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SchemaOverride corrects a detected schema
+// It is read from a YAML or JSON file; only the listed columns and only the
+// fields that are set are changed, so the file can be as small as one line
+type SchemaOverride struct {
+	Columns []ColumnOverride `yaml:"columns" json:"columns"`
+}
+
+// ColumnOverride changes one detected column, identified by its detected name
+type ColumnOverride struct {
+	Name     string  `yaml:"name" json:"name"`
+	Type     string  `yaml:"type,omitempty" json:"type,omitempty"`
+	Nullable *bool   `yaml:"nullable,omitempty" json:"nullable,omitempty"`
+	Index    *bool   `yaml:"index,omitempty" json:"index,omitempty"`
+	Rename   string  `yaml:"rename,omitempty" json:"rename,omitempty"`
+	Default  *string `yaml:"default,omitempty" json:"default,omitempty"`
+	Check    string  `yaml:"check,omitempty" json:"check,omitempty"`
+
+	ValidationRules `yaml:",inline"`
+}
+
+// ParseColumnType converts a type name as written in a schema file into a ColumnType
+// Both the detected names and the SQLite names are accepted (TIMESTAMP or DATETIME)
+func ParseColumnType(name string) (ColumnType, error) {
+	switch strings.ToUpper(strings.TrimSpace(name)) {
+	case "TEXT", "STRING":
+		return TypeText, nil
+	case "INTEGER", "INT":
+		return TypeInteger, nil
+	case "REAL", "FLOAT":
+		return TypeReal, nil
+	case "TIMESTAMP", "DATETIME":
+		return TypeTimestamp, nil
+	case "BOOLEAN", "BOOL":
+		return TypeBoolean, nil
+	}
+	return TypeText, fmt.Errorf("unknown column type '%s': must be TEXT, INTEGER, REAL, TIMESTAMP or BOOLEAN", name)
+}
+
+// LoadSchemaOverride reads a schema override file
+// JSON is a subset of YAML, so both formats are read the same way
+func LoadSchemaOverride(path string) (*SchemaOverride, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+
+	var override SchemaOverride
+	if err := dec.Decode(&override); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid schema file %s: %w", path, err)
+	}
+
+	for i, col := range override.Columns {
+		if col.Name == "" {
+			return nil, fmt.Errorf("invalid schema file %s: column %d has no name", path, i+1)
+		}
+		if col.Type != "" {
+			if _, err := ParseColumnType(col.Type); err != nil {
+				return nil, fmt.Errorf("invalid schema file %s: column '%s': %w", path, col.Name, err)
+			}
+		}
+		if err := col.ValidationRules.compile(); err != nil {
+			return nil, fmt.Errorf("invalid schema file %s: column '%s': %w", path, col.Name, err)
+		}
+	}
+
+	return &override, nil
+}
+
+// Apply returns a copy of schema with the overrides applied
+// Columns are matched by their detected name; renamed columns keep reading
+// their values from the original input column
+func (o *SchemaOverride) Apply(schema *TableSchema) (*TableSchema, error) {
+	result := &TableSchema{
+		Name:    schema.Name,
+		Columns: make([]ColumnSchema, len(schema.Columns)),
+	}
+	copy(result.Columns, schema.Columns)
+
+	for _, override := range o.Columns {
+		col := result.sourceColumn(sanitizeColumnName(override.Name))
+		if col == nil {
+			return nil, fmt.Errorf("schema file: column '%s' not found in input (columns: %s)",
+				override.Name, strings.Join(schema.ColumnNames(), ", "))
+		}
+
+		if override.Type != "" {
+			columnType, err := ParseColumnType(override.Type)
+			if err != nil {
+				return nil, fmt.Errorf("schema file: column '%s': %w", override.Name, err)
+			}
+			col.Type = columnType
+			col.Inference = nil // The type is declared, not inferred
+		}
+		if override.Nullable != nil {
+			col.Nullable = *override.Nullable
+		}
+		if override.Index != nil {
+			col.Index = *override.Index
+		}
+		if override.Default != nil {
+			col.Default = *override.Default
+		}
+		if override.Check != "" {
+			col.Check = override.Check
+		}
+		if override.Rename != "" {
+			col.Source = col.SourceName()
+			col.Name = sanitizeColumnName(override.Rename)
+		}
+		if override.Type != "" && col.Type != TypeText {
+			col.Domain = nil // Detected categories are TEXT values
+		}
+		if !override.ValidationRules.IsZero() {
+			// Declared values replace the detected ones, and are enforced;
+			// an empty list drops the detected values too
+			rules, err := override.ValidationRules.forColumn(col.Type)
+			if err != nil {
+				return nil, fmt.Errorf("schema file: column '%s': %w", override.Name, err)
+			}
+			col.Rules = rules
+			if rules.Enum != nil {
+				col.Domain = nil
+			}
+		}
+	}
+
+	// Renames must not collide with other columns or the generated id column
+	seen := map[string]bool{"id": true}
+	for _, col := range result.Columns {
+		if seen[col.Name] && (col.Name != "id" || col.Source != "") {
+			return nil, fmt.Errorf("schema file: duplicate column name '%s'", col.Name)
+		}
+		seen[col.Name] = true
+	}
+
+	return result, nil
+}
+
+// NewSchemaOverride describes every column of a schema, as a starting point for a schema file
+func NewSchemaOverride(schema *TableSchema) *SchemaOverride {
+	override := &SchemaOverride{Columns: make([]ColumnOverride, len(schema.Columns))}
+	for i, col := range schema.Columns {
+		nullable, index := col.Nullable, col.Index
+		override.Columns[i] = ColumnOverride{
+			Name:     col.SourceName(),
+			Type:     col.Type.String(),
+			Nullable: &nullable,
+			Index:    &index,
+			Check:    col.Check,
+		}
+		if col.Source != "" {
+			override.Columns[i].Rename = col.Name
+		}
+		if col.Rules != nil {
+			override.Columns[i].ValidationRules = *col.Rules
+		}
+		if col.Default != "" {
+			def := col.Default
+			override.Columns[i].Default = &def
+		}
+	}
+	return override
+}
+
+// WriteYAML writes the override as a commented YAML schema file
+func (o *SchemaOverride) WriteYAML(w io.Writer, tableName string) error {
+	fmt.Fprintf(w, "# Schema for table '%s'\n", tableName)
+	fmt.Fprintf(w, "# Edit and pass to load with --schema; columns and fields you remove keep their detected values\n")
+	fmt.Fprintf(w, "# Column fields: type, nullable, index, rename, default, check\n")
+	fmt.Fprintf(w, "# Validation rules: enum, min, max, pattern, not_empty, not_before, not_after\n")
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(o); err != nil {
+		return fmt.Errorf("failed to write schema: %w", err)
+	}
+	return enc.Close()
+}
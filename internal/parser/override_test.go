@@ -0,0 +1,250 @@
+package parser
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestLoadSchemaOverride tests reading YAML and JSON schema files
+func TestLoadSchemaOverride(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []ColumnOverride
+		wantErr string
+	}{
+		{
+			name:    "yaml",
+			content: "columns:\n  - name: zip\n    type: text\n  - name: size\n    rename: size_kb\n    nullable: false\n    default: \"0\"\n",
+			want: []ColumnOverride{
+				{Name: "zip", Type: "text"},
+				{Name: "size", Rename: "size_kb", Nullable: boolPtr(false), Default: stringPtr("0")},
+			},
+		},
+		{
+			name:    "json",
+			content: `{"columns": [{"name": "status", "index": true, "check": "status BETWEEN 100 AND 599"}]}`,
+			want:    []ColumnOverride{{Name: "status", Index: boolPtr(true), Check: "status BETWEEN 100 AND 599"}},
+		},
+		{
+			name:    "validation rules",
+			content: "columns:\n  - name: operation\n    enum: [upload, download]\n  - name: size\n    min: 0\n",
+			want: []ColumnOverride{
+				{Name: "operation", ValidationRules: ValidationRules{Enum: []string{"upload", "download"}}},
+				{Name: "size", ValidationRules: ValidationRules{Min: floatPtr(0)}},
+			},
+		},
+		{name: "empty file", content: ""},
+		{name: "unknown field", content: "columns:\n  - name: zip\n    kind: text\n", wantErr: "field kind not found"},
+		{name: "missing name", content: "columns:\n  - type: text\n", wantErr: "column 1 has no name"},
+		{name: "unknown type", content: "columns:\n  - name: zip\n    type: varchar\n", wantErr: "unknown column type 'varchar'"},
+		{name: "invalid rule", content: "columns:\n  - name: user\n    pattern: \"[a-z\"\n", wantErr: "column 'user': invalid pattern"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "schema.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write schema file: %v", err)
+			}
+
+			override, err := LoadSchemaOverride(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadSchemaOverride() error = %v", err)
+			}
+			if !reflect.DeepEqual(override.Columns, tt.want) {
+				t.Errorf("Columns = %+v, want %+v", override.Columns, tt.want)
+			}
+		})
+	}
+}
+
+// TestSchemaOverrideApply tests applying overrides to a detected schema
+func TestSchemaOverrideApply(t *testing.T) {
+	detected := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "zip", Type: TypeInteger},
+			{Name: "size", Type: TypeInteger, Nullable: true},
+			{Name: "user", Type: TypeText, Index: true},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		columns []ColumnOverride
+		want    []ColumnSchema
+		wantErr string
+	}{
+		{
+			name: "partial override",
+			columns: []ColumnOverride{
+				{Name: "zip", Type: "TEXT"},
+				{Name: "size", Rename: "Size KB", Nullable: boolPtr(false), Default: stringPtr("0"), Check: "size_kb >= 0"},
+				{Name: "user", Index: boolPtr(false)},
+			},
+			want: []ColumnSchema{
+				{Name: "zip", Type: TypeText},
+				{Name: "size_kb", Type: TypeInteger, Source: "size", Default: "0", Check: "size_kb >= 0"},
+				{Name: "user", Type: TypeText},
+			},
+		},
+		{
+			name:    "swap names",
+			columns: []ColumnOverride{{Name: "zip", Rename: "user"}, {Name: "user", Rename: "zip"}},
+			want: []ColumnSchema{
+				{Name: "user", Type: TypeInteger, Source: "zip"},
+				{Name: "size", Type: TypeInteger, Nullable: true},
+				{Name: "zip", Type: TypeText, Index: true, Source: "user"},
+			},
+		},
+		{
+			name:    "validation rules",
+			columns: []ColumnOverride{{Name: "size", ValidationRules: ValidationRules{Min: floatPtr(0)}}},
+			want: []ColumnSchema{
+				{Name: "zip", Type: TypeInteger},
+				{Name: "size", Type: TypeInteger, Nullable: true, Rules: &ValidationRules{Min: floatPtr(0)}},
+				{Name: "user", Type: TypeText, Index: true},
+			},
+		},
+		{
+			name:    "rule for another type",
+			columns: []ColumnOverride{{Name: "user", ValidationRules: ValidationRules{Max: floatPtr(10)}}},
+			wantErr: "column 'user': min and max need an INTEGER or REAL column",
+		},
+		{name: "unknown column", columns: []ColumnOverride{{Name: "zipcode"}}, wantErr: "column 'zipcode' not found"},
+		{name: "duplicate rename", columns: []ColumnOverride{{Name: "zip", Rename: "user"}}, wantErr: "duplicate column name 'user'"},
+		{name: "rename to id", columns: []ColumnOverride{{Name: "zip", Rename: "id"}}, wantErr: "duplicate column name 'id'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			override := &SchemaOverride{Columns: tt.columns}
+			got, err := override.Apply(detected)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !reflect.DeepEqual(got.Columns, tt.want) {
+				t.Errorf("Columns = %+v, want %+v", got.Columns, tt.want)
+			}
+		})
+	}
+
+	// The detected schema itself is left unchanged
+	if detected.Columns[0].Type != TypeInteger || detected.Columns[1].Name != "size" {
+		t.Errorf("Apply() modified the detected schema: %+v", detected.Columns)
+	}
+}
+
+// TestSchemaOverrideApplyCategories tests declaring rules for categorical columns
+func TestSchemaOverrideApplyCategories(t *testing.T) {
+	detected := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "level", Type: TypeText, Index: true, Domain: []string{"error", "info"}},
+			{Name: "method", Type: TypeText, Index: true, Domain: []string{"GET", "POST"}},
+			{Name: "code", Type: TypeText, Domain: []string{"ok"}},
+			{Name: "status", Type: TypeText, Domain: []string{"active"}},
+		},
+	}
+	override := &SchemaOverride{Columns: []ColumnOverride{
+		{Name: "level", ValidationRules: ValidationRules{NotEmpty: true}},
+		{Name: "method", ValidationRules: ValidationRules{Enum: []string{}}},
+		{Name: "code", Type: "integer"},
+		{Name: "status", ValidationRules: ValidationRules{Enum: []string{"active", "closed"}}},
+	}}
+
+	got, err := override.Apply(detected)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	// Other rules keep the detected values without enforcing them, an empty
+	// enum drops them, and so does a type other than TEXT; declared values
+	// replace them and are enforced
+	want := []ColumnSchema{
+		{Name: "level", Type: TypeText, Index: true, Rules: &ValidationRules{NotEmpty: true}, Domain: []string{"error", "info"}},
+		{Name: "method", Type: TypeText, Index: true, Rules: &ValidationRules{Enum: []string{}}},
+		{Name: "code", Type: TypeInteger},
+		{Name: "status", Type: TypeText, Rules: &ValidationRules{Enum: []string{"active", "closed"}}},
+	}
+	if !reflect.DeepEqual(got.Columns, want) {
+		t.Errorf("Columns = %+v, want %+v", got.Columns, want)
+	}
+	for i, enforced := range []bool{false, false, false, true} {
+		if got.Columns[i].EnforcesCategories() != enforced {
+			t.Errorf("Column %s: EnforcesCategories() = %v, want %v", got.Columns[i].Name, !enforced, enforced)
+		}
+	}
+}
+
+// TestSchemaOverrideRoundTrip tests that a dumped schema reads back as the same schema
+func TestSchemaOverrideRoundTrip(t *testing.T) {
+	schema := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "zip", Type: TypeText, Index: true},
+			{Name: "size_kb", Type: TypeInteger, Nullable: true, Source: "size", Default: "0", Check: "size_kb >= 0"},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := NewSchemaOverride(schema).WriteYAML(&buf, "logs"); err != nil {
+		t.Fatalf("WriteYAML() error = %v", err)
+	}
+	if !strings.HasPrefix(buf.String(), "# Schema for table 'logs'") {
+		t.Errorf("Expected a header comment, got:\n%s", buf.String())
+	}
+
+	path := filepath.Join(t.TempDir(), "schema.yaml")
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write schema file: %v", err)
+	}
+	override, err := LoadSchemaOverride(path)
+	if err != nil {
+		t.Fatalf("LoadSchemaOverride() error = %v", err)
+	}
+
+	detected := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "zip", Type: TypeInteger},
+			{Name: "size", Type: TypeText},
+		},
+	}
+	got, err := override.Apply(detected)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if !reflect.DeepEqual(got.Columns, schema.Columns) {
+		t.Errorf("Columns = %+v, want %+v", got.Columns, schema.Columns)
+	}
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
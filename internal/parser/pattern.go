@@ -0,0 +1,296 @@
+// Package parser provides CSV parsing functionality for server log files
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// FormatPattern reads line-oriented logs with a user-defined LinePattern
+const FormatPattern InputFormat = "pattern"
+
+// maxTokenDepth limits how deeply pattern tokens may reference each other
+const maxTokenDepth = 20
+
+// DefaultPatternTokens are the grok-style tokens available to every pattern
+var DefaultPatternTokens = map[string]string{
+	"INT":               `[+-]?\d+`,
+	"NUMBER":            `[+-]?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][+-]?\d+)?`,
+	"WORD":              `\w+`,
+	"NOTSPACE":          `\S+`,
+	"SPACE":             `\s*`,
+	"DATA":              `.*?`,
+	"GREEDYDATA":        `.*`,
+	"QUOTEDSTRING":      `"(?:[^"\\]|\\.)*"`,
+	"UUID":              `[0-9A-Fa-f]{8}-(?:[0-9A-Fa-f]{4}-){3}[0-9A-Fa-f]{12}`,
+	"IPV4":              `(?:\d{1,3}\.){3}\d{1,3}`,
+	"IPV6":              `[0-9A-Fa-f:]*:[0-9A-Fa-f:.]*`,
+	"IP":                `%{IPV6}|%{IPV4}`,
+	"HOSTNAME":          `[0-9A-Za-z](?:[0-9A-Za-z-]*[0-9A-Za-z])?(?:\.[0-9A-Za-z](?:[0-9A-Za-z-]*[0-9A-Za-z])?)*`,
+	"USER":              `[\w.@-]+`,
+	"PATH":              `/[^\s?#]*`,
+	"URIPATHPARAM":      `/[^\s]*`,
+	"LOGLEVEL":          `(?i:trace|debug|info|notice|warn(?:ing)?|error|err|crit(?:ical)?|fatal|severe|alert|emerg(?:ency)?)`,
+	"TIMESTAMP_ISO8601": `\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`,
+	"HTTPDATE":          `\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}`,
+	"SYSLOGTIMESTAMP":   `\w{3} +\d{1,2} \d{2}:\d{2}:\d{2}`,
+}
+
+// patternTypes maps the type names accepted in %{TOKEN:field:type}
+var patternTypes = map[string]ColumnType{
+	"text":      TypeText,
+	"string":    TypeText,
+	"int":       TypeInteger,
+	"integer":   TypeInteger,
+	"float":     TypeReal,
+	"real":      TypeReal,
+	"timestamp": TypeTimestamp,
+	"bool":      TypeBoolean,
+	"boolean":   TypeBoolean,
+}
+
+// tokenReference matches %{TOKEN}, %{TOKEN:field} and %{TOKEN:field:type}
+var tokenReference = regexp.MustCompile(`%\{(\w+)(?::(\w+))?(?::(\w+))?\}`)
+
+// tokenName matches the name of a token defined in a pattern file
+var tokenName = regexp.MustCompile(`^\w+$`)
+
+// LinePattern turns log lines into records using a regular expression whose
+// named capture groups are the columns
+type LinePattern struct {
+	re       *regexp.Regexp
+	columns  []string
+	groups   []int                 // Submatch index of each column
+	declared map[string]ColumnType // Types given as %{TOKEN:field:type}
+}
+
+// CompilePattern compiles a line pattern
+// The pattern is a regular expression in which (?P<name>...) groups become
+// columns. Grok-style references are expanded first: %{TOKEN} inserts the
+// token's expression, %{TOKEN:name} captures it as column name, and
+// %{TOKEN:name:type} also declares the column type (int, float, text,
+// timestamp or bool) instead of inferring it from the values
+// tokens adds to (or overrides) DefaultPatternTokens
+func CompilePattern(pattern string, tokens map[string]string) (*LinePattern, error) {
+	all := make(map[string]string, len(DefaultPatternTokens)+len(tokens))
+	for name, expr := range DefaultPatternTokens {
+		all[name] = expr
+	}
+	for name, expr := range tokens {
+		all[name] = expr
+	}
+
+	declared := make(map[string]ColumnType)
+	expanded, err := expandTokens(pattern, all, declared, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := regexp.Compile(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	lp := &LinePattern{re: re, declared: declared}
+	seen := make(map[string]bool)
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("invalid pattern: column '%s' is captured more than once", name)
+		}
+		seen[name] = true
+		lp.columns = append(lp.columns, name)
+		lp.groups = append(lp.groups, i)
+	}
+
+	if len(lp.columns) == 0 {
+		return nil, fmt.Errorf("invalid pattern: no named capture groups or %%{TOKEN:name} fields")
+	}
+
+	return lp, nil
+}
+
+// expandTokens replaces token references, recording declared column types
+func expandTokens(pattern string, tokens map[string]string, declared map[string]ColumnType, depth int) (string, error) {
+	if depth > maxTokenDepth {
+		return "", fmt.Errorf("invalid pattern: tokens nested more than %d deep (recursive token?)", maxTokenDepth)
+	}
+
+	var expandErr error
+	expanded := tokenReference.ReplaceAllStringFunc(pattern, func(ref string) string {
+		if expandErr != nil {
+			return ""
+		}
+		m := tokenReference.FindStringSubmatch(ref)
+		token, field, typeName := m[1], m[2], m[3]
+
+		expr, ok := tokens[token]
+		if !ok {
+			expandErr = fmt.Errorf("invalid pattern: unknown token '%s'", token)
+			return ""
+		}
+		inner, err := expandTokens(expr, tokens, declared, depth+1)
+		if err != nil {
+			expandErr = err
+			return ""
+		}
+
+		if field == "" {
+			return "(?:" + inner + ")"
+		}
+		if typeName != "" {
+			columnType, ok := patternTypes[strings.ToLower(typeName)]
+			if !ok {
+				expandErr = fmt.Errorf("invalid pattern: unknown type '%s' for field '%s'", typeName, field)
+				return ""
+			}
+			declared[field] = columnType
+		}
+		return "(?P<" + field + ">" + inner + ")"
+	})
+
+	return expanded, expandErr
+}
+
+// LoadPatternTokens reads token definitions from a pattern file
+// Each line is "NAME expression"; blank lines and lines starting with # are ignored
+func LoadPatternTokens(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pattern file: %w", err)
+	}
+	defer file.Close()
+
+	tokens := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, expr, ok := strings.Cut(line, " ")
+		expr = strings.TrimSpace(expr)
+		if !ok || expr == "" || !tokenName.MatchString(name) {
+			return nil, fmt.Errorf("pattern file %s line %d: expected 'NAME expression'", path, lineNumber)
+		}
+		tokens[name] = expr
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pattern file: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// Columns returns the column names captured by the pattern
+func (lp *LinePattern) Columns() []string {
+	return lp.columns
+}
+
+// DeclaredTypes returns the column types declared in the pattern
+func (lp *LinePattern) DeclaredTypes() map[string]ColumnType {
+	return lp.declared
+}
+
+// Match splits a line into the values of the pattern's columns
+// It returns false if the line does not match
+func (lp *LinePattern) Match(line string) ([]string, bool) {
+	m := lp.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+
+	record := make([]string, len(lp.columns))
+	for i, group := range lp.groups {
+		value := m[group]
+		if lp.declared[lp.columns[i]] == TypeTimestamp {
+			value = normalizeLogTimestamp(value)
+		}
+		record[i] = value
+	}
+	return record, true
+}
+
+// normalizeLogTimestamp rewrites timestamps in log-specific layouts (such as
+// the access log [10/Oct/2000:13:55:36 -0700]) as RFC 3339 so they can be stored
+// Other values are returned unchanged
+func normalizeLogTimestamp(value string) string {
+	for _, layout := range []string{accessLogTimeFormat, time.RFC3339Nano, "2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.Format(time.RFC3339)
+		}
+	}
+	return value
+}
+
+// PatternReader streams records from a line-oriented log using a LinePattern
+type PatternReader struct {
+	input   io.ReadCloser
+	reader  *bufio.Reader
+	pattern *LinePattern
+	line    int
+}
+
+// newPatternReader creates a reader that matches every line against pattern
+func newPatternReader(input io.ReadCloser, pattern *LinePattern) (*PatternReader, error) {
+	if pattern == nil {
+		return nil, fmt.Errorf("no line pattern given")
+	}
+	return &PatternReader{input: input, reader: bufio.NewReader(input), pattern: pattern}, nil
+}
+
+// Headers returns the pattern's column names
+func (r *PatternReader) Headers() []string {
+	return r.pattern.Columns()
+}
+
+// DeclaredTypes returns the column types declared in the pattern
+func (r *PatternReader) DeclaredTypes() map[string]ColumnType {
+	return r.pattern.DeclaredTypes()
+}
+
+// Read returns the next matching line as a record, or io.EOF when the input is exhausted
+// Lines that do not match the pattern are returned as a *ParseError
+func (r *PatternReader) Read() ([]string, error) {
+	for {
+		data, err := r.reader.ReadString('\n')
+		if len(data) == 0 && err == io.EOF {
+			return nil, io.EOF
+		}
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading log at line %d: %w", r.line+1, err)
+		}
+		r.line++
+
+		data = strings.TrimRight(data, "\r\n")
+		if strings.TrimSpace(data) == "" {
+			continue
+		}
+
+		record, ok := r.pattern.Match(data)
+		if !ok {
+			return nil, &ParseError{Line: r.line, Err: fmt.Errorf("line does not match the pattern")}
+		}
+		return record, nil
+	}
+}
+
+// Line returns the line number of the most recently read record
+func (r *PatternReader) Line() int {
+	return r.line
+}
+
+// Close releases the underlying file
+func (r *PatternReader) Close() error {
+	return r.input.Close()
+}
@@ -0,0 +1,171 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCompilePattern tests compiling raw and grok-style line patterns
+func TestCompilePattern(t *testing.T) {
+	tests := []struct {
+		name      string
+		pattern   string
+		tokens    map[string]string
+		line      string
+		want      []string
+		wantTypes map[string]ColumnType
+		wantErr   string
+	}{
+		{
+			name:    "named groups",
+			pattern: `^(?P<level>\w+): (?P<message>.*)$`,
+			line:    "ERROR: disk full",
+			want:    []string{"level=ERROR", "message=disk full"},
+		},
+		{
+			name:      "grok tokens with declared types",
+			pattern:   `^%{TIMESTAMP_ISO8601:time:timestamp} %{LOGLEVEL:level} took %{NUMBER:ms:float}ms %{GREEDYDATA}`,
+			line:      "2020-04-12T22:10:38Z info took 12ms for GET /",
+			want:      []string{"time=2020-04-12T22:10:38Z", "level=info", "ms=12"},
+			wantTypes: map[string]ColumnType{"time": TypeTimestamp, "ms": TypeReal},
+		},
+		{
+			name:    "custom tokens referencing built-in ones",
+			pattern: `%{REQ:request} from %{IP:client}`,
+			tokens:  map[string]string{"REQ": `%{WORD} %{PATH}`},
+			line:    "GET /health from 10.0.0.1",
+			want:    []string{"request=GET /health", "client=10.0.0.1"},
+		},
+		{
+			name:    "access log timestamps are normalized",
+			pattern: `\[%{HTTPDATE:time:timestamp}\]`,
+			line:    "[10/Oct/2000:13:55:36 -0700]",
+			want:    []string{"time=2000-10-10T13:55:36-07:00"},
+		},
+		{
+			name:    "unknown token",
+			pattern: `%{NOPE:x}`,
+			wantErr: "unknown token 'NOPE'",
+		},
+		{
+			name:    "unknown type",
+			pattern: `%{INT:x:money}`,
+			wantErr: "unknown type 'money'",
+		},
+		{
+			name:    "recursive token",
+			pattern: `%{LOOP:x}`,
+			tokens:  map[string]string{"LOOP": `a%{LOOP}`},
+			wantErr: "nested more than",
+		},
+		{
+			name:    "duplicate column",
+			pattern: `%{INT:x} %{INT:x}`,
+			wantErr: "captured more than once",
+		},
+		{
+			name:    "no columns",
+			pattern: `%{INT} \w+`,
+			wantErr: "no named capture groups",
+		},
+		{
+			name:    "invalid regex",
+			pattern: `(?P<x>[a-`,
+			wantErr: "invalid pattern",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lp, err := CompilePattern(tt.pattern, tt.tokens)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("CompilePattern() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CompilePattern() unexpected error: %v", err)
+			}
+
+			record, ok := lp.Match(tt.line)
+			if !ok {
+				t.Fatalf("Match(%q) did not match", tt.line)
+			}
+			var got []string
+			for i, column := range lp.Columns() {
+				got = append(got, column+"="+record[i])
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Match() = %v, want %v", got, tt.want)
+			}
+
+			for name, want := range tt.wantTypes {
+				if lp.DeclaredTypes()[name] != want {
+					t.Errorf("Declared type of %s = %v, want %v", name, lp.DeclaredTypes()[name], want)
+				}
+			}
+		})
+	}
+}
+
+// TestLoadPatternTokens tests reading token definitions from a pattern file
+func TestLoadPatternTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "patterns")
+	content := "# Service tokens\nSERVICE [a-z-]+\n\nREQUEST_ID req-%{INT}\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, err := LoadPatternTokens(path)
+	if err != nil {
+		t.Fatalf("LoadPatternTokens() unexpected error: %v", err)
+	}
+	if tokens["SERVICE"] != "[a-z-]+" || tokens["REQUEST_ID"] != "req-%{INT}" || len(tokens) != 2 {
+		t.Errorf("LoadPatternTokens() = %v", tokens)
+	}
+
+	if err := os.WriteFile(path, []byte("JUSTANAME\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPatternTokens(path); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Errorf("LoadPatternTokens() error = %v, want line 1 error", err)
+	}
+}
+
+// TestPatternReader tests streaming a log with a line pattern
+func TestPatternReader(t *testing.T) {
+	lp, err := CompilePattern(`^%{LOGLEVEL:level} %{GREEDYDATA:message}$`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := "INFO started\n\n--- banner ---\nWARN slow request\n"
+	reader, err := NewRecordReader(strings.NewReader(content), ReadOptions{Format: FormatPattern, Pattern: lp})
+	if err != nil {
+		t.Fatalf("NewRecordReader() unexpected error: %v", err)
+	}
+	defer reader.Close()
+
+	if record, err := reader.Read(); err != nil || record[1] != "started" || reader.Line() != 1 {
+		t.Errorf("Read() = %v, %v at line %d", record, err, reader.Line())
+	}
+
+	var parseErr *ParseError
+	if _, err := reader.Read(); !errors.As(err, &parseErr) || parseErr.Line != 3 {
+		t.Errorf("Read() error = %v, want ParseError at line 3", err)
+	}
+
+	if record, err := reader.Read(); err != nil || record[0] != "WARN" || reader.Line() != 4 {
+		t.Errorf("Read() = %v, %v at line %d", record, err, reader.Line())
+	}
+
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("Read() error = %v, want io.EOF", err)
+	}
+}
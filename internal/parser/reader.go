@@ -0,0 +1,172 @@
+// Package parser provides CSV parsing functionality for server log files
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// RecordReader streams records with a fixed set of columns from an input file
+// CSVReader, JSONLReader, AccessLogReader and PatternReader implement it
+type RecordReader interface {
+	// Headers returns the column names of every record
+	Headers() []string
+	// Read returns the next record, or io.EOF when the input is exhausted
+	// A *ParseError (or *csv.ParseError) means only that record is bad
+	Read() ([]string, error)
+	// Line returns the line number of the most recently read record
+	Line() int
+	// Close releases the underlying file
+	Close() error
+}
+
+// ParseError reports a record that could not be parsed
+// Reading can continue with the next record
+type ParseError struct {
+	Line int
+	Err  error
+}
+
+// Error returns the error message including the line number
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// InputFormat identifies the format of an input file
+type InputFormat string
+
+const (
+	FormatAuto  InputFormat = "auto"  // Detect from the file name, then the content
+	FormatCSV   InputFormat = "csv"   // Comma-separated (or other delimiter) values
+	FormatJSONL InputFormat = "jsonl" // One JSON object per line (NDJSON)
+)
+
+// jsonlExtensions are the file extensions of JSON Lines files
+var jsonlExtensions = map[string]bool{
+	".jsonl":  true,
+	".ndjson": true,
+	".json":   true,
+}
+
+// SchemaProvider is implemented by readers whose input format defines the
+// table schema, so no detection from sample values is needed
+type SchemaProvider interface {
+	Schema(tableName string) (*TableSchema, error)
+}
+
+// TypeDeclarer is implemented by readers whose input declares the types of
+// some columns; the other columns are still detected from sample values
+type TypeDeclarer interface {
+	DeclaredTypes() map[string]ColumnType
+}
+
+// ReadOptions describes how input files are parsed
+type ReadOptions struct {
+	Format  InputFormat
+	CSV     CSVOptions   // Dialect of CSV input
+	Pattern *LinePattern // Required for FormatPattern
+}
+
+// ParseInputFormat converts a --format value into an InputFormat
+func ParseInputFormat(value string) (InputFormat, error) {
+	switch format := InputFormat(strings.ToLower(value)); format {
+	case FormatAuto, FormatCSV, FormatJSONL, FormatCommon, FormatCombined, FormatPattern:
+		return format, nil
+	case "ndjson":
+		return FormatJSONL, nil
+	}
+	return "", fmt.Errorf("invalid input format '%s': must be 'csv', 'jsonl', 'common', 'combined', 'pattern' or 'auto'", value)
+}
+
+// IsJSONLFile reports whether a file name has a JSON Lines extension,
+// ignoring any compression extension
+func IsJSONLFile(name string) bool {
+	return jsonlExtensions[strings.ToLower(filepath.Ext(TrimCompressionExtension(name)))]
+}
+
+// OpenRecords opens a file for streaming in the given format
+// In auto mode .jsonl, .ndjson and .json files are read as JSON Lines; other
+// files are read as JSON Lines when their content starts with '{', as an access
+// log when the first line is in the common or combined log format and as CSV otherwise
+func OpenRecords(path string, opts ReadOptions) (RecordReader, error) {
+	file, err := OpenInput(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+
+	if opts.Format == FormatAuto && IsJSONLFile(path) {
+		opts.Format = FormatJSONL
+	}
+
+	reader, err := newRecordReader(file, opts)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// NewRecordReader streams records from r, such as standard input, in the same way as OpenRecords
+// Closing the reader leaves r open
+func NewRecordReader(r io.Reader, opts ReadOptions) (RecordReader, error) {
+	input, err := Decompress(r, "")
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := newRecordReader(input, opts)
+	if err != nil {
+		input.Close()
+		return nil, err
+	}
+
+	return reader, nil
+}
+
+// newRecordReader creates the reader for the format, sniffing the content in auto mode
+func newRecordReader(input io.ReadCloser, opts ReadOptions) (RecordReader, error) {
+	format := opts.Format
+	if format == FormatAuto {
+		buffered := bufio.NewReader(input)
+		format = sniffFormat(buffered)
+		input = &decompressedFile{Reader: buffered, closers: []io.Closer{input}}
+	}
+
+	switch format {
+	case FormatJSONL:
+		return newJSONLReader(input)
+	case FormatCommon, FormatCombined:
+		return newAccessLogReader(input, format)
+	case FormatPattern:
+		return newPatternReader(input, opts.Pattern)
+	}
+	return newCSVReader(input, opts.CSV)
+}
+
+// sniffFormat guesses the format from the start of the input
+func sniffFormat(r *bufio.Reader) InputFormat {
+	peek, _ := r.Peek(4096)
+	peek = bytes.TrimPrefix(peek, []byte("\xef\xbb\xbf")) // UTF-8 byte order mark
+	peek = bytes.TrimLeft(peek, " \t\r\n")
+
+	if len(peek) > 0 && peek[0] == '{' {
+		return FormatJSONL
+	}
+
+	firstLine, _, _ := bytes.Cut(peek, []byte("\n"))
+	if format, ok := looksLikeAccessLog(strings.TrimRight(string(firstLine), "\r")); ok {
+		return format
+	}
+
+	return FormatCSV
+}
@@ -0,0 +1,66 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestOpenRecords tests choosing the reader from the format, file name and content
+func TestOpenRecords(t *testing.T) {
+	const jsonl = `{"timestamp": 1587772800, "username": "jeff22"}` + "\n"
+	const csv = "timestamp,username\n1587772800,jeff22\n"
+
+	tests := []struct {
+		name     string
+		fileName string
+		content  string
+		format   InputFormat
+		wantJSON bool
+	}{
+		{name: "csv by content", fileName: "log.csv", content: csv, format: FormatAuto},
+		{name: "jsonl by extension", fileName: "log.jsonl", content: jsonl, format: FormatAuto, wantJSON: true},
+		{name: "jsonl by content", fileName: "log.txt", content: "\n  " + jsonl, format: FormatAuto, wantJSON: true},
+		{name: "forced csv", fileName: "log.jsonl", content: csv, format: FormatCSV},
+		{name: "forced jsonl", fileName: "log.csv", content: jsonl, format: FormatJSONL, wantJSON: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.fileName)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := OpenRecords(path, ReadOptions{Format: tt.format})
+			if err != nil {
+				t.Fatalf("OpenRecords() unexpected error: %v", err)
+			}
+			defer reader.Close()
+
+			if _, isJSON := reader.(*JSONLReader); isJSON != tt.wantJSON {
+				t.Errorf("OpenRecords() returned %T, want JSON Lines reader %t", reader, tt.wantJSON)
+			}
+			if got := strings.Join(reader.Headers(), ","); got != "timestamp,username" {
+				t.Errorf("Headers() = %s, want timestamp,username", got)
+			}
+			record, err := reader.Read()
+			if err != nil || record[1] != "jeff22" {
+				t.Errorf("Read() = %v, %v, want jeff22 record", record, err)
+			}
+		})
+	}
+}
+
+// TestParseInputFormat tests parsing --format values
+func TestParseInputFormat(t *testing.T) {
+	for value, want := range map[string]InputFormat{"auto": FormatAuto, "CSV": FormatCSV, "jsonl": FormatJSONL, "ndjson": FormatJSONL} {
+		if got, err := ParseInputFormat(value); err != nil || got != want {
+			t.Errorf("ParseInputFormat(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	if _, err := ParseInputFormat("xml"); err == nil {
+		t.Error("ParseInputFormat(\"xml\") expected error")
+	}
+}
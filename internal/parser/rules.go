@@ -0,0 +1,207 @@
+// Package parser provides CSV parsing functionality for server log files
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValidationRules declares the values a column accepts
+// Rules are set per column in a schema file and checked for every value while
+// loading; enums, ranges, non-empty and timestamp windows are also compiled
+// into a CHECK constraint of the column (see CheckSQL). An empty value passes
+// every rule but not_empty, so optional columns stay optional
+type ValidationRules struct {
+	Enum      []string `yaml:"enum,omitempty" json:"enum,omitempty"`             // Allowed values
+	Min       *float64 `yaml:"min,omitempty" json:"min,omitempty"`               // Smallest number allowed
+	Max       *float64 `yaml:"max,omitempty" json:"max,omitempty"`               // Largest number allowed
+	Pattern   string   `yaml:"pattern,omitempty" json:"pattern,omitempty"`       // Regular expression values must match
+	NotEmpty  bool     `yaml:"not_empty,omitempty" json:"not_empty,omitempty"`   // Reject empty and blank values
+	NotBefore string   `yaml:"not_before,omitempty" json:"not_before,omitempty"` // Earliest timestamp allowed
+	NotAfter  string   `yaml:"not_after,omitempty" json:"not_after,omitempty"`   // Latest timestamp allowed
+
+	pattern   *regexp.Regexp
+	notBefore time.Time
+	notAfter  time.Time
+}
+
+// ruleTimeFormats are the formats accepted for not_before and not_after
+// Times without a zone are UTC
+var ruleTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// sqliteTimeFormat is the format SQLite's datetime() returns
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// IsZero reports whether no rule is set
+// An empty, non-nil enum is set: it clears the detected categories of a column
+func (r *ValidationRules) IsZero() bool {
+	return r.Enum == nil && r.Min == nil && r.Max == nil && r.Pattern == "" &&
+		!r.NotEmpty && r.NotBefore == "" && r.NotAfter == ""
+}
+
+// compile parses the pattern and the timestamp window and checks that the bounds make sense
+func (r *ValidationRules) compile() error {
+	if r.Min != nil && r.Max != nil && *r.Min > *r.Max {
+		return fmt.Errorf("min %s is greater than max %s", formatNumber(*r.Min), formatNumber(*r.Max))
+	}
+
+	if r.Pattern != "" {
+		re, err := regexp.Compile(r.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		r.pattern = re
+	}
+
+	var err error
+	if r.NotBefore != "" {
+		if r.notBefore, err = parseRuleTime(r.NotBefore); err != nil {
+			return fmt.Errorf("invalid not_before: %w", err)
+		}
+	}
+	if r.NotAfter != "" {
+		if r.notAfter, err = parseRuleTime(r.NotAfter); err != nil {
+			return fmt.Errorf("invalid not_after: %w", err)
+		}
+	}
+	if r.NotBefore != "" && r.NotAfter != "" && r.notAfter.Before(r.notBefore) {
+		return fmt.Errorf("not_after %s is before not_before %s", r.NotAfter, r.NotBefore)
+	}
+	return nil
+}
+
+// forColumn returns a compiled copy of the rules for a column of the given type
+// Ranges only apply to numbers and windows only to timestamps
+func (r ValidationRules) forColumn(columnType ColumnType) (*ValidationRules, error) {
+	if (r.Min != nil || r.Max != nil) && columnType != TypeInteger && columnType != TypeReal {
+		return nil, fmt.Errorf("min and max need an INTEGER or REAL column, not %s", columnType)
+	}
+	if (r.NotBefore != "" || r.NotAfter != "") && columnType != TypeTimestamp {
+		return nil, fmt.Errorf("not_before and not_after need a TIMESTAMP column, not %s", columnType)
+	}
+	if err := r.compile(); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// parseRuleTime parses a not_before or not_after time
+func parseRuleTime(value string) (time.Time, error) {
+	for _, format := range ruleTimeFormats {
+		if t, err := time.Parse(format, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("'%s' is not a timestamp like '2006-01-02' or '2006-01-02 15:04:05'", value)
+}
+
+// Validate checks one value of the column against the rules
+// raw is the value as read, after the column default was applied, and value
+// its converted form (int64, float64, time.Time, ...), nil when raw is empty
+func (r *ValidationRules) Validate(raw string, value interface{}) error {
+	if strings.TrimSpace(raw) == "" {
+		if r.NotEmpty {
+			return fmt.Errorf("value is empty")
+		}
+		if raw == "" {
+			return nil
+		}
+	}
+
+	if len(r.Enum) > 0 && !slices.Contains(r.Enum, raw) {
+		return fmt.Errorf("'%s' is not one of %s", raw, strings.Join(r.Enum, ", "))
+	}
+
+	if r.Min != nil || r.Max != nil {
+		if number, ok := toFloat(value); ok {
+			if r.Min != nil && number < *r.Min {
+				return fmt.Errorf("%s is less than the minimum %s", raw, formatNumber(*r.Min))
+			}
+			if r.Max != nil && number > *r.Max {
+				return fmt.Errorf("%s is greater than the maximum %s", raw, formatNumber(*r.Max))
+			}
+		}
+	}
+
+	if r.pattern != nil && !r.pattern.MatchString(raw) {
+		return fmt.Errorf("'%s' does not match the pattern %s", raw, r.Pattern)
+	}
+
+	if t, ok := value.(time.Time); ok {
+		if r.NotBefore != "" && t.Before(r.notBefore) {
+			return fmt.Errorf("%s is before %s", raw, r.NotBefore)
+		}
+		if r.NotAfter != "" && t.After(r.notAfter) {
+			return fmt.Errorf("%s is after %s", raw, r.NotAfter)
+		}
+	}
+	return nil
+}
+
+// CheckSQL returns the rules that SQL can express as a CHECK constraint
+// expression on the column, or "" if there are none. Patterns have no SQLite
+// equivalent and are only checked while loading, as are enums of timestamp and
+// boolean columns, whose stored form differs from the values in the file
+func (r *ValidationRules) CheckSQL(column string, columnType ColumnType) string {
+	var conditions []string
+
+	if r.NotEmpty {
+		if columnType == TypeText {
+			conditions = append(conditions, fmt.Sprintf("%s IS NOT NULL AND trim(%s) <> ''", column, column))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("%s IS NOT NULL", column))
+		}
+	}
+
+	if len(r.Enum) > 0 && columnType != TypeTimestamp && columnType != TypeBoolean {
+		values := make([]string, len(r.Enum))
+		for i, value := range r.Enum {
+			values[i] = sqlLiteral(value, columnType)
+		}
+		conditions = append(conditions, fmt.Sprintf("%s IN (%s)", column, strings.Join(values, ", ")))
+	}
+
+	if r.Min != nil {
+		conditions = append(conditions, fmt.Sprintf("%s >= %s", column, formatNumber(*r.Min)))
+	}
+	if r.Max != nil {
+		conditions = append(conditions, fmt.Sprintf("%s <= %s", column, formatNumber(*r.Max)))
+	}
+
+	// Timestamps are stored in UTC; datetime() drops their fractional seconds
+	if r.NotBefore != "" {
+		conditions = append(conditions, fmt.Sprintf("datetime(%s) >= '%s'", column, r.notBefore.UTC().Format(sqliteTimeFormat)))
+	}
+	if r.NotAfter != "" {
+		conditions = append(conditions, fmt.Sprintf("datetime(%s) <= '%s'", column, r.notAfter.UTC().Format(sqliteTimeFormat)))
+	}
+
+	return strings.Join(conditions, " AND ")
+}
+
+// toFloat returns a converted numeric value as a float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// formatNumber formats a rule bound without a trailing .0 or exponent where possible
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
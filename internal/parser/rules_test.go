@@ -0,0 +1,127 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestValidationRulesValidate tests checking values against each kind of rule
+func TestValidationRulesValidate(t *testing.T) {
+	zero, hundred := 0.0, 100.0
+
+	tests := []struct {
+		name       string
+		rules      ValidationRules
+		columnType ColumnType
+		raw        string
+		value      interface{}
+		wantErr    string
+	}{
+		{"enum match", ValidationRules{Enum: []string{"upload", "download"}}, TypeText, "upload", "upload", ""},
+		{"enum mismatch", ValidationRules{Enum: []string{"upload", "download"}}, TypeText, "delete", "delete", "'delete' is not one of upload, download"},
+		{"empty passes", ValidationRules{Enum: []string{"upload"}}, TypeText, "", nil, ""},
+		{"not empty", ValidationRules{NotEmpty: true}, TypeText, "", nil, "value is empty"},
+		{"blank", ValidationRules{NotEmpty: true}, TypeText, "  ", "  ", "value is empty"},
+		{"below min", ValidationRules{Min: &zero}, TypeInteger, "-5", -5, "-5 is less than the minimum 0"},
+		{"above max", ValidationRules{Max: &hundred}, TypeReal, "100.5", 100.5, "100.5 is greater than the maximum 100"},
+		{"in range", ValidationRules{Min: &zero, Max: &hundred}, TypeInteger, "42", int64(42), ""},
+		{"pattern match", ValidationRules{Pattern: `^[a-z]+\d*$`}, TypeText, "jeff22", "jeff22", ""},
+		{"pattern mismatch", ValidationRules{Pattern: `^[a-z]+\d*$`}, TypeText, "Jeff", "Jeff", "does not match the pattern"},
+		{
+			"before window", ValidationRules{NotBefore: "2020-01-01"}, TypeTimestamp,
+			"1546300800", time.Unix(1546300800, 0), "1546300800 is before 2020-01-01",
+		},
+		{
+			"after window", ValidationRules{NotAfter: "2020-12-31 23:59:59"}, TypeTimestamp,
+			"2021-01-01", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), "2021-01-01 is after 2020-12-31 23:59:59",
+		},
+		{
+			"in window", ValidationRules{NotBefore: "2020-01-01", NotAfter: "2020-12-31"}, TypeTimestamp,
+			"1587772800", time.Unix(1587772800, 0), "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := tt.rules.forColumn(tt.columnType)
+			if err != nil {
+				t.Fatalf("forColumn() error = %v", err)
+			}
+			err = rules.Validate(tt.raw, tt.value)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestValidationRulesForColumn tests rejecting rules that do not fit the column
+func TestValidationRulesForColumn(t *testing.T) {
+	one, two := 1.0, 2.0
+
+	tests := []struct {
+		name       string
+		rules      ValidationRules
+		columnType ColumnType
+		wantErr    string
+	}{
+		{"range on text", ValidationRules{Min: &one}, TypeText, "min and max need an INTEGER or REAL column"},
+		{"window on integer", ValidationRules{NotAfter: "2020-01-01"}, TypeInteger, "need a TIMESTAMP column"},
+		{"min above max", ValidationRules{Min: &two, Max: &one}, TypeInteger, "min 2 is greater than max 1"},
+		{"bad pattern", ValidationRules{Pattern: "("}, TypeText, "invalid pattern"},
+		{"bad time", ValidationRules{NotBefore: "yesterday"}, TypeTimestamp, "invalid not_before"},
+		{"empty window", ValidationRules{NotBefore: "2021-01-01", NotAfter: "2020-01-01"}, TypeTimestamp, "is before not_before"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.rules.forColumn(tt.columnType)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// TestValidationRulesCheckSQL tests compiling rules into CHECK expressions
+func TestValidationRulesCheckSQL(t *testing.T) {
+	zero, max := 0.0, 1.5
+
+	tests := []struct {
+		name       string
+		rules      ValidationRules
+		columnType ColumnType
+		want       string
+	}{
+		{"text enum", ValidationRules{Enum: []string{"upload", "it's"}}, TypeText, "operation IN ('upload', 'it''s')"},
+		{"integer enum", ValidationRules{Enum: []string{"200", "404"}}, TypeInteger, "operation IN (200, 404)"},
+		{"range", ValidationRules{Min: &zero, Max: &max}, TypeReal, "operation >= 0 AND operation <= 1.5"},
+		{"not empty text", ValidationRules{NotEmpty: true}, TypeText, "operation IS NOT NULL AND trim(operation) <> ''"},
+		{"not empty integer", ValidationRules{NotEmpty: true}, TypeInteger, "operation IS NOT NULL"},
+		{
+			"window", ValidationRules{NotBefore: "2020-01-01T02:00:00+02:00", NotAfter: "2020-12-31"}, TypeTimestamp,
+			"datetime(operation) >= '2020-01-01 00:00:00' AND datetime(operation) <= '2020-12-31 00:00:00'",
+		},
+		{"pattern only", ValidationRules{Pattern: "^[a-z]+$"}, TypeText, ""},
+		{"timestamp enum", ValidationRules{Enum: []string{"2020-01-01"}}, TypeTimestamp, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := tt.rules.forColumn(tt.columnType)
+			if err != nil {
+				t.Fatalf("forColumn() error = %v", err)
+			}
+			if got := rules.CheckSQL("operation", tt.columnType); got != tt.want {
+				t.Errorf("CheckSQL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
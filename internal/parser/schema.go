@@ -3,9 +3,12 @@ package parser
 
 import (
 	"fmt"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
 
 	"server-log-analyzer/internal/config"
 )
@@ -55,10 +58,16 @@ func (ct ColumnType) SQLType() string {
 
 // ColumnSchema represents the schema for a single column
 type ColumnSchema struct {
-	Name     string
-	Type     ColumnType
-	Nullable bool
-	Index    bool // Whether to create an index on this column
+	Name      string
+	Type      ColumnType
+	Nullable  bool
+	Index     bool             // Whether to create an index on this column
+	Source    string           // Input column the values come from, when the column was renamed
+	Default   string           // Value stored when the input value is empty ("" = none)
+	Check     string           // SQL expression for a CHECK constraint ("" = none)
+	Rules     *ValidationRules // Checked for each value while loading (nil = none)
+	Domain    []string         // Values of a categorical column seen in the sample (nil = not categorical)
+	Inference *ColumnInference // How the type was inferred from the sample (nil = not inferred)
 }
 
 // TableSchema represents the complete schema for a table
@@ -97,39 +106,63 @@ func DetectSchema(headers []string, records [][]string, tableName string) (*Tabl
 	sampleSize := min(len(records), config.SchemaDetectionSampleSize)
 
 	for i := range schema.Columns {
-		detectedType := detectColumnType(records, i, sampleSize)
+		// Empty values are stored as NULL, so columns with any must allow NULL
+		inference := inferColumn(records, i, sampleSize)
+		detectedType := inference.Type()
 		schema.Columns[i].Type = detectedType
+		schema.Columns[i].Nullable = inference.Empty > 0
+		schema.Columns[i].Inference = inference
+
+		// Categorical columns are worth indexing; the values seen are only a
+		// hint, as the rest of the input may hold others
+		if detectedType == TypeText {
+			if values := detectCategories(records, i, sampleSize); values != nil {
+				schema.Columns[i].Domain = values
+				schema.Columns[i].Index = true
+			}
+		}
 	}
 
 	return schema, nil
 }
 
-// detectColumnType analyzes values in a column to determine the most appropriate data type
-func detectColumnType(records [][]string, columnIndex int, sampleSize int) ColumnType {
-	if len(records) == 0 || columnIndex >= len(records[0]) {
-		return TypeText
-	}
-
-	typeVotes := make(map[ColumnType]int)
-	totalValues := 0
+// categoryValue matches the values of categorical columns: words such as
+// upload, GET or not-found. Values with digits or punctuation are more likely
+// names or identifiers, whose set grows with the data
+var categoryValue = regexp.MustCompile(`^[A-Za-z][A-Za-z_-]*$`)
 
+// detectCategories returns the sorted distinct values of a categorical column,
+// or nil if the sampled values do not look like a fixed set of categories
+func detectCategories(records [][]string, columnIndex int, sampleSize int) []string {
+	seen := make(map[string]bool)
+	total := 0
 	for i := 0; i < sampleSize && i < len(records); i++ {
 		if columnIndex >= len(records[i]) {
 			continue
 		}
-
 		value := strings.TrimSpace(records[i][columnIndex])
 		if value == "" {
 			continue
 		}
-
-		detectedType := inferValueType(value)
-		typeVotes[detectedType]++
-		totalValues++
+		if !categoryValue.MatchString(value) {
+			return nil
+		}
+		seen[value] = true
+		if len(seen) > config.MaxCategoricalValues {
+			return nil
+		}
+		total++
 	}
 
-	// Return the most common type if it meets the threshold
-	return getMostCommonType(typeVotes, totalValues)
+	if total < config.CategoricalMinSamples {
+		return nil
+	}
+	values := make([]string, 0, len(seen))
+	for value := range seen {
+		values = append(values, value)
+	}
+	slices.Sort(values)
+	return values
 }
 
 // inferValueType examines a single value and returns the most specific type it could represent
@@ -161,7 +194,7 @@ func inferValueType(value string) ColumnType {
 	return TypeText
 }
 
-// isTimestamp checks if a value looks like a timestamp in various common formats
+// isTimestamp checks if a value looks like a timestamp in one of the formats ParseTimestamp reads
 func isTimestamp(value string) bool {
 	// Try UNIX timestamp first (most common in log files)
 	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
@@ -172,28 +205,11 @@ func isTimestamp(value string) bool {
 			return true
 		}
 		// Handle millisecond timestamps (13 digits)
-		if timestamp >= 315532800000 && timestamp <= 2524608000000 {
-			return true
-		}
-	}
-
-	timestampFormats := []string{
-		time.RFC3339,
-		"2006-01-02 15:04:05",
-		"2006-01-02T15:04:05",
-		"2006-01-02 15:04:05.000",
-		"01/02/2006 15:04:05",
-		"2006-01-02",
-		"Mon Jan 2 15:04:05 MST 2006", // Current parser format
-		"Mon Jan 2 15:04:05 2006",
+		return timestamp >= 315532800000 && timestamp <= 2524608000000
 	}
 
-	for _, format := range timestampFormats {
-		if _, err := time.Parse(format, value); err == nil {
-			return true
-		}
-	}
-	return false
+	_, err := ParseTimestamp(value, time.UTC)
+	return err == nil
 }
 
 // isBoolean checks if a value represents a boolean
@@ -204,31 +220,6 @@ func isBoolean(value string) bool {
 		   lower == "y" || lower == "n"
 }
 
-// getMostCommonType returns the most frequently detected type if it meets the confidence threshold
-func getMostCommonType(votes map[ColumnType]int, totalValues int) ColumnType {
-	if totalValues == 0 {
-		return TypeText
-	}
-
-	maxVotes := 0
-	commonType := TypeText
-
-	for cType, count := range votes {
-		if count > maxVotes {
-			maxVotes = count
-			commonType = cType
-		}
-	}
-
-	// Only use the detected type if it meets the confidence threshold
-	confidence := float64(maxVotes) / float64(totalValues)
-	if confidence >= config.TypeInferenceThreshold {
-		return commonType
-	}
-
-	return TypeText
-}
-
 // sanitizeColumnName cleans up column names to be SQL-safe
 func sanitizeColumnName(name string) string {
 	// Replace spaces and special characters with underscores
@@ -238,8 +229,14 @@ func sanitizeColumnName(name string) string {
 	name = strings.ReplaceAll(name, "/", "_")
 	name = strings.ReplaceAll(name, "\\", "_")
 
-	// Remove other problematic characters
+	// Remove other problematic characters, such as quotes and parentheses
 	name = strings.ToLower(name)
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, name)
 
 	// Ensure it doesn't start with a number
 	if len(name) > 0 && name[0] >= '0' && name[0] <= '9' {
@@ -266,6 +263,11 @@ func shouldIndex(columnName string) bool {
 		}
 	}
 
+	// User agents are long free text nobody filters by equality
+	if strings.HasSuffix(lower, "user_agent") || strings.HasSuffix(lower, "useragent") {
+		return false
+	}
+
 	// Suffix/prefix patterns
 	if strings.HasSuffix(lower, "_id") || strings.HasPrefix(lower, "id_") {
 		return true
@@ -297,6 +299,183 @@ func min(a, b int) int {
 	return b
 }
 
+// ColumnNames returns the names of the schema columns in order
+func (ts *TableSchema) ColumnNames() []string {
+	names := make([]string, len(ts.Columns))
+	for i, col := range ts.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// Column returns the column with the given name, or nil if the schema has none
+func (ts *TableSchema) Column(name string) *ColumnSchema {
+	for i := range ts.Columns {
+		if ts.Columns[i].Name == name {
+			return &ts.Columns[i]
+		}
+	}
+	return nil
+}
+
+// sourceColumn returns the column whose values come from the named input column
+func (ts *TableSchema) sourceColumn(name string) *ColumnSchema {
+	for i := range ts.Columns {
+		if ts.Columns[i].SourceName() == name {
+			return &ts.Columns[i]
+		}
+	}
+	return nil
+}
+
+// SourceName returns the name of the input column the values come from
+func (col ColumnSchema) SourceName() string {
+	if col.Source != "" {
+		return col.Source
+	}
+	return col.Name
+}
+
+// ApplyColumnTypes overrides the types of the named columns, for example with
+// types declared in a line pattern; names are matched after sanitizing
+func (ts *TableSchema) ApplyColumnTypes(types map[string]ColumnType) {
+	for name, columnType := range types {
+		if col := ts.Column(sanitizeColumnName(name)); col != nil {
+			if columnType != col.Type {
+				col.Domain = nil // Detected categories are TEXT values
+			}
+			col.Type = columnType
+			col.Inference = nil
+		}
+	}
+}
+
+// Categories returns the values of a categorical column: those a schema file
+// declares with enum, else those detected in the sample, or nil if there are none
+func (col ColumnSchema) Categories() []string {
+	if col.Rules != nil && col.Rules.Enum != nil {
+		return col.Rules.Enum
+	}
+	return col.Domain
+}
+
+// EnforcesCategories reports whether the values of the column are restricted
+// to its categories: those declared with enum or by EnforceCategories
+func (col ColumnSchema) EnforcesCategories() bool {
+	return col.Rules != nil && len(col.Rules.Enum) > 0
+}
+
+// EnforceCategories restricts each categorical column to the values detected
+// in the sample, as if they were declared with enum: they become a CHECK
+// constraint and records with another value are rejected. Declared rules are
+// kept, and a declared enum wins over the detected values
+func (ts *TableSchema) EnforceCategories() {
+	for i := range ts.Columns {
+		col := &ts.Columns[i]
+		if col.Domain == nil || col.EnforcesCategories() {
+			continue
+		}
+		rules := ValidationRules{}
+		if col.Rules != nil {
+			rules = *col.Rules
+		}
+		rules.Enum = col.Domain
+		col.Rules = &rules
+		col.Domain = nil
+	}
+}
+
+// ForHeaders returns a copy of the schema with its columns ordered to match
+// the given CSV headers, so records from a file whose columns are in a
+// different order can be converted and inserted by position
+func (ts *TableSchema) ForHeaders(headers []string) (*TableSchema, error) {
+	if len(headers) != len(ts.Columns) {
+		return nil, fmt.Errorf("expected %d columns, got %d", len(ts.Columns), len(headers))
+	}
+
+	ordered := &TableSchema{
+		Name:    ts.Name,
+		Columns: make([]ColumnSchema, len(headers)),
+	}
+	for i, header := range headers {
+		col := ts.sourceColumn(sanitizeColumnName(header))
+		if col == nil {
+			return nil, fmt.Errorf("unexpected column '%s'", header)
+		}
+		ordered.Columns[i] = *col
+	}
+
+	return ordered, nil
+}
+
+// MergeSchemas reconciles two schemas detected from files that are loaded into the same table
+// Both must have the same set of columns (in any order). The type of a column inferred in
+// both is inferred again from the combined samples; otherwise, where the types differ, the
+// column is widened to a type that can hold both (see WidenType)
+func MergeSchemas(base, other *TableSchema) (*TableSchema, error) {
+	if len(base.Columns) != len(other.Columns) {
+		return nil, fmt.Errorf("column count differs: %d vs %d (%s vs %s)",
+			len(base.Columns), len(other.Columns),
+			strings.Join(base.ColumnNames(), ","), strings.Join(other.ColumnNames(), ","))
+	}
+
+	merged := &TableSchema{
+		Name:    base.Name,
+		Columns: make([]ColumnSchema, len(base.Columns)),
+	}
+	copy(merged.Columns, base.Columns)
+
+	for i := range merged.Columns {
+		col := &merged.Columns[i]
+		otherCol := other.Column(col.Name)
+		if otherCol == nil {
+			return nil, fmt.Errorf("column '%s' is missing (%s vs %s)", col.Name,
+				strings.Join(base.ColumnNames(), ","), strings.Join(other.ColumnNames(), ","))
+		}
+
+		if col.Inference != nil && otherCol.Inference != nil {
+			col.Inference = col.Inference.merge(otherCol.Inference)
+			col.Type = col.Inference.Type()
+		} else {
+			col.Inference = nil
+			col.Type = WidenType(col.Type, otherCol.Type)
+		}
+		col.Nullable = col.Nullable || otherCol.Nullable
+		col.Index = col.Index || otherCol.Index
+		col.Domain = mergeCategories(col, otherCol)
+	}
+
+	return merged, nil
+}
+
+// mergeCategories returns the detected categories of a column of two files:
+// the union of their values, or nil if either file's column is not categorical
+// or the union has too many values to be a set of categories
+func mergeCategories(a, b *ColumnSchema) []string {
+	if a.Domain == nil || b.Domain == nil || a.Type != TypeText {
+		return nil
+	}
+	values := slices.Concat(a.Domain, b.Domain)
+	slices.Sort(values)
+	values = slices.Compact(values)
+	if len(values) > config.MaxCategoricalValues {
+		return nil
+	}
+	return values
+}
+
+// WidenType returns the narrowest type able to store values of both types
+// INTEGER widens to REAL; any other disagreement falls back to TEXT
+func WidenType(a, b ColumnType) ColumnType {
+	if a == b {
+		return a
+	}
+	if (a == TypeInteger && b == TypeReal) || (a == TypeReal && b == TypeInteger) {
+		return TypeReal
+	}
+	return TypeText
+}
+
 // GenerateCreateTableSQL generates the SQL CREATE TABLE statement for the detected schema
 func (ts *TableSchema) GenerateCreateTableSQL() string {
 	var columns []string
@@ -305,11 +484,7 @@ func (ts *TableSchema) GenerateCreateTableSQL() string {
 	columns = append(columns, "id INTEGER PRIMARY KEY AUTOINCREMENT")
 
 	for _, col := range ts.Columns {
-		colDef := fmt.Sprintf("%s %s", col.Name, col.Type.SQLType())
-		if !col.Nullable {
-			colDef += " NOT NULL"
-		}
-		columns = append(columns, colDef)
+		columns = append(columns, col.SQLDefinition())
 	}
 
 	return fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n  %s\n)",
@@ -317,6 +492,37 @@ func (ts *TableSchema) GenerateCreateTableSQL() string {
 		strings.Join(columns, ",\n  "))
 }
 
+// SQLDefinition returns the column definition used in CREATE TABLE and ALTER TABLE ADD COLUMN
+func (col ColumnSchema) SQLDefinition() string {
+	colDef := fmt.Sprintf("%s %s", col.Name, col.Type.SQLType())
+	if !col.Nullable {
+		colDef += " NOT NULL"
+	}
+	if col.Default != "" {
+		colDef += " DEFAULT " + sqlLiteral(col.Default, col.Type)
+	}
+	if col.Check != "" {
+		colDef += fmt.Sprintf(" CHECK (%s)", col.Check)
+	}
+	if col.Rules != nil {
+		if check := col.Rules.CheckSQL(col.Name, col.Type); check != "" {
+			colDef += fmt.Sprintf(" CHECK (%s)", check)
+		}
+	}
+	return colDef
+}
+
+// sqlLiteral formats a default value as a SQL literal for the column type
+// Numbers are written as is for numeric columns; everything else is quoted
+func sqlLiteral(value string, columnType ColumnType) string {
+	if columnType == TypeInteger || columnType == TypeReal {
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value
+		}
+	}
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
 // GenerateIndexSQL generates the SQL statements to create indexes for marked columns
 func (ts *TableSchema) GenerateIndexSQL() []string {
 	var indexStatements []string
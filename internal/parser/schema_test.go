@@ -194,6 +194,9 @@ func TestSanitizeColumnName(t *testing.T) {
 		{"", "unnamed_column"},
 		{"HTTP-Code", "http_code"},
 		{"Response.Time", "response_time"},
+		{`say "hi"`, "say__hi_"},
+		{"size(kb)", "size_kb_"},
+		{"größe", "größe"},
 	}
 
 	for _, tt := range tests {
@@ -225,6 +228,8 @@ func TestShouldIndex(t *testing.T) {
 		{"message", false},
 		{"size", false},
 		{"value", false},
+		{"user_agent", false},
+		{"http_user_agent", false},
 	}
 
 	for _, tt := range tests {
@@ -265,6 +270,31 @@ func TestGenerateCreateTableSQL(t *testing.T) {
 	}
 }
 
+// TestGenerateCreateTableSQLConstraints tests DEFAULT and CHECK column constraints
+func TestGenerateCreateTableSQLConstraints(t *testing.T) {
+	schema := &TableSchema{
+		Name: "test_table",
+		Columns: []ColumnSchema{
+			{Name: "retries", Type: TypeInteger, Default: "0", Check: "retries >= 0"},
+			{Name: "region", Type: TypeText, Nullable: true, Default: "o'hare"},
+			{Name: "code", Type: TypeInteger, Default: "n/a"},
+		},
+	}
+
+	sql := schema.GenerateCreateTableSQL()
+
+	expectedParts := []string{
+		"retries INTEGER NOT NULL DEFAULT 0 CHECK (retries >= 0)",
+		"region TEXT DEFAULT 'o''hare'",
+		"code INTEGER NOT NULL DEFAULT 'n/a'",
+	}
+	for _, part := range expectedParts {
+		if !strings.Contains(sql, part) {
+			t.Errorf("Generated SQL missing expected part: %q\nSQL: %s", part, sql)
+		}
+	}
+}
+
 func TestGenerateIndexSQL(t *testing.T) {
 	schema := &TableSchema{
 		Name: "test_table",
@@ -321,6 +351,234 @@ func TestContainsHelper(t *testing.T) {
 	}
 }
 
+// TestDetectSchemaNullable tests that columns with empty sampled values allow NULL
+func TestDetectSchemaNullable(t *testing.T) {
+	headers := []string{"username", "size", "comment"}
+	records := [][]string{
+		{"user1", "100", ""},
+		{"user2", "", "retried"},
+		{"user3", "50"}, // Missing trailing field
+	}
+
+	schema, err := DetectSchema(headers, records, "logs")
+	if err != nil {
+		t.Fatalf("DetectSchema() error = %v", err)
+	}
+
+	want := map[string]bool{"username": false, "size": true, "comment": true}
+	for _, col := range schema.Columns {
+		if col.Nullable != want[col.Name] {
+			t.Errorf("Column %s nullable = %t, want %t", col.Name, col.Nullable, want[col.Name])
+		}
+	}
+	if schema.Column("size").Type != TypeInteger {
+		t.Errorf("Empty values should not affect type detection, got %v", schema.Column("size").Type)
+	}
+}
+
+// TestMergeSchemas tests reconciling schemas detected from several files
+func TestMergeSchemas(t *testing.T) {
+	base := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "username", Type: TypeText, Index: true},
+			{Name: "size", Type: TypeInteger},
+			{Name: "timestamp", Type: TypeTimestamp, Index: true},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		other     *TableSchema
+		wantTypes []ColumnType
+		wantErr   string
+	}{
+		{
+			name: "same columns in another order with wider types",
+			other: &TableSchema{Name: "logs", Columns: []ColumnSchema{
+				{Name: "timestamp", Type: TypeText},
+				{Name: "size", Type: TypeReal},
+				{Name: "username", Type: TypeText},
+			}},
+			wantTypes: []ColumnType{TypeText, TypeReal, TypeText},
+		},
+		{
+			name: "missing column",
+			other: &TableSchema{Name: "logs", Columns: []ColumnSchema{
+				{Name: "username", Type: TypeText},
+				{Name: "size", Type: TypeInteger},
+				{Name: "region", Type: TypeText},
+			}},
+			wantErr: "column 'timestamp' is missing",
+		},
+		{
+			name: "different column count",
+			other: &TableSchema{Name: "logs", Columns: []ColumnSchema{
+				{Name: "username", Type: TypeText},
+			}},
+			wantErr: "column count differs",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeSchemas(base, tt.other)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("MergeSchemas() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MergeSchemas() unexpected error: %v", err)
+			}
+
+			for i, col := range merged.Columns {
+				if col.Type != tt.wantTypes[i] {
+					t.Errorf("Column %s type = %v, want %v", col.Name, col.Type, tt.wantTypes[i])
+				}
+			}
+			if !merged.Columns[0].Index {
+				t.Error("Expected index flag to be kept")
+			}
+		})
+	}
+}
+
+// TestDetectSchemaCategories tests detecting low-cardinality TEXT columns
+func TestDetectSchemaCategories(t *testing.T) {
+	// repeat builds records cycling through the values of one column
+	repeat := func(n int, values ...string) [][]string {
+		records := make([][]string, n)
+		for i := range records {
+			records[i] = []string{values[i%len(values)]}
+		}
+		return records
+	}
+	many := make([]string, 11)
+	for i := range many {
+		many[i] = fmt.Sprintf("level%c", 'a'+i)
+	}
+
+	tests := []struct {
+		name    string
+		records [][]string
+		want    []string
+	}{
+		{"operations", repeat(100, "upload", "download"), []string{"download", "upload"}},
+		{"with empty values", repeat(100, "GET", "", "POST", "not-found"), []string{"GET", "POST", "not-found"}},
+		{"names with digits", repeat(100, "sarah94", "Maia86"), nil},
+		{"too few samples", repeat(10, "upload", "download"), nil},
+		{"too many values", repeat(100, many...), nil},
+		{"numbers", repeat(100, "1", "2"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema, err := DetectSchema([]string{"value"}, tt.records, "logs")
+			if err != nil {
+				t.Fatalf("DetectSchema() error = %v", err)
+			}
+			col := schema.Columns[0]
+			if got := col.Categories(); fmt.Sprint(got) != fmt.Sprint(tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("Categories() = %v, want %v", got, tt.want)
+			}
+			if tt.want != nil && !col.Index {
+				t.Error("Expected categorical column to be indexed")
+			}
+			// The values come from a sample, so they are not enforced
+			if col.Rules != nil || col.EnforcesCategories() || strings.Contains(col.SQLDefinition(), "CHECK") {
+				t.Errorf("Expected detected values not to be enforced, got %s", col.SQLDefinition())
+			}
+		})
+	}
+}
+
+// TestEnforceCategories tests restricting categorical columns to their
+// detected values, keeping declared rules and enums
+func TestEnforceCategories(t *testing.T) {
+	min := 0.0
+	schema := &TableSchema{Name: "logs", Columns: []ColumnSchema{
+		{Name: "operation", Type: TypeText, Domain: []string{"download", "upload"}},
+		{Name: "level", Type: TypeText, Domain: []string{"INFO", "WARN"}, Rules: &ValidationRules{Enum: []string{"DEBUG", "INFO", "WARN"}}},
+		{Name: "method", Type: TypeText, Domain: []string{"GET"}, Rules: &ValidationRules{NotEmpty: true}},
+		{Name: "size", Type: TypeInteger, Rules: &ValidationRules{Min: &min}},
+	}}
+	schema.EnforceCategories()
+
+	want := map[string]string{
+		"operation": "operation TEXT NOT NULL CHECK (operation IN ('download', 'upload'))",
+		"level":     "level TEXT NOT NULL CHECK (level IN ('DEBUG', 'INFO', 'WARN'))",
+		"method":    "method TEXT NOT NULL CHECK (method IS NOT NULL AND trim(method) <> '' AND method IN ('GET'))",
+		"size":      "size INTEGER NOT NULL CHECK (size >= 0)",
+	}
+	for _, col := range schema.Columns {
+		if got := col.SQLDefinition(); got != want[col.Name] {
+			t.Errorf("SQLDefinition() = %s, want %s", got, want[col.Name])
+		}
+		if col.Categories() != nil && !col.EnforcesCategories() {
+			t.Errorf("Expected the values of %s to be enforced", col.Name)
+		}
+	}
+	if err := schema.Columns[0].Rules.Validate("delete", "delete"); err == nil {
+		t.Error("Expected a value outside the detected ones to be rejected")
+	}
+}
+
+// TestMergeSchemasCategories tests combining the categories of two files
+func TestMergeSchemasCategories(t *testing.T) {
+	categorical := func(values ...string) *TableSchema {
+		col := ColumnSchema{Name: "level", Type: TypeText}
+		col.Domain = values
+		return &TableSchema{Name: "logs", Columns: []ColumnSchema{col}}
+	}
+
+	tests := []struct {
+		name string
+		a, b *TableSchema
+		want []string
+	}{
+		{"union", categorical("error", "info"), categorical("info", "warn"), []string{"error", "info", "warn"}},
+		{"free values in one file", categorical("error", "info"), categorical(), nil},
+		{"too many values", categorical("a", "b", "c", "d", "e", "f"), categorical("g", "h", "i", "j", "k"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			merged, err := MergeSchemas(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("MergeSchemas() error = %v", err)
+			}
+			if got := merged.Columns[0].Categories(); fmt.Sprint(got) != fmt.Sprint(tt.want) || (got == nil) != (tt.want == nil) {
+				t.Errorf("Categories() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestSchemaForHeaders tests reordering a schema to match a file's headers
+func TestSchemaForHeaders(t *testing.T) {
+	schema := &TableSchema{
+		Name: "logs",
+		Columns: []ColumnSchema{
+			{Name: "user_name", Type: TypeText},
+			{Name: "size", Type: TypeInteger},
+		},
+	}
+
+	ordered, err := schema.ForHeaders([]string{"Size", "User Name"})
+	if err != nil {
+		t.Fatalf("ForHeaders() unexpected error: %v", err)
+	}
+	if got := strings.Join(ordered.ColumnNames(), ","); got != "size,user_name" {
+		t.Errorf("ForHeaders() columns = %s, want size,user_name", got)
+	}
+
+	if _, err := schema.ForHeaders([]string{"size", "email"}); err == nil {
+		t.Error("ForHeaders() expected error for unknown column")
+	}
+}
+
 // TestDetectSchemaEdgeCases tests edge cases in schema detection
 func TestDetectSchemaEdgeCases(t *testing.T) {
 	tests := []struct {
@@ -464,7 +722,7 @@ func TestColumnTypeInference(t *testing.T) {
 		{
 			name:     "mixed numbers favor real",
 			values:   []string{"1", "2.5", "3", "4.0"},
-			expected: TypeText, // Current implementation treats mixed as text
+			expected: TypeReal, // Integers fit a REAL column too
 		},
 		{
 			name:     "boolean true/false",
@@ -0,0 +1,94 @@
+// Package parser provides CSV parsing and schema detection functionality
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimestampFormat is the form timestamps are stored in, always in UTC
+// It sorts as text, and SQLite's date and time functions read it, so
+// date(timestamp) = '2020-04-15' compares UTC days whatever the input format
+// Fractional seconds are only written when present
+const TimestampFormat = "2006-01-02 15:04:05.999999"
+
+// timestampFormats are the layouts accepted besides UNIX timestamps
+// Fractional seconds are accepted after the seconds of any layout
+var timestampFormats = []string{
+	time.RFC3339,                    // 2020-04-15T10:00:00Z, 2020-04-15T10:00:00-07:00
+	"2006-01-02 15:04:05Z07:00",     // 2020-04-15 10:00:00-07:00, as Go writes times to SQLite
+	"2006-01-02 15:04:05",           // 2020-04-15 10:00:00
+	"2006-01-02T15:04:05",           // 2020-04-15T10:00:00
+	"01/02/2006 15:04:05",           // 04/15/2020 10:00:00
+	"2006-01-02",                    // 2020-04-15
+	"Mon Jan 2 15:04:05 MST 2006",   // Sun Apr 12 22:10:38 UTC 2020
+	"Mon Jan 2 15:04:05 -0700 2006", // Sun Apr 12 22:10:38 +0200 2020
+	"Mon Jan 2 15:04:05 2006",       // Sun Apr 12 22:10:38 2020
+}
+
+// zoneOffsets are the UTC offsets, in hours, of common time zone abbreviations
+// Go only knows the abbreviations of the location a time is parsed in and
+// reads any other as UTC, which would silently shift such timestamps
+// Ambiguous abbreviations (CST, IST) take their North American or Indian meaning
+var zoneOffsets = map[string]float64{
+	"UTC": 0, "UT": 0, "GMT": 0, "Z": 0, "WET": 0, "WEST": 1, "BST": 1,
+	"CET": 1, "CEST": 2, "EET": 2, "EEST": 3, "MSK": 3, "IST": 5.5,
+	"HKT": 8, "SGT": 8, "AWST": 8, "JST": 9, "KST": 9, "ACST": 9.5, "AEST": 10, "AEDT": 11,
+	"NZST": 12, "NZDT": 13, "HST": -10, "AKST": -9, "AKDT": -8, "PST": -8, "PDT": -7,
+	"MST": -7, "MDT": -6, "CST": -6, "CDT": -5, "EST": -5, "EDT": -4,
+}
+
+// ParseTimestamp parses a timestamp in any of the supported formats and
+// returns it in UTC. UNIX timestamps in seconds or milliseconds and times with
+// a zone are absolute; times without one are read in loc (UTC when nil)
+func ParseTimestamp(value string, loc *time.Location) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		// If timestamp > year 2100 in seconds, assume it's milliseconds
+		if timestamp > 4102444800 {
+			return time.UnixMilli(timestamp).UTC(), nil
+		}
+		return time.Unix(timestamp, 0).UTC(), nil
+	}
+
+	for _, format := range timestampFormats {
+		t, err := time.ParseInLocation(format, value, loc)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(format, "MST") {
+			if t, err = resolveZoneAbbreviation(t, loc); err != nil {
+				return time.Time{}, err
+			}
+		}
+		return t.UTC(), nil
+	}
+
+	return time.Time{}, fmt.Errorf("timestamp format not recognized, expected UNIX timestamp or common date formats like '2006-01-02 15:04:05', '2006-01-02', or 'Mon Jan 2 15:04:05 MST 2006'")
+}
+
+// resolveZoneAbbreviation corrects a time parsed with a zone abbreviation that
+// loc does not define, which time.Parse reads with a zero offset
+func resolveZoneAbbreviation(t time.Time, loc *time.Location) (time.Time, error) {
+	name, offset := t.Zone()
+	if offset != 0 || t.Location() == loc || t.Location() == time.UTC {
+		return t, nil // An abbreviation loc defines, or UTC
+	}
+
+	hours, ok := zoneOffsets[strings.ToUpper(name)]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown time zone abbreviation '%s', use a numeric offset such as -0700", name)
+	}
+	zone := time.FixedZone(name, int(hours*3600))
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone), nil
+}
+
+// FormatTimestamp formats a time as stored in the database (see TimestampFormat)
+func FormatTimestamp(t time.Time) string {
+	return t.UTC().Format(TimestampFormat)
+}
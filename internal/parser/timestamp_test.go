@@ -0,0 +1,59 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestParseTimestamp tests parsing every supported format into UTC
+func TestParseTimestamp(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("Time zone database not available: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		value   string
+		loc     *time.Location
+		want    string
+		wantErr string
+	}{
+		{"UNIX seconds", "1587504638", nil, "2020-04-21 21:30:38", ""},
+		{"UNIX milliseconds", "1587504638250", nil, "2020-04-21 21:30:38.25", ""},
+		{"UNIX ignores input zone", "1587504638", newYork, "2020-04-21 21:30:38", ""},
+		{"human-readable UTC", "Sun Apr 12 22:10:38 UTC 2020", nil, "2020-04-12 22:10:38", ""},
+		{"zone abbreviation", "Sun Apr 12 22:10:38 PDT 2020", nil, "2020-04-13 05:10:38", ""},
+		{"abbreviation of input zone", "Sun Apr 12 22:10:38 EDT 2020", newYork, "2020-04-13 02:10:38", ""},
+		{"unknown abbreviation", "Sun Apr 12 22:10:38 XYZ 2020", nil, "", "unknown time zone abbreviation 'XYZ'"},
+		{"numeric offset", "Sun Apr 12 22:10:38 +0200 2020", nil, "2020-04-12 20:10:38", ""},
+		{"RFC 3339", "2020-04-15T10:00:00-07:00", nil, "2020-04-15 17:00:00", ""},
+		{"Go SQLite form", "2020-04-15 10:00:00.5+02:00", nil, "2020-04-15 08:00:00.5", ""},
+		{"zoneless", "2020-04-15 10:00:00", nil, "2020-04-15 10:00:00", ""},
+		{"zoneless in input zone", "2020-04-15 23:30:00", newYork, "2020-04-16 03:30:00", ""},
+		{"date", "04/15/2020 10:00:00", nil, "2020-04-15 10:00:00", ""},
+		{"invalid", "yesterday", nil, "", "timestamp format not recognized"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimestamp(tt.value, tt.loc)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseTimestamp() error = %v", err)
+			}
+			if got.Location() != time.UTC {
+				t.Errorf("Expected a UTC time, got %v", got.Location())
+			}
+			if formatted := FormatTimestamp(got); formatted != tt.want {
+				t.Errorf("ParseTimestamp() = %s, want %s", formatted, tt.want)
+			}
+		})
+	}
+}